@@ -0,0 +1,115 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/google/nftables"
+
+	"bird-flowspec-daemon/internal/detector"
+	"bird-flowspec-daemon/internal/originate"
+	"bird-flowspec-daemon/internal/rulebuilder"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// Dynamic sets counting the traffic per destination address
+const (
+	accountingSet4 = "flowspec_accounting4"
+	accountingSet6 = "flowspec_accounting6"
+)
+
+// accountingSets are the names and key types of the accounting sets per address family
+var accountingSets = []struct {
+	name    string
+	ipv6    bool
+	keyType nftables.SetDatatype
+}{
+	{accountingSet4, false, nftables.TypeIPAddr},
+	{accountingSet6, true, nftables.TypeIP6Addr},
+}
+
+// setupAccounting creates the dynamic sets counting the traffic per destination address in the tables of the
+// chains seeing their address family. Elements of destinations without traffic time out after a few detector
+// intervals. The sets hold at most --detector.max-destinations elements, the kernel does not add further
+// destinations to a full set.
+func setupAccounting(nft *nftables.Conn, chains []*nftables.Chain) []*nftables.Set {
+	var sets []*nftables.Set
+	for _, chain := range chains {
+		for _, set := range accountingSets {
+			if !tableSeesFamily(chain.Table, set.ipv6) {
+				continue
+			}
+			accountingSet := &nftables.Set{
+				Table:      chain.Table,
+				Name:       set.name,
+				KeyType:    set.keyType,
+				Dynamic:    true,
+				HasTimeout: true,
+				Timeout:    4 * config.detector.Interval,
+				Size:       config.detectorMaxDestination,
+			}
+			if err := nft.AddSet(accountingSet, nil); err != nil {
+				slog.Error("error creating accounting set", slog.String("set", set.name), slog.String("error", err.Error()))
+				panic(err)
+			}
+			sets = append(sets, accountingSet)
+		}
+	}
+	if err := nft.Flush(); err != nil {
+		slog.Error("error creating accounting sets", slog.String("error", err.Error()))
+		panic(err)
+	}
+	return sets
+}
+
+// accountingRules returns the rules adding the traffic of every packet to the accounting sets of the table
+func accountingRules(table *nftables.Table, chain *nftables.Chain) []*nftables.Rule {
+	var rules []*nftables.Rule
+	for _, set := range accountingSets {
+		if tableSeesFamily(table, set.ipv6) {
+			rules = append(rules, &nftables.Rule{Table: table, Chain: chain, Exprs: rulebuilder.AccountingExpressions(table, rulePlacement(), set.ipv6, set.name)})
+		}
+	}
+	return rules
+}
+
+// readAccounting returns a reader of the counters of the accounting sets
+func readAccounting(nft *nftables.Conn, sets []*nftables.Set) func() ([]detector.Sample, error) {
+	return func() ([]detector.Sample, error) {
+		var samples []detector.Sample
+		for _, set := range sets {
+			elements, err := nft.GetSetElements(set)
+			if err != nil {
+				return nil, err
+			}
+			if len(elements) >= int(config.detectorMaxDestination) {
+				slog.Warn("accounting set is full, traffic to further destinations is not counted", slog.String("table", set.Table.Name), slog.String("set", set.Name))
+			}
+			for _, element := range elements {
+				sample := detector.Sample{Destination: net.IP(element.Key)}
+				if element.Counter != nil {
+					sample.Packets = element.Counter.Packets
+					sample.Bytes = element.Counter.Bytes
+				}
+				samples = append(samples, sample)
+			}
+		}
+		return samples, nil
+	}
+}
+
+// newDetector creates the threshold detector, which originates its mitigations via originator if set
+func newDetector(nft *nftables.Conn, sets []*nftables.Set, originator *originate.Originator) *detector.Detector {
+	var originateMitigation detector.Originate
+	if originator != nil {
+		originateMitigation = func(ctx context.Context, rule source.StaticRule, ttl time.Duration) error {
+			_, err := originator.Add(ctx, rule, ttl)
+			return err
+		}
+	}
+	return detector.New("detector", config.detector, readAccounting(nft, sets), originateMitigation)
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// diagnostics keeps the routes of the last update that did not make it into nftables
+type diagnostics struct {
+	mu             sync.RWMutex
+	birdFiltered   []route.Summary
+	daemonRejected []source.Rejection
+}
+
+func (d *diagnostics) setBirdFiltered(summaries []route.Summary) {
+	metrics.BirdFilteredFlowSpecRoutes.Reset()
+	for _, summary := range summaries {
+		metrics.BirdFilteredFlowSpecRoutes.With(prometheus.Labels{"protocol": summary.Protocol}).Inc()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.birdFiltered = summaries
+}
+
+func (d *diagnostics) setDaemonRejected(rejected []source.Rejection) {
+	metrics.FlowSpecRoutesRejected.Reset()
+	for _, r := range rejected {
+		metrics.FlowSpecRoutesRejected.With(prometheus.Labels{"protocol": r.Protocol}).Inc()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.daemonRejected = rejected
+}
+
+// ServeHTTP lists the routes rejected by BIRD and by the daemon as JSON
+func (d *diagnostics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	response := struct {
+		BirdFiltered   []route.Summary    `json:"bird_filtered"`
+		DaemonRejected []source.Rejection `json:"daemon_rejected"`
+	}{
+		BirdFiltered:   d.birdFiltered,
+		DaemonRejected: d.daemonRejected,
+	}
+	if response.BirdFiltered == nil {
+		response.BirdFiltered = []route.Summary{}
+	}
+	if response.DaemonRejected == nil {
+		response.DaemonRejected = []source.Rejection{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Warn("failed to write diagnostics response", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/nftables"
+
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/rulebuilder"
+)
+
+// parseInterfaceGroups parses the interface groups of the configuration, mapping group identifiers to comma
+// separated interface names
+func parseInterfaceGroups(groups map[string]string) (map[uint16][]string, error) {
+	parsed := make(map[uint16][]string)
+	for group, names := range groups {
+		id, err := strconv.ParseUint(group, 10, 14)
+		if err != nil {
+			return nil, fmt.Errorf("interface group %q: %v", group, err)
+		}
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				parsed[uint16(id)] = append(parsed[uint16(id)], name)
+			}
+		}
+		if len(parsed[uint16(id)]) == 0 {
+			return nil, fmt.Errorf("interface group %d: no interfaces", id)
+		}
+	}
+	return parsed, nil
+}
+
+// resolveInterfaces sets the input and output interfaces of a route to the interfaces of the groups of its
+// interface-set extended communities
+func resolveInterfaces(flowSpecRoute *route.FlowspecRoute) error {
+	var input, output []string
+	for _, interfaceSet := range route.InterfaceSetsFromExtCommunities(flowSpecRoute.BGPAttrs.ExtCommunities) {
+		names, ok := config.interfaceGroups[interfaceSet.Group]
+		if !ok {
+			return fmt.Errorf("interface group %d not configured", interfaceSet.Group)
+		}
+		if interfaceSet.Ingress {
+			input = append(input, names...)
+		}
+		if interfaceSet.Egress {
+			output = append(output, names...)
+		}
+	}
+	if len(output) > 0 && !outputInterfaceKnown() {
+		return fmt.Errorf("egress interface sets are not enforced before routing")
+	}
+	flowSpecRoute.MatchAttrs.InputInterfaces = input
+	flowSpecRoute.MatchAttrs.OutputInterfaces = output
+	return nil
+}
+
+// outputInterfaceKnown reports whether the output interface of packets is known in the flowspec chain, which is
+// not the case before the routing decision
+func outputInterfaceKnown() bool {
+	if rulePlacement() != rulebuilder.PlacementFilter && rulePlacement() != rulebuilder.PlacementBridge {
+		return false
+	}
+	return !slices.Contains([]string{"prerouting", "input"}, config.nftHook)
+}
+
+// interfaceSets appends the interface sets of the routes to sets, the routes of sets of the same name are merged
+func interfaceSets(table *nftables.Table, flowSpecRoutes []route.FlowspecRoute, sets []*rulebuilder.MatchSet) []*rulebuilder.MatchSet {
+	for _, flowSpecRoute := range flowSpecRoutes {
+		for _, set := range rulebuilder.InterfaceSets(table, flowSpecRoute) {
+			i := slices.IndexFunc(sets, func(other *rulebuilder.MatchSet) bool { return other.Set.Name == set.Set.Name })
+			if i < 0 {
+				sets = append(sets, set)
+				continue
+			}
+			sets[i].Routes = append(sets[i].Routes, flowSpecRoute)
+		}
+	}
+	return sets
+}
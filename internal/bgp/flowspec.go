@@ -0,0 +1,30 @@
+package bgp
+
+import (
+	"bird-flowspec-daemon/internal/flowspec"
+	"bird-flowspec-daemon/internal/route"
+)
+
+// splitFlowspecNLRI splits the length prefixed flowspec NLRI of a MP_REACH/MP_UNREACH attribute
+func splitFlowspecNLRI(afi uint16, safi uint8, data []byte) ([]NLRI, error) {
+	encoded, err := flowspec.Split(data)
+	if err != nil {
+		return nil, err
+	}
+	nlri := make([]NLRI, 0, len(encoded))
+	for _, data := range encoded {
+		nlri = append(nlri, NLRI{AFI: afi, SAFI: safi, Data: data})
+	}
+	return nlri, nil
+}
+
+// RouteFromNLRI decodes the components of a flowspec NLRI (without length prefix) into the match
+// attributes of a copy of template. Components that can not be represented as route match
+// attributes are rejected.
+func RouteFromNLRI(afi uint16, data []byte, template route.FlowspecRoute) (route.FlowspecRoute, error) {
+	nlri, err := flowspec.Decode(data, afi == AFIIPv6)
+	if err != nil {
+		return route.FlowspecRoute{}, err
+	}
+	return nlri.Route(template)
+}
@@ -0,0 +1,100 @@
+package bgp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BGP message types (RFC 4271 section 4.1)
+const (
+	MessageTypeOpen         = 1
+	MessageTypeUpdate       = 2
+	MessageTypeNotification = 3
+	MessageTypeKeepalive    = 4
+)
+
+// Address families used for flowspec (RFC 8955, RFC 8956)
+const (
+	AFIIPv4      = 1
+	AFIIPv6      = 2
+	SAFIFlowspec = 133
+)
+
+const headerLength = 19
+
+var marker = bytes.Repeat([]byte{0xff}, 16)
+
+// Message is a BGP message without its common header
+type Message struct {
+	Type uint8
+	Body []byte
+}
+
+// Marshal encodes the message including its common header
+func (m Message) Marshal() []byte {
+	data := make([]byte, headerLength, headerLength+len(m.Body))
+	copy(data, marker)
+	binary.BigEndian.PutUint16(data[16:18], uint16(headerLength+len(m.Body)))
+	data[18] = m.Type
+	return append(data, m.Body...)
+}
+
+// WriteMessage writes one BGP message to w
+func WriteMessage(w io.Writer, m Message) error {
+	_, err := w.Write(m.Marshal())
+	return err
+}
+
+// ReadMessage reads one BGP message from r
+func ReadMessage(r io.Reader) (Message, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Message{}, err
+	}
+
+	length, err := parseHeader(header)
+	if err != nil {
+		return Message{}, err
+	}
+
+	body := make([]byte, length-headerLength)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Type: header[18], Body: body}, nil
+}
+
+// ParseMessage parses a BGP message including its common header, e.g. as embedded in BMP or MRT records
+func ParseMessage(data []byte) (Message, error) {
+	if len(data) < headerLength {
+		return Message{}, errors.New("message too short")
+	}
+
+	length, err := parseHeader(data[:headerLength])
+	if err != nil {
+		return Message{}, err
+	}
+	if length > len(data) {
+		return Message{}, errors.New("message truncated")
+	}
+
+	return Message{Type: data[18], Body: data[headerLength:length]}, nil
+}
+
+// parseHeader validates the common message header and returns the message length
+func parseHeader(header []byte) (int, error) {
+	if !bytes.Equal(header[:16], marker) {
+		return 0, errors.New("invalid message marker")
+	}
+
+	length := int(binary.BigEndian.Uint16(header[16:18]))
+	if length < headerLength {
+		return 0, fmt.Errorf("invalid message length %d", length)
+	}
+
+	return length, nil
+}
@@ -0,0 +1,172 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+)
+
+// Capability codes (RFC 5492)
+const (
+	capabilityMultiprotocol   = 1
+	capabilityGracefulRestart = 64
+	capabilityFourOctetAS     = 65
+)
+
+const (
+	bgpVersion              = 4
+	optionalParamCapability = 2
+	asTrans                 = 23456
+	gracefulRestartTimeMax  = 0xfff
+)
+
+// AddressFamily is an AFI/SAFI pair
+type AddressFamily struct {
+	AFI  uint16
+	SAFI uint8
+}
+
+// flowspecFamilies are the address families negotiated by the speaker
+var flowspecFamilies = []AddressFamily{{AFI: AFIIPv4, SAFI: SAFIFlowspec}, {AFI: AFIIPv6, SAFI: SAFIFlowspec}}
+
+// Open is a BGP OPEN message
+type Open struct {
+	AS       uint32
+	HoldTime time.Duration
+	RouterID net.IP
+	Families []AddressFamily
+	ASN4     bool
+	// GracefulRestart is set if the speaker supports graceful restart (RFC 4724)
+	GracefulRestart bool
+	RestartTime     time.Duration
+	// Restarting is the restart state flag, the speaker has restarted and not yet sent End-of-RIB
+	Restarting bool
+	// RestartFamilies are the address families of which routes are retained during a restart
+	RestartFamilies []AddressFamily
+}
+
+// Marshal encodes the OPEN message
+func (o Open) Marshal() Message {
+	var capabilities []byte
+	for _, family := range o.Families {
+		capabilities = append(capabilities, capabilityMultiprotocol, 4, byte(family.AFI>>8), byte(family.AFI), 0, family.SAFI)
+	}
+	if o.GracefulRestart {
+		restart := uint16(o.RestartTime / time.Second)
+		if restart > gracefulRestartTimeMax {
+			restart = gracefulRestartTimeMax
+		}
+		if o.Restarting {
+			restart |= 0x8000
+		}
+		capability := []byte{byte(restart >> 8), byte(restart)}
+		for _, family := range o.RestartFamilies {
+			capability = append(capability, byte(family.AFI>>8), byte(family.AFI), family.SAFI, 0)
+		}
+		capabilities = append(capabilities, capabilityGracefulRestart, byte(len(capability)))
+		capabilities = append(capabilities, capability...)
+	}
+	if o.ASN4 {
+		capabilities = append(capabilities, capabilityFourOctetAS, 4, byte(o.AS>>24), byte(o.AS>>16), byte(o.AS>>8), byte(o.AS))
+	}
+
+	myAS := uint16(o.AS)
+	if o.AS > 0xffff {
+		myAS = asTrans
+	}
+
+	body := make([]byte, 10, 12+len(capabilities))
+	body[0] = bgpVersion
+	binary.BigEndian.PutUint16(body[1:3], myAS)
+	binary.BigEndian.PutUint16(body[3:5], uint16(o.HoldTime/time.Second))
+	copy(body[5:9], o.RouterID.To4())
+	body[9] = byte(2 + len(capabilities))
+	body = append(body, optionalParamCapability, byte(len(capabilities)))
+	body = append(body, capabilities...)
+
+	return Message{Type: MessageTypeOpen, Body: body}
+}
+
+// ParseOpen parses the body of an OPEN message
+func ParseOpen(body []byte) (Open, error) {
+	if len(body) < 10 {
+		return Open{}, errors.New("open message too short")
+	}
+	if body[0] != bgpVersion {
+		return Open{}, fmt.Errorf("unsupported BGP version %d", body[0])
+	}
+
+	open := Open{
+		AS:       uint32(binary.BigEndian.Uint16(body[1:3])),
+		HoldTime: time.Duration(binary.BigEndian.Uint16(body[3:5])) * time.Second,
+		RouterID: net.IP(body[5:9]).To16(),
+	}
+
+	params := body[10:]
+	if len(params) != int(body[9]) {
+		return Open{}, errors.New("invalid optional parameters length")
+	}
+	for len(params) > 0 {
+		if len(params) < 2 || len(params) < 2+int(params[1]) {
+			return Open{}, errors.New("optional parameter truncated")
+		}
+		paramType, value := params[0], params[2:2+int(params[1])]
+		params = params[2+int(params[1]):]
+		if paramType != optionalParamCapability {
+			continue
+		}
+
+		for len(value) > 0 {
+			if len(value) < 2 || len(value) < 2+int(value[1]) {
+				return Open{}, errors.New("capability truncated")
+			}
+			code, capability := value[0], value[2:2+int(value[1])]
+			value = value[2+int(value[1]):]
+
+			switch code {
+			case capabilityMultiprotocol:
+				if len(capability) != 4 {
+					return Open{}, errors.New("invalid multiprotocol capability")
+				}
+				open.Families = append(open.Families, AddressFamily{AFI: binary.BigEndian.Uint16(capability[0:2]), SAFI: capability[3]})
+			case capabilityFourOctetAS:
+				if len(capability) != 4 {
+					return Open{}, errors.New("invalid four-octet AS capability")
+				}
+				open.ASN4 = true
+				open.AS = binary.BigEndian.Uint32(capability)
+			case capabilityGracefulRestart:
+				if len(capability) < 2 {
+					return Open{}, errors.New("invalid graceful restart capability")
+				}
+				open.GracefulRestart = true
+				flags := binary.BigEndian.Uint16(capability[0:2])
+				open.Restarting = flags&0x8000 != 0
+				open.RestartTime = time.Duration(flags&gracefulRestartTimeMax) * time.Second
+				for tuples := capability[2:]; len(tuples) >= 4; tuples = tuples[4:] {
+					open.RestartFamilies = append(open.RestartFamilies, AddressFamily{AFI: binary.BigEndian.Uint16(tuples[0:2]), SAFI: tuples[2]})
+				}
+			}
+		}
+	}
+
+	return open, nil
+}
+
+// retains reports whether routes of the address family are retained during a graceful restart of the speaker
+func (o Open) retains(family AddressFamily) bool {
+	return o.GracefulRestart && slices.Contains(o.RestartFamilies, family)
+}
+
+// supports reports whether the address family was announced in the OPEN message
+func (o Open) supports(family AddressFamily) bool {
+	for _, f := range o.Families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,429 @@
+package bgp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// Notification error codes (RFC 4271 section 4.5)
+const (
+	notificationOpenError          = 2
+	notificationUpdateMessageError = 3
+	notificationHoldTimerExpired   = 4
+	notificationCease              = 6
+
+	openErrorBadPeerAS                = 2
+	openErrorUnsupportedCapability    = 7
+	updateErrorMalformedAttributeList = 1
+	ceaseAdministrativeShutdown       = 2
+)
+
+// openHoldTime is the hold time until the OPEN message of the peer is received (RFC 4271 section 8)
+const openHoldTime = 4 * time.Minute
+
+var messageTypeNames = map[uint8]string{
+	MessageTypeOpen:         "open",
+	MessageTypeUpdate:       "update",
+	MessageTypeNotification: "notification",
+	MessageTypeKeepalive:    "keepalive",
+}
+
+// NotificationError is a NOTIFICATION message sent or received on a session
+type NotificationError struct {
+	Code    uint8
+	Subcode uint8
+	Data    []byte
+}
+
+func (e NotificationError) Error() string {
+	return fmt.Sprintf("notification code %d subcode %d", e.Code, e.Subcode)
+}
+
+func (e NotificationError) message() Message {
+	return Message{Type: MessageTypeNotification, Body: append([]byte{e.Code, e.Subcode}, e.Data...)}
+}
+
+// SessionConfig configures the iBGP session of the speaker
+type SessionConfig struct {
+	LocalAS  uint32
+	RouterID net.IP
+	HoldTime time.Duration
+	// RestartTime is announced in the graceful restart capability
+	RestartTime time.Duration
+}
+
+// Session is a receive-only iBGP speaker for flowspec routes. Routes of a peer that supports graceful
+// restart (RFC 4724) are kept as stale after the session went down, until the peer sent End-of-RIB
+// again or its restart time expired.
+type Session struct {
+	config SessionConfig
+
+	mu         sync.RWMutex
+	routes     map[string]route.FlowspecRoute
+	stale      map[string]uint16
+	staleTimer *time.Timer
+	updates    chan struct{}
+}
+
+// NewSession creates a speaker with an empty RIB
+func NewSession(config SessionConfig) *Session {
+	return &Session{
+		config:  config,
+		routes:  make(map[string]route.FlowspecRoute),
+		stale:   make(map[string]uint16),
+		updates: make(chan struct{}, 1),
+	}
+}
+
+// Updates signals changes of the received routes
+func (s *Session) Updates() <-chan struct{} {
+	return s.updates
+}
+
+// Routes returns the received flowspec routes in a stable order
+func (s *Session) Routes() []route.FlowspecRoute {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.routes))
+	for key := range s.routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	routes := make([]route.FlowspecRoute, 0, len(keys))
+	for _, key := range keys {
+		routes = append(routes, s.routes[key])
+	}
+	return routes
+}
+
+// Run connects to the neighbor at address and keeps the session up until ctx is done
+func (s *Session) Run(ctx context.Context, address string, retry time.Duration) {
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("failed to connect to BGP neighbor", slog.String("neighbor", address), slog.String("error", err.Error()))
+		} else if err := s.serve(ctx, conn); err != nil && ctx.Err() == nil {
+			slog.Warn("BGP session closed", slog.String("neighbor", address), slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// serve runs one BGP session on conn
+func (s *Session) serve(ctx context.Context, conn net.Conn) error {
+	var writeMu sync.Mutex
+	write := func(message Message) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return WriteMessage(conn, message)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+			_ = write(NotificationError{Code: notificationCease, Subcode: ceaseAdministrativeShutdown}.message())
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	localOpen := Open{
+		AS:              s.config.LocalAS,
+		HoldTime:        s.config.HoldTime,
+		RouterID:        s.config.RouterID,
+		Families:        flowspecFamilies,
+		ASN4:            true,
+		GracefulRestart: true,
+		RestartTime:     s.config.RestartTime,
+	}
+	if err := write(localOpen.Marshal()); err != nil {
+		return fmt.Errorf("failed to send open message: %v", err)
+	}
+
+	message, err := s.read(conn, openHoldTime)
+	if err != nil {
+		return err
+	}
+	if message.Type != MessageTypeOpen {
+		return fmt.Errorf("unexpected message type %d, expected open", message.Type)
+	}
+	peerOpen, err := ParseOpen(message.Body)
+	if err != nil {
+		return fmt.Errorf("failed to parse open message: %v", err)
+	}
+	if err := s.checkOpen(peerOpen); err != nil {
+		_ = write(err.message())
+		return err
+	}
+
+	holdTime := min(s.config.HoldTime, peerOpen.HoldTime)
+	asn4 := peerOpen.ASN4
+	if err := write(Message{Type: MessageTypeKeepalive}); err != nil {
+		return fmt.Errorf("failed to send keepalive message: %v", err)
+	}
+	message, err = s.read(conn, holdTime)
+	if err != nil {
+		return err
+	}
+	if message.Type != MessageTypeKeepalive {
+		return fmt.Errorf("unexpected message type %d, expected keepalive", message.Type)
+	}
+
+	peer := peerAddress(conn)
+	s.established(peerOpen)
+	slog.Info("BGP session established", slog.String("neighbor", peer.String()), slog.Any("as", peerOpen.AS), slog.String("router_id", peerOpen.RouterID.String()))
+	metrics.BGPSessionEstablished.Set(1)
+	defer func() {
+		metrics.BGPSessionEstablished.Set(0)
+		s.down(peerOpen)
+	}()
+
+	// The speaker advertises no routes, so the initial update of every negotiated family is complete right away
+	for _, family := range flowspecFamilies {
+		if !peerOpen.supports(family) {
+			continue
+		}
+		if err := write(endOfRIBMessage(family)); err != nil {
+			return fmt.Errorf("failed to send End-of-RIB: %v", err)
+		}
+	}
+
+	if holdTime > 0 {
+		go func() {
+			ticker := time.NewTicker(holdTime / 3)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := write(Message{Type: MessageTypeKeepalive}); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for {
+		message, err := s.read(conn, holdTime)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				_ = write(NotificationError{Code: notificationHoldTimerExpired}.message())
+				return errors.New("hold timer expired")
+			}
+			return err
+		}
+
+		switch message.Type {
+		case MessageTypeUpdate:
+			update, err := ParseUpdate(message.Body, asn4)
+			var treatAsWithdraw TreatAsWithdrawError
+			switch {
+			case errors.As(err, &treatAsWithdraw):
+				slog.Warn("withdrawing routes of BGP update with malformed attributes", slog.String("neighbor", peer.String()), slog.String("error", err.Error()))
+			case err != nil:
+				_ = write(NotificationError{Code: notificationUpdateMessageError, Subcode: updateErrorMalformedAttributeList}.message())
+				return fmt.Errorf("invalid update: %v", err)
+			}
+			s.applyUpdate(peer, update)
+		case MessageTypeKeepalive:
+		default:
+			return fmt.Errorf("unexpected message type %d", message.Type)
+		}
+	}
+}
+
+// read reads the next message, failing if none arrived within holdTime. A hold time of zero disables the timeout.
+func (s *Session) read(conn net.Conn, holdTime time.Duration) (Message, error) {
+	deadline := time.Time{}
+	if holdTime > 0 {
+		deadline = time.Now().Add(holdTime)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return Message{}, err
+	}
+
+	message, err := ReadMessage(conn)
+	if err != nil {
+		return Message{}, err
+	}
+
+	messageType, ok := messageTypeNames[message.Type]
+	if !ok {
+		messageType = "unknown"
+	}
+	metrics.BGPMessagesTotal.With(prometheus.Labels{"type": messageType}).Inc()
+
+	if message.Type == MessageTypeNotification {
+		notification := NotificationError{}
+		if len(message.Body) >= 2 {
+			notification = NotificationError{Code: message.Body[0], Subcode: message.Body[1], Data: message.Body[2:]}
+		}
+		return Message{}, notification
+	}
+	return message, nil
+}
+
+// checkOpen validates the OPEN message of the peer for an iBGP flowspec session
+func (s *Session) checkOpen(open Open) *NotificationError {
+	if open.AS != s.config.LocalAS {
+		return &NotificationError{Code: notificationOpenError, Subcode: openErrorBadPeerAS}
+	}
+	for _, family := range flowspecFamilies {
+		if open.supports(family) {
+			return nil
+		}
+	}
+	return &NotificationError{Code: notificationOpenError, Subcode: openErrorUnsupportedCapability}
+}
+
+// established keeps stale routes of a graceful restart until End-of-RIB, unless the peer does not retain their
+// address family any longer
+func (s *Session) established(open Open) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, family := range flowspecFamilies {
+		if !open.retains(family) {
+			s.purgeStale(family.AFI)
+		}
+	}
+	if len(s.stale) == 0 {
+		s.stopStaleTimer()
+		return
+	}
+	s.startStaleTimer(open.RestartTime)
+}
+
+// down marks the routes of the address families the peer retains during a graceful restart as stale, the
+// other routes are removed
+func (s *Session) down(open Open) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, flowSpecRoute := range s.routes {
+		afi := uint16(AFIIPv4)
+		if flowSpecRoute.IsIPv6() {
+			afi = AFIIPv6
+		}
+		if open.RestartTime == 0 || !open.retains(AddressFamily{AFI: afi, SAFI: SAFIFlowspec}) {
+			delete(s.routes, key)
+			delete(s.stale, key)
+			continue
+		}
+		s.stale[key] = afi
+	}
+	source.Notify(s.updates)
+
+	if len(s.stale) == 0 {
+		s.stopStaleTimer()
+		return
+	}
+	// A repeated restart restarts the timer with the restart time of the last session
+	s.startStaleTimer(open.RestartTime)
+}
+
+// startStaleTimer removes the stale routes after d, replacing the timer of a previous restart. s.mu must be held.
+func (s *Session) startStaleTimer(d time.Duration) {
+	s.stopStaleTimer()
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// The timer may have fired while a later restart replaced it
+		if s.staleTimer != timer {
+			return
+		}
+		s.staleTimer = nil
+		s.purgeStale(0)
+	})
+	s.staleTimer = timer
+}
+
+// stopStaleTimer stops the timer removing the stale routes. s.mu must be held.
+func (s *Session) stopStaleTimer() {
+	if s.staleTimer != nil {
+		s.staleTimer.Stop()
+		s.staleTimer = nil
+	}
+}
+
+// purgeStale removes the stale routes of an address family, or of all families if afi is zero. s.mu must be held.
+func (s *Session) purgeStale(afi uint16) {
+	for key, staleAFI := range s.stale {
+		if afi == 0 || afi == staleAFI {
+			delete(s.routes, key)
+			delete(s.stale, key)
+		}
+	}
+	source.Notify(s.updates)
+}
+
+// applyUpdate applies the announcements and withdrawals of an update to the RIB
+func (s *Session) applyUpdate(peer net.IP, update Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if afi, safi, ok := update.EndOfRIB(); ok {
+		if safi == SAFIFlowspec {
+			s.purgeStale(afi)
+		}
+		return
+	}
+
+	for _, nlri := range slices.Concat(update.Withdrawn, update.Announced) {
+		delete(s.stale, nlri.key())
+	}
+	template := update.Route
+	template.SessionAttrs.SessionName = peer.String()
+	template.SessionAttrs.NeighborAddress = peer
+	template.SessionAttrs.ImportTime = time.Now()
+	err := source.UpdateRIB(s.routes, update.Withdrawn, update.Announced, NLRI.key, func(nlri NLRI) (route.FlowspecRoute, error) {
+		return RouteFromNLRI(nlri.AFI, nlri.Data, template)
+	})
+	if err != nil {
+		slog.Warn("error decoding flowspec NLRI", slog.String("neighbor", peer.String()), slog.String("error", err.Error()))
+	}
+
+	source.Notify(s.updates)
+}
+
+func (n NLRI) key() string {
+	return fmt.Sprintf("%d/%x", n.AFI, n.Data)
+}
+
+func peerAddress(conn net.Conn) net.IP {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package bgp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func TestOpenRoundTrip(t *testing.T) {
+	open := Open{
+		AS:              4200000000,
+		HoldTime:        90 * time.Second,
+		RouterID:        net.ParseIP("192.0.2.1"),
+		Families:        flowspecFamilies,
+		ASN4:            true,
+		GracefulRestart: true,
+		RestartTime:     120 * time.Second,
+		RestartFamilies: flowspecFamilies,
+	}
+
+	parsed, err := ParseOpen(open.Marshal().Body)
+	require.NoError(t, err)
+	assert.Equal(t, open, parsed)
+	assert.Equal(t, []byte{0x5b, 0xa0}, open.Marshal().Body[1:3], "AS_TRANS for four-octet AS numbers")
+}
+
+// testPeer is the neighbor side of an in-process BGP session
+type testPeer struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (p testPeer) read() Message {
+	message, err := ReadMessage(p.conn)
+	require.NoError(p.t, err)
+	return message
+}
+
+func (p testPeer) write(message Message) {
+	require.NoError(p.t, WriteMessage(p.conn, message))
+}
+
+// peerOpen is the OPEN message of the neighbor, retaining the routes of families during a graceful restart
+func peerOpen(restartFamilies ...AddressFamily) Open {
+	return Open{
+		AS:              65000,
+		RouterID:        net.ParseIP("192.0.2.2"),
+		Families:        flowspecFamilies,
+		ASN4:            true,
+		GracefulRestart: len(restartFamilies) > 0,
+		RestartTime:     time.Minute,
+		RestartFamilies: restartFamilies,
+	}
+}
+
+// establish runs the OPEN/KEEPALIVE exchange and returns the OPEN message of the speaker
+func (p testPeer) establish(gracefulRestart bool) Open {
+	if gracefulRestart {
+		return p.establishWith(peerOpen(flowspecFamilies...))
+	}
+	return p.establishWith(peerOpen())
+}
+
+// establishWith runs the OPEN/KEEPALIVE exchange with the OPEN message of the neighbor
+func (p testPeer) establishWith(peerOpen Open) Open {
+	message := p.read()
+	require.Equal(p.t, uint8(MessageTypeOpen), message.Type)
+	open, err := ParseOpen(message.Body)
+	require.NoError(p.t, err)
+
+	p.write(peerOpen.Marshal())
+	require.Equal(p.t, uint8(MessageTypeKeepalive), p.read().Type)
+	p.write(Message{Type: MessageTypeKeepalive})
+
+	// The speaker sends End-of-RIB for the flowspec families both sides support
+	for _, family := range flowspecFamilies {
+		if !peerOpen.supports(family) {
+			continue
+		}
+		message := p.read()
+		require.Equal(p.t, uint8(MessageTypeUpdate), message.Type)
+		update, err := ParseUpdate(message.Body, true)
+		require.NoError(p.t, err)
+		afi, safi, ok := update.EndOfRIB()
+		require.True(p.t, ok)
+		require.Equal(p.t, family, AddressFamily{AFI: afi, SAFI: safi})
+	}
+	return open
+}
+
+func startSession(t *testing.T, session *Session) (testPeer, chan error) {
+	local, remote := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- session.serve(context.Background(), local)
+	}()
+	return testPeer{t: t, conn: remote}, errs
+}
+
+func waitForRoutes(t *testing.T, session *Session, count int) {
+	require.Eventually(t, func() bool {
+		return len(session.Routes()) == count
+	}, time.Second, time.Millisecond)
+}
+
+func TestSessionGracefulRestart(t *testing.T) {
+	session := NewSession(SessionConfig{LocalAS: 65000, RouterID: net.ParseIP("192.0.2.1"), HoldTime: 90 * time.Second, RestartTime: time.Minute})
+
+	peer, errs := startSession(t, session)
+	open := peer.establish(true)
+	assert.Equal(t, uint32(65000), open.AS)
+	assert.True(t, open.supports(AddressFamily{AFI: AFIIPv4, SAFI: SAFIFlowspec}))
+	assert.True(t, open.supports(AddressFamily{AFI: AFIIPv6, SAFI: SAFIFlowspec}))
+	assert.True(t, open.GracefulRestart)
+
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil,
+		attribute(0xc0, attrExtCommunities, []byte{0x80, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}),
+		mpReach(AFIIPv4, flow4NLRI),
+	)})
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv6, flow6NLRI))})
+	waitForRoutes(t, session, 2)
+	assert.Equal(t, uint16(123), session.Routes()[0].MatchAttrs.DestinationPort)
+
+	// Routes of the restarting peer are kept until End-of-RIB
+	peer.conn.Close()
+	require.Error(t, <-errs)
+	assert.Len(t, session.Routes(), 2)
+
+	peer, errs = startSession(t, session)
+	peer.establish(true)
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv4, flow4NLRI))})
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, attribute(0x80, attrMPUnreachNLRI, []byte{0x00, AFIIPv6, SAFIFlowspec}))})
+	waitForRoutes(t, session, 1)
+	assert.False(t, session.Routes()[0].IsIPv6())
+
+	peer.conn.Close()
+	require.Error(t, <-errs)
+}
+
+func TestSessionGracefulRestartFamilies(t *testing.T) {
+	session := NewSession(SessionConfig{LocalAS: 65000, RouterID: net.ParseIP("192.0.2.1"), HoldTime: 90 * time.Second, RestartTime: time.Minute})
+
+	// The capability without address families only signals the restart, no routes are retained
+	peer, errs := startSession(t, session)
+	peer.establishWith(Open{AS: 65000, RouterID: net.ParseIP("192.0.2.2"), Families: flowspecFamilies, ASN4: true, GracefulRestart: true, RestartTime: time.Minute})
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv4, flow4NLRI))})
+	waitForRoutes(t, session, 1)
+	peer.conn.Close()
+	require.Error(t, <-errs)
+	assert.Empty(t, session.Routes())
+
+	// Only routes of the retained address families are kept
+	peer, errs = startSession(t, session)
+	peer.establishWith(peerOpen(AddressFamily{AFI: AFIIPv4, SAFI: SAFIFlowspec}))
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv4, flow4NLRI))})
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv6, flow6NLRI))})
+	waitForRoutes(t, session, 2)
+	peer.conn.Close()
+	require.Error(t, <-errs)
+	require.Len(t, session.Routes(), 1)
+	assert.False(t, session.Routes()[0].IsIPv6())
+}
+
+func TestSessionRepeatedRestart(t *testing.T) {
+	session := NewSession(SessionConfig{LocalAS: 65000, RouterID: net.ParseIP("192.0.2.1"), HoldTime: 90 * time.Second})
+	session.routes["1/00"] = route.FlowspecRoute{}
+	open := peerOpen(flowspecFamilies...)
+	open.RestartTime = 200 * time.Millisecond
+
+	session.down(open)
+	time.Sleep(100 * time.Millisecond)
+	session.established(open)
+	session.down(open)
+
+	// The timer of the first restart would have expired by now
+	time.Sleep(150 * time.Millisecond)
+	assert.Len(t, session.Routes(), 1)
+	waitForRoutes(t, session, 0)
+}
+
+func TestSessionTreatAsWithdraw(t *testing.T) {
+	session := NewSession(SessionConfig{LocalAS: 65000, RouterID: net.ParseIP("192.0.2.1"), HoldTime: 90 * time.Second})
+
+	peer, errs := startSession(t, session)
+	peer.establish(false)
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv4, flow4NLRI))})
+	waitForRoutes(t, session, 1)
+
+	// A malformed MED withdraws the announced route instead of keeping the previous one
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, attribute(0x80, attrMED, []byte{0x00, 0x01}), mpReach(AFIIPv4, flow4NLRI))})
+	waitForRoutes(t, session, 0)
+
+	// Updates that can not be parsed at all reset the session
+	peer.write(Message{Type: MessageTypeUpdate, Body: []byte{0x00, 0x05}})
+	assert.Equal(t, Message{Type: MessageTypeNotification, Body: []byte{notificationUpdateMessageError, updateErrorMalformedAttributeList}}, peer.read())
+	assert.Error(t, <-errs)
+}
+
+func TestSessionWithoutGracefulRestart(t *testing.T) {
+	session := NewSession(SessionConfig{LocalAS: 65000, RouterID: net.ParseIP("192.0.2.1"), HoldTime: 90 * time.Second})
+
+	peer, errs := startSession(t, session)
+	peer.establish(false)
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv4, flow4NLRI))})
+	waitForRoutes(t, session, 1)
+
+	peer.write(NotificationError{Code: notificationCease}.message())
+	assert.Equal(t, NotificationError{Code: notificationCease, Data: []byte{}}, <-errs)
+	assert.Empty(t, session.Routes())
+}
+
+func TestSessionBadPeerAS(t *testing.T) {
+	session := NewSession(SessionConfig{LocalAS: 65001, RouterID: net.ParseIP("192.0.2.1"), HoldTime: 90 * time.Second})
+
+	peer, errs := startSession(t, session)
+	peer.read()
+	peer.write(Open{AS: 65000, RouterID: net.ParseIP("192.0.2.2"), Families: flowspecFamilies}.Marshal())
+
+	notification := peer.read()
+	assert.Equal(t, Message{Type: MessageTypeNotification, Body: []byte{notificationOpenError, openErrorBadPeerAS}}, notification)
+	assert.Error(t, <-errs)
+}
+
+func TestSessionEndOfRIB(t *testing.T) {
+	session := NewSession(SessionConfig{LocalAS: 65000, RouterID: net.ParseIP("192.0.2.1"), HoldTime: 90 * time.Second})
+
+	// Only the families negotiated with the peer get an End-of-RIB marker
+	peer, errs := startSession(t, session)
+	open := peerOpen()
+	open.Families = []AddressFamily{{AFI: AFIIPv4, SAFI: SAFIFlowspec}}
+	peer.establishWith(open)
+	peer.write(Message{Type: MessageTypeUpdate, Body: updateBody(nil, mpReach(AFIIPv4, flow4NLRI))})
+	waitForRoutes(t, session, 1)
+	peer.conn.Close()
+	require.Error(t, <-errs)
+}
@@ -0,0 +1,314 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// Path attribute types
+const (
+	attrOrigin          = 1
+	attrASPath          = 2
+	attrMED             = 4
+	attrLocalPref       = 5
+	attrCommunities     = 8
+	attrOriginatorID    = 9
+	attrClusterList     = 10
+	attrMPReachNLRI     = 14
+	attrMPUnreachNLRI   = 15
+	attrExtCommunities  = 16
+	attrAS4Path         = 17
+	attrLargeCommunity  = 32
+	attrFlagExtendedLen = 0x10
+)
+
+var origins = map[byte]string{0: "IGP", 1: "EGP", 2: "Incomplete"}
+
+// NLRI is a single flowspec NLRI in wire format
+type NLRI struct {
+	AFI  uint16
+	SAFI uint8
+	Data []byte
+}
+
+// Update is a parsed BGP UPDATE message. Only multiprotocol flowspec NLRI are kept.
+type Update struct {
+	// Route carries the path attributes of the update, its match attributes are empty
+	Route     route.FlowspecRoute
+	Announced []NLRI
+	Withdrawn []NLRI
+	// endOfRIB is set to the address family of an End-of-RIB marker (RFC 4724)
+	endOfRIB *NLRI
+}
+
+// EndOfRIB reports whether the update is an End-of-RIB marker and for which address family
+func (u Update) EndOfRIB() (uint16, uint8, bool) {
+	if u.endOfRIB == nil {
+		return 0, 0, false
+	}
+	return u.endOfRIB.AFI, u.endOfRIB.SAFI, true
+}
+
+// endOfRIBMessage returns the End-of-RIB marker of an address family other than IPv4 unicast, an UPDATE message
+// with an empty MP_UNREACH_NLRI attribute (RFC 4724 section 2)
+func endOfRIBMessage(family AddressFamily) Message {
+	return Message{Type: MessageTypeUpdate, Body: []byte{0, 0, 0, 6, 0x80, attrMPUnreachNLRI, 3, byte(family.AFI >> 8), byte(family.AFI), family.SAFI}}
+}
+
+// Routes decodes the announced flowspec NLRI into routes carrying the path attributes of the update
+func (u Update) Routes() ([]route.FlowspecRoute, error) {
+	var routes []route.FlowspecRoute
+	for _, nlri := range u.Announced {
+		flowSpecRoute, err := RouteFromNLRI(nlri.AFI, nlri.Data, u.Route)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, flowSpecRoute)
+	}
+	return routes, nil
+}
+
+// TreatAsWithdrawError reports malformed path attributes of an update (RFC 7606 section 2). The announced
+// NLRI of the update are returned as withdrawn instead, so their previous routes are not enforced any longer.
+type TreatAsWithdrawError struct {
+	Err error
+}
+
+func (e TreatAsWithdrawError) Error() string {
+	return fmt.Sprintf("treat-as-withdraw: %v", e.Err)
+}
+
+func (e TreatAsWithdrawError) Unwrap() error {
+	return e.Err
+}
+
+// ParseUpdate parses the body of a BGP UPDATE message. asn4 reports whether four-octet AS numbers
+// were negotiated for the session (RFC 6793).
+func ParseUpdate(body []byte, asn4 bool) (Update, error) {
+	if len(body) < 4 {
+		return Update{}, errors.New("update message too short")
+	}
+	withdrawnLength := int(binary.BigEndian.Uint16(body[0:2]))
+	if len(body) < 4+withdrawnLength {
+		return Update{}, errors.New("invalid withdrawn routes length")
+	}
+	attributesLength := int(binary.BigEndian.Uint16(body[2+withdrawnLength : 4+withdrawnLength]))
+	attributes := body[4+withdrawnLength:]
+	if len(attributes) < attributesLength {
+		return Update{}, errors.New("invalid path attributes length")
+	}
+
+	return parsePathAttributes(attributes[:attributesLength], asn4, false)
+}
+
+// ParseRIBAttributes parses the path attributes of a MRT TABLE_DUMP_V2 RIB entry (RFC 6396 section 4.3.4).
+// RIB entries always use four-octet AS numbers and carry their NLRI outside of the attributes.
+func ParseRIBAttributes(attributes []byte) (route.FlowspecRoute, error) {
+	update, err := parsePathAttributes(attributes, true, true)
+	return update.Route, err
+}
+
+// parsePathAttributes parses the path attributes of an update. The abbreviated MP_REACH_NLRI attribute
+// of RIB entries is skipped.
+func parsePathAttributes(attributes []byte, asn4 bool, ribEntry bool) (Update, error) {
+	var update Update
+	var as4Path route.ASPath
+	var malformed error
+	for len(attributes) > 0 {
+		if len(attributes) < 3 {
+			return Update{}, errors.New("path attribute too short")
+		}
+		flags, attrType := attributes[0], attributes[1]
+		offset, length := 3, int(attributes[2])
+		if flags&attrFlagExtendedLen != 0 {
+			if len(attributes) < 4 {
+				return Update{}, errors.New("path attribute too short")
+			}
+			offset, length = 4, int(binary.BigEndian.Uint16(attributes[2:4]))
+		}
+		if len(attributes) < offset+length {
+			return Update{}, fmt.Errorf("path attribute %d truncated", attrType)
+		}
+		value := attributes[offset : offset+length]
+		attributes = attributes[offset+length:]
+
+		var err error
+		switch attrType {
+		case attrOrigin:
+			if len(value) != 1 {
+				err = errors.New("invalid origin attribute")
+				break
+			}
+			update.Route.BGPAttrs.Origin = origins[value[0]]
+		case attrASPath:
+			update.Route.BGPAttrs.ASPath, err = parseASPath(value, asn4)
+		case attrAS4Path:
+			as4Path, err = parseASPath(value, true)
+		case attrMED:
+			if len(value) != 4 {
+				err = errors.New("invalid MED attribute")
+				break
+			}
+			update.Route.BGPAttrs.MED = binary.BigEndian.Uint32(value)
+		case attrLocalPref:
+			if len(value) != 4 {
+				err = errors.New("invalid local preference attribute")
+				break
+			}
+			update.Route.BGPAttrs.LocalPref = binary.BigEndian.Uint32(value)
+		case attrCommunities:
+			if len(value)%4 != 0 {
+				err = errors.New("invalid communities attribute")
+				break
+			}
+			for i := 0; i < len(value); i += 4 {
+				update.Route.BGPAttrs.Communities = append(update.Route.BGPAttrs.Communities, route.Community{
+					ASN:   binary.BigEndian.Uint16(value[i : i+2]),
+					Value: binary.BigEndian.Uint16(value[i+2 : i+4]),
+				})
+			}
+		case attrOriginatorID:
+			if len(value) != 4 {
+				err = errors.New("invalid originator ID attribute")
+				break
+			}
+			update.Route.BGPAttrs.OriginatorID = net.IP(value).To16()
+		case attrClusterList:
+			if len(value)%4 != 0 {
+				err = errors.New("invalid cluster list attribute")
+				break
+			}
+			for i := 0; i < len(value); i += 4 {
+				update.Route.BGPAttrs.ClusterList = append(update.Route.BGPAttrs.ClusterList, net.IP(value[i:i+4]).To16())
+			}
+		case attrExtCommunities:
+			if len(value)%8 != 0 {
+				err = errors.New("invalid extended communities attribute")
+				break
+			}
+			for i := 0; i < len(value); i += 8 {
+				update.Route.BGPAttrs.ExtCommunities = append(update.Route.BGPAttrs.ExtCommunities, route.ExtCommunity(binary.BigEndian.Uint64(value[i:i+8])))
+			}
+		case attrLargeCommunity:
+			if len(value)%12 != 0 {
+				err = errors.New("invalid large communities attribute")
+				break
+			}
+			for i := 0; i < len(value); i += 12 {
+				update.Route.BGPAttrs.LargeCommunities = append(update.Route.BGPAttrs.LargeCommunities, route.LargeCommunity{
+					GlobalAdmin: binary.BigEndian.Uint32(value[i : i+4]),
+					LocalData1:  binary.BigEndian.Uint32(value[i+4 : i+8]),
+					LocalData2:  binary.BigEndian.Uint32(value[i+8 : i+12]),
+				})
+			}
+		case attrMPReachNLRI:
+			if !ribEntry {
+				update.Announced, err = parseMPReach(value)
+			}
+		case attrMPUnreachNLRI:
+			var afi uint16
+			var safi uint8
+			afi, safi, update.Withdrawn, err = parseMPUnreach(value)
+			if err == nil && len(value) == 3 {
+				update.endOfRIB = &NLRI{AFI: afi, SAFI: safi}
+			}
+		}
+		if err == nil {
+			continue
+		}
+		// Errors of the NLRI attributes leave the routes of the update unknown, errors of other attributes
+		// only those of the announced routes
+		if attrType == attrMPReachNLRI || attrType == attrMPUnreachNLRI {
+			return Update{}, err
+		}
+		if malformed == nil {
+			malformed = fmt.Errorf("path attribute %d: %v", attrType, err)
+		}
+	}
+
+	if malformed != nil {
+		update.Withdrawn = append(update.Withdrawn, update.Announced...)
+		update.Announced = nil
+		return update, TreatAsWithdrawError{Err: malformed}
+	}
+
+	if !asn4 && as4Path != nil {
+		update.Route.BGPAttrs.ASPath = as4Path
+	}
+
+	if action, argument, err := route.ActionFromExtCommunities(update.Route.BGPAttrs.ExtCommunities); err == nil {
+		update.Route.Action = action
+		update.Route.Argument = argument
+	}
+
+	return update, nil
+}
+
+// parseASPath parses the segments of an AS_PATH attribute
+func parseASPath(value []byte, asn4 bool) (route.ASPath, error) {
+	asnLength := 2
+	if asn4 {
+		asnLength = 4
+	}
+
+	var path route.ASPath
+	for len(value) > 0 {
+		if len(value) < 2 {
+			return nil, errors.New("invalid AS path segment")
+		}
+		segment := route.ASPathSegment{Type: route.ASPathSegmentType(value[0])}
+		if segment.Type < route.ASSet || segment.Type > route.ASConfedSet {
+			return nil, fmt.Errorf("invalid AS path segment type %d", segment.Type)
+		}
+		count := int(value[1])
+		value = value[2:]
+		if len(value) < count*asnLength {
+			return nil, errors.New("AS path segment truncated")
+		}
+		for i := 0; i < count; i++ {
+			if asn4 {
+				segment.ASNs = append(segment.ASNs, binary.BigEndian.Uint32(value[i*4:i*4+4]))
+			} else {
+				segment.ASNs = append(segment.ASNs, uint32(binary.BigEndian.Uint16(value[i*2:i*2+2])))
+			}
+		}
+		path = append(path, segment)
+		value = value[count*asnLength:]
+	}
+	return path, nil
+}
+
+// parseMPReach returns the flowspec NLRI of a MP_REACH_NLRI attribute (RFC 4760)
+func parseMPReach(value []byte) ([]NLRI, error) {
+	if len(value) < 5 {
+		return nil, errors.New("invalid MP_REACH_NLRI attribute")
+	}
+	afi, safi := binary.BigEndian.Uint16(value[0:2]), value[2]
+	nextHopLength := int(value[3])
+	if len(value) < 5+nextHopLength {
+		return nil, errors.New("invalid MP_REACH_NLRI next hop length")
+	}
+	if safi != SAFIFlowspec {
+		return nil, nil
+	}
+
+	return splitFlowspecNLRI(afi, safi, value[5+nextHopLength:])
+}
+
+// parseMPUnreach returns the address family and withdrawn flowspec NLRI of a MP_UNREACH_NLRI attribute
+func parseMPUnreach(value []byte) (uint16, uint8, []NLRI, error) {
+	if len(value) < 3 {
+		return 0, 0, nil, errors.New("invalid MP_UNREACH_NLRI attribute")
+	}
+	afi, safi := binary.BigEndian.Uint16(value[0:2]), value[2]
+	if safi != SAFIFlowspec {
+		return afi, safi, nil, nil
+	}
+
+	nlri, err := splitFlowspecNLRI(afi, safi, value[3:])
+	return afi, safi, nlri, err
+}
@@ -0,0 +1,148 @@
+package bgp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// flow4NLRI matches "flow4 { dst 192.0.2.1/32; proto 17; dport 123; }"
+var flow4NLRI = []byte{0x01, 0x20, 0xc0, 0x00, 0x02, 0x01, 0x03, 0x81, 0x11, 0x05, 0x81, 0x7b}
+
+// flow6NLRI matches "flow6 { dst 2001:db8::/32; src 2001:db8:1::/48; }"
+var flow6NLRI = []byte{0x01, 0x20, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x02, 0x30, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01}
+
+func updateBody(withdrawn []byte, attributes ...[]byte) []byte {
+	var pathAttributes []byte
+	for _, attribute := range attributes {
+		pathAttributes = append(pathAttributes, attribute...)
+	}
+	body := []byte{byte(len(withdrawn) >> 8), byte(len(withdrawn))}
+	body = append(body, withdrawn...)
+	body = append(body, byte(len(pathAttributes)>>8), byte(len(pathAttributes)))
+	return append(body, pathAttributes...)
+}
+
+func attribute(flags byte, attrType byte, value []byte) []byte {
+	return append([]byte{flags, attrType, byte(len(value))}, value...)
+}
+
+func mpReach(afi byte, nlri ...[]byte) []byte {
+	value := []byte{0x00, afi, SAFIFlowspec, 0x00, 0x00}
+	for _, n := range nlri {
+		value = append(value, byte(len(n)))
+		value = append(value, n...)
+	}
+	return attribute(0x80, attrMPReachNLRI, value)
+}
+
+func TestParseUpdate(t *testing.T) {
+	body := updateBody(nil,
+		attribute(0x40, attrOrigin, []byte{0x00}),
+		attribute(0x40, attrASPath, []byte{0x02, 0x02, 0x00, 0x00, 0xfd, 0xea, 0x00, 0x00, 0xfd, 0xe9}),
+		attribute(0x40, attrLocalPref, []byte{0x00, 0x00, 0x00, 0x64}),
+		attribute(0xc0, attrCommunities, []byte{0xff, 0xff, 0x02, 0x9a}),
+		attribute(0xc0, attrExtCommunities, []byte{0x80, 0x06, 0x00, 0x00, 0x4a, 0xc8, 0x00, 0x00}),
+		attribute(0xc0, attrLargeCommunity, []byte{0x00, 0x00, 0xfd, 0xea, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02}),
+		mpReach(AFIIPv4, flow4NLRI),
+	)
+
+	update, err := ParseUpdate(body, true)
+	require.NoError(t, err)
+	_, _, endOfRIB := update.EndOfRIB()
+	assert.False(t, endOfRIB)
+
+	routes, err := update.Routes()
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+
+	_, destination, _ := net.ParseCIDR("192.0.2.1/32")
+	expected := route.FlowspecRoute{Action: route.ActionTrafficRateBytes, Argument: 6553600}
+	expected.MatchAttrs.Destination = *destination
+	expected.MatchAttrs.Protocol = 17
+	expected.MatchAttrs.DestinationPort = 123
+	expected.BGPAttrs.Origin = "IGP"
+	expected.BGPAttrs.ASPath = route.ASPath{{Type: route.ASSequence, ASNs: []uint32{65002, 65001}}}
+	expected.BGPAttrs.LocalPref = 100
+	expected.BGPAttrs.Communities = []route.Community{{ASN: 65535, Value: 666}}
+	expected.BGPAttrs.ExtCommunities = []route.ExtCommunity{0x800600004ac80000}
+	expected.BGPAttrs.LargeCommunities = []route.LargeCommunity{{GlobalAdmin: 65002, LocalData1: 1, LocalData2: 2}}
+	assert.Equal(t, expected, routes[0])
+	assert.Equal(t, uint32(65001), routes[0].OriginAS())
+}
+
+func TestParseUpdateIPv6(t *testing.T) {
+	update, err := ParseUpdate(updateBody(nil, mpReach(AFIIPv6, flow6NLRI)), true)
+	require.NoError(t, err)
+
+	routes, err := update.Routes()
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	assert.Equal(t, "flow6 { dst 2001:db8::/32; src 2001:db8:1::/48; }", routes[0].Net())
+}
+
+func TestParseUpdateWithdrawAndEndOfRIB(t *testing.T) {
+	withdraw := append([]byte{0x00, AFIIPv4, SAFIFlowspec, byte(len(flow4NLRI))}, flow4NLRI...)
+	update, err := ParseUpdate(updateBody(nil, attribute(0x80, attrMPUnreachNLRI, withdraw)), true)
+	require.NoError(t, err)
+	assert.Equal(t, []NLRI{{AFI: AFIIPv4, SAFI: SAFIFlowspec, Data: flow4NLRI}}, update.Withdrawn)
+	_, _, endOfRIB := update.EndOfRIB()
+	assert.False(t, endOfRIB)
+
+	update, err = ParseUpdate(updateBody(nil, attribute(0x80, attrMPUnreachNLRI, []byte{0x00, AFIIPv6, SAFIFlowspec})), true)
+	require.NoError(t, err)
+	afi, safi, endOfRIB := update.EndOfRIB()
+	assert.True(t, endOfRIB)
+	assert.Equal(t, uint16(AFIIPv6), afi)
+	assert.Equal(t, uint8(SAFIFlowspec), safi)
+}
+
+func TestParseUpdateTreatAsWithdraw(t *testing.T) {
+	update, err := ParseUpdate(updateBody(nil, attribute(0x80, attrMED, []byte{0x00, 0x01}), mpReach(AFIIPv4, flow4NLRI)), true)
+	var treatAsWithdraw TreatAsWithdrawError
+	require.ErrorAs(t, err, &treatAsWithdraw)
+	assert.Empty(t, update.Announced)
+	assert.Equal(t, []NLRI{{AFI: AFIIPv4, SAFI: SAFIFlowspec, Data: flow4NLRI}}, update.Withdrawn)
+
+	// Malformed NLRI attributes leave the affected routes unknown
+	_, err = ParseUpdate(updateBody(nil, attribute(0x80, attrMPReachNLRI, []byte{0x00, AFIIPv4})), true)
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &treatAsWithdraw))
+}
+
+func TestParseUpdateTwoOctetASPath(t *testing.T) {
+	update, err := ParseUpdate(updateBody(nil,
+		attribute(0x40, attrASPath, []byte{0x02, 0x02, 0xfd, 0xea, 0x5b, 0xa0}),
+		attribute(0xc0, attrAS4Path, []byte{0x02, 0x02, 0x00, 0x00, 0xfd, 0xea, 0x00, 0x03, 0x0d, 0x40}),
+	), false)
+	require.NoError(t, err)
+	assert.Equal(t, route.ASPath{{Type: route.ASSequence, ASNs: []uint32{65002, 200000}}}, update.Route.BGPAttrs.ASPath)
+}
+
+func TestParseUpdateASSet(t *testing.T) {
+	update, err := ParseUpdate(updateBody(nil,
+		attribute(0x40, attrASPath, []byte{0x02, 0x01, 0x00, 0x00, 0xfd, 0xea, 0x01, 0x02, 0x00, 0x00, 0xfd, 0xeb, 0x00, 0x00, 0xfd, 0xec}),
+	), true)
+	require.NoError(t, err)
+	assert.Equal(t, route.ASPath{
+		{Type: route.ASSequence, ASNs: []uint32{65002}},
+		{Type: route.ASSet, ASNs: []uint32{65003, 65004}},
+	}, update.Route.BGPAttrs.ASPath)
+	// Aggregates ending with an AS set have no single origin
+	assert.Equal(t, uint32(0), update.Route.OriginAS())
+
+	_, err = ParseUpdate(updateBody(nil, attribute(0x40, attrASPath, []byte{0x05, 0x01, 0x00, 0x00, 0xfd, 0xea})), true)
+	var treatAsWithdraw TreatAsWithdrawError
+	assert.ErrorAs(t, err, &treatAsWithdraw)
+}
+
+func TestRouteFromNLRIUnsupported(t *testing.T) {
+	// Destination port range "dport >= 1024 && <= 2048"
+	_, err := RouteFromNLRI(AFIIPv4, []byte{0x05, 0x13, 0x04, 0x00, 0xd5, 0x08, 0x00}, route.FlowspecRoute{})
+	assert.Error(t, err)
+}
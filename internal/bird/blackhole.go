@@ -0,0 +1,100 @@
+package bird
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Community is a standard (ASN:value) or large (global:local1:local2) BGP community
+type Community []uint32
+
+// ParseCommunity parses a standard or large community, e.g. "65535:666" or "65000:666:1"
+func ParseCommunity(input string) (Community, error) {
+	parts := strings.Split(input, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("invalid community %q", input)
+	}
+
+	bitSize := 16
+	if len(parts) == 3 {
+		bitSize = 32
+	}
+	community := make(Community, 0, len(parts))
+	for _, part := range parts {
+		value, err := strconv.ParseUint(part, 10, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid community %q", input)
+		}
+		community = append(community, uint32(value))
+	}
+	return community, nil
+}
+
+// IsLarge reports whether the community is a large community (RFC 8092)
+func (c Community) IsLarge() bool {
+	return len(c) == 3
+}
+
+func (c Community) String() string {
+	parts := make([]string, 0, len(c))
+	for _, value := range c {
+		parts = append(parts, strconv.FormatUint(uint64(value), 10))
+	}
+	return strings.Join(parts, ":")
+}
+
+// condition returns the BIRD filter expression matching routes carrying the community
+func (c Community) condition() string {
+	parts := make([]string, 0, len(c))
+	for _, value := range c {
+		parts = append(parts, strconv.FormatUint(uint64(value), 10))
+	}
+	attribute := "bgp_community"
+	if c.IsLarge() {
+		attribute = "bgp_large_community"
+	}
+	return fmt.Sprintf("(%s) ~ %s", strings.Join(parts, ", "), attribute)
+}
+
+// BlackholeQuery describes which unicast routes are requested from BIRD as remotely triggered blackhole routes
+type BlackholeQuery struct {
+	// Tables to query, the BIRD default tables are used if empty
+	Tables []string
+	// Communities of which routes have to carry at least one
+	Communities []Community
+}
+
+// Validate checks that the query can safely be turned into BIRD commands
+func (q BlackholeQuery) Validate() error {
+	for _, table := range q.Tables {
+		if !symbolPattern.MatchString(table) {
+			return fmt.Errorf("invalid table name %q", table)
+		}
+	}
+	if len(q.Communities) == 0 {
+		return errors.New("at least one community is required")
+	}
+	return nil
+}
+
+// Commands returns the BIRD CLI commands for the best unicast routes carrying one of the communities,
+// one per table
+func (q BlackholeQuery) Commands() []string {
+	conditions := make([]string, 0, len(q.Communities))
+	for _, community := range q.Communities {
+		conditions = append(conditions, community.condition())
+	}
+	condition := fmt.Sprintf("(net.type = NET_IP4 || net.type = NET_IP6) && (%s)", strings.Join(conditions, " || "))
+
+	if len(q.Tables) == 0 {
+		return []string{fmt.Sprintf("show route primary where (%s) all", condition)}
+	}
+
+	commands := make([]string, 0, len(q.Tables))
+	for _, table := range q.Tables {
+		commands = append(commands, fmt.Sprintf("show route primary table %s where (%s) all", table, condition))
+	}
+	return commands
+}
@@ -0,0 +1,49 @@
+package bird
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommunity(t *testing.T) {
+	for _, testCase := range []struct {
+		input       string
+		expected    Community
+		expectedErr bool
+	}{
+		{input: "65535:666", expected: Community{65535, 666}},
+		{input: "4200000000:666:1", expected: Community{4200000000, 666, 1}},
+		{input: "65536:666", expectedErr: true},
+		{input: "666", expectedErr: true},
+		{input: "1:2:3:4", expectedErr: true},
+		{input: "blackhole", expectedErr: true},
+	} {
+		t.Run(testCase.input, func(t *testing.T) {
+			community, err := ParseCommunity(testCase.input)
+			if testCase.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, community)
+			assert.Equal(t, testCase.input, community.String())
+		})
+	}
+}
+
+func TestBlackholeQueryCommands(t *testing.T) {
+	query := BlackholeQuery{Communities: []Community{{65535, 666}, {65000, 666, 1}}}
+	require.NoError(t, query.Validate())
+	assert.Equal(t, []string{
+		"show route primary where ((net.type = NET_IP4 || net.type = NET_IP6) && ((65535, 666) ~ bgp_community || (65000, 666, 1) ~ bgp_large_community)) all",
+	}, query.Commands())
+
+	query.Tables = []string{"master4", "master6"}
+	assert.Len(t, query.Commands(), 2)
+	assert.Contains(t, query.Commands()[1], "show route primary table master6 where")
+
+	assert.Error(t, BlackholeQuery{}.Validate())
+	assert.Error(t, BlackholeQuery{Tables: []string{"master4; show status"}, Communities: query.Communities}.Validate())
+}
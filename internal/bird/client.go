@@ -0,0 +1,85 @@
+package bird
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"bird-flowspec-daemon/internal/metrics"
+)
+
+// Client runs commands on the BIRD CLI socket, one connection per command
+type Client struct {
+	SocketPath string
+}
+
+// Command runs a BIRD CLI command and returns the complete response including reply codes
+func (c Client) Command(ctx context.Context, command string) (string, error) {
+	defer func(start time.Time) {
+		metrics.BirdSocketQueryDurationSeconds.Observe(time.Since(start).Seconds())
+	}(time.Now())
+	slog.Debug("Reading BIRD rules", slog.String("command", command))
+	defer func() {
+		slog.Debug("Finished reading BIRD rules", slog.String("command", command))
+	}()
+
+	// Connect to the Bird socket
+	conn, err := net.Dial("unix", c.SocketPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to bird socket: %v", err)
+	}
+	defer conn.Close()
+
+	// Create a channel to handle the scanner
+	done := make(chan struct{})
+	var response string
+	errChan := make(chan error, 1)
+
+	// Send the command to retrieve all routes
+	_, err = conn.Write([]byte(fmt.Sprintf("%s\n", command)))
+	if err != nil {
+		return "", fmt.Errorf("failed to write to bird socket: %v", err)
+	}
+
+	go func() {
+		reply, err := ReadReply(conn)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		response = reply
+		close(done)
+	}()
+
+	// Wait for either the context to be done or the reading to complete
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("operation canceled: %v", ctx.Err())
+	case err := <-errChan:
+		return "", err
+	case <-done:
+		return response, nil
+	}
+}
+
+// Configure reloads the BIRD configuration and returns an error if BIRD rejected it
+func (c Client) Configure(ctx context.Context) error {
+	response, err := c.Command(ctx, "configure")
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(response, "\n"), "\n")
+	final := lines[len(lines)-1]
+	if !isFinalReply(final) {
+		return fmt.Errorf("unexpected reply to configure: %q", final)
+	}
+	if final[0] == '8' || final[0] == '9' {
+		return fmt.Errorf("BIRD rejected the configuration: %s", strings.TrimSpace(final[5:]))
+	}
+	slog.Info("reconfigured BIRD", slog.String("reply", strings.TrimSpace(final[5:])))
+	return nil
+}
@@ -0,0 +1,66 @@
+package bird
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBird serves a BIRD CLI socket that sends the welcome banner and answers commands from replies.
+// Connections stay open like BIRD does.
+func fakeBird(t *testing.T, replies map[string]string) Client {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("0001 BIRD 2.0.12 ready.\n"))
+				reader := bufio.NewReader(conn)
+				for {
+					command, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					conn.Write([]byte(replies[command[:len(command)-1]]))
+				}
+			}()
+		}
+	}()
+	return Client{SocketPath: path}
+}
+
+func TestClient(t *testing.T) {
+	client := fakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.12\n1011-Router ID is 192.0.2.10\n0013 Daemon is up and running\n",
+		"configure":   "0002-Reading configuration from /etc/bird/bird.conf\n0003 Reconfigured\n",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	response, err := client.Command(ctx, "show status")
+	require.NoError(t, err)
+	version, err := ParseVersion(response)
+	require.NoError(t, err)
+	assert.Equal(t, Version{Major: 2, Minor: 0, Patch: 12}, version)
+
+	assert.NoError(t, client.Configure(ctx))
+
+	failing := fakeBird(t, map[string]string{
+		"configure": "0002-Reading configuration from /etc/bird/bird.conf\n8002 /etc/bird/flowspec4.conf:3:12 syntax error\n",
+	})
+	assert.EqualError(t, failing.Configure(ctx), "BIRD rejected the configuration: /etc/bird/flowspec4.conf:3:12 syntax error")
+}
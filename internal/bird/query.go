@@ -0,0 +1,152 @@
+package bird
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// routeSources contains the BIRD route source constants that may be used in a Query
+var routeSources = map[string]struct{}{
+	"RTS_STATIC":        {},
+	"RTS_INHERIT":       {},
+	"RTS_DEVICE":        {},
+	"RTS_STATIC_DEVICE": {},
+	"RTS_REDIRECT":      {},
+	"RTS_RIP":           {},
+	"RTS_OSPF":          {},
+	"RTS_OSPF_IA":       {},
+	"RTS_OSPF_EXT1":     {},
+	"RTS_OSPF_EXT2":     {},
+	"RTS_BGP":           {},
+	"RTS_PIPE":          {},
+	"RTS_BABEL":         {},
+	"RTS_RPKI":          {},
+	"RTS_L3VPN":         {},
+	"RTS_AGGREGATED":    {},
+}
+
+var symbolPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Query describes which flowspec routes are requested from BIRD
+type Query struct {
+	// Tables to query, the BIRD default table is used if empty
+	Tables []string
+	// Sources are the BIRD route sources (e.g. RTS_BGP, RTS_STATIC) to include
+	Sources []string
+	// Filter is an optional BIRD filter expression that has to match additionally
+	Filter string
+}
+
+// Validate checks that the query can safely be turned into BIRD commands
+func (q Query) Validate() error {
+	for _, table := range q.Tables {
+		if !symbolPattern.MatchString(table) {
+			return fmt.Errorf("invalid table name %q", table)
+		}
+	}
+
+	if len(q.Sources) == 0 {
+		return errors.New("at least one route source is required")
+	}
+	for _, source := range q.Sources {
+		if _, ok := routeSources[source]; !ok {
+			return fmt.Errorf("unknown route source %q", source)
+		}
+	}
+
+	return validateFilter(q.Filter)
+}
+
+// filterToken matches the tokens of the supported subset of BIRD filter expressions: whitespace, strings,
+// numbers, addresses and prefixes, attribute names and operators
+var filterToken = regexp.MustCompile(`^(?:[ \t]+|"[^"\\]*"|[0-9A-Fa-f]*:[0-9A-Fa-f:.]*(?:/[0-9]+[+-]?)?|[0-9][0-9A-Za-z.]*(?:/[0-9]+[+-]?)?|[A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*|&&|\|\||!=|!~|<=|>=|[=<>~!()\[\],*-])`)
+
+// filterKeywords are BIRD keywords that are not part of expressions, e.g. statements or command clauses
+var filterKeywords = map[string]struct{}{
+	"accept": {}, "all": {}, "bt_assert": {}, "case": {}, "define": {}, "else": {}, "error": {},
+	"filter": {}, "function": {}, "if": {}, "include": {}, "print": {}, "printn": {}, "reject": {},
+	"return": {}, "show": {}, "table": {}, "then": {}, "unset": {}, "where": {},
+}
+
+// validateFilter checks that a filter is an expression of the supported subset: comparisons of route
+// attributes with literals, combined with &&, || and !. Statements, blocks and function or method calls
+// (except defined()) are rejected, so the filter can not change the command or routes.
+func validateFilter(filter string) error {
+	depth := 0
+	previous := ""
+	for rest := filter; rest != ""; {
+		token := filterToken.FindString(rest)
+		if token == "" {
+			return fmt.Errorf("filter contains unsupported character %q", rest[0])
+		}
+		rest = rest[len(token):]
+		if strings.TrimSpace(token) == "" {
+			continue
+		}
+
+		for _, part := range strings.Split(token, ".") {
+			if _, ok := filterKeywords[part]; ok {
+				return fmt.Errorf("filter contains unsupported keyword %q", part)
+			}
+		}
+		switch token {
+		case "(":
+			if symbolPattern.MatchString(strings.ReplaceAll(previous, ".", "_")) && previous != "defined" {
+				return fmt.Errorf("filter contains call of %q", previous)
+			}
+			depth++
+		case ")":
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+		previous = token
+	}
+	if depth != 0 {
+		return errors.New("filter contains unbalanced parentheses")
+	}
+
+	return nil
+}
+
+// condition builds the where clause shared by all commands of the query
+func (q Query) condition() string {
+	sources := make([]string, 0, len(q.Sources))
+	for _, source := range q.Sources {
+		sources = append(sources, "source = "+source)
+	}
+
+	condition := fmt.Sprintf("(net.type = NET_FLOW4 || net.type = NET_FLOW6) && (%s)", strings.Join(sources, " || "))
+	if filter := strings.TrimSpace(q.Filter); filter != "" {
+		condition += fmt.Sprintf(" && (%s)", filter)
+	}
+
+	return condition
+}
+
+// Commands returns the BIRD CLI commands for the query, one per table
+func (q Query) Commands() []string {
+	return q.commands("show route")
+}
+
+// FilteredCommands returns the BIRD CLI commands for routes rejected by import filters, one per table.
+// BIRD only keeps these routes for protocols configured with `import keep filtered on`.
+func (q Query) FilteredCommands() []string {
+	return q.commands("show route filtered")
+}
+
+func (q Query) commands(prefix string) []string {
+	if len(q.Tables) == 0 {
+		return []string{fmt.Sprintf("%s where (%s) all", prefix, q.condition())}
+	}
+
+	commands := make([]string, 0, len(q.Tables))
+	for _, table := range q.Tables {
+		commands = append(commands, fmt.Sprintf("%s table %s where (%s) all", prefix, table, q.condition()))
+	}
+
+	return commands
+}
@@ -0,0 +1,119 @@
+package bird
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryValidate(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		query       Query
+		expectedErr bool
+	}{
+		{
+			name:  "default query",
+			query: Query{Sources: []string{"RTS_BGP"}},
+		},
+		{
+			name:  "tables, sources and filter",
+			query: Query{Tables: []string{"flowtab4", "vrf_cust1_flow6"}, Sources: []string{"RTS_BGP", "RTS_STATIC"}, Filter: "bgp_path.first = 65000"},
+		},
+		{
+			name:        "no sources",
+			query:       Query{},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown source",
+			query:       Query{Sources: []string{"RTS_FOO"}},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid table name",
+			query:       Query{Tables: []string{"flowtab4 all; show status"}, Sources: []string{"RTS_BGP"}},
+			expectedErr: true,
+		},
+		{
+			name:        "filter with line break",
+			query:       Query{Sources: []string{"RTS_BGP"}, Filter: "true\nshow status"},
+			expectedErr: true,
+		},
+		{
+			name:        "filter with unbalanced parentheses",
+			query:       Query{Sources: []string{"RTS_BGP"}, Filter: "true) || (true"},
+			expectedErr: true,
+		},
+		{
+			name:  "filter expression",
+			query: Query{Sources: []string{"RTS_BGP"}, Filter: `(bgp_path.first = 65000 || proto = "upstream1") && bgp_community ~ [(65000, 100)] && !(net ~ 2001:db8::/32+) && defined(bgp_med)`},
+		},
+		{
+			name:        "filter with statement",
+			query:       Query{Sources: []string{"RTS_BGP"}, Filter: "true; print net"},
+			expectedErr: true,
+		},
+		{
+			name:        "filter with block",
+			query:       Query{Sources: []string{"RTS_BGP"}, Filter: "{ accept; }"},
+			expectedErr: true,
+		},
+		{
+			name:        "filter with command clause",
+			query:       Query{Sources: []string{"RTS_BGP"}, Filter: "true) all table master4 where (true"},
+			expectedErr: true,
+		},
+		{
+			name:        "filter with method call",
+			query:       Query{Sources: []string{"RTS_BGP"}, Filter: "bgp_community.delete((65000, 100)) = bgp_community"},
+			expectedErr: true,
+		},
+		{
+			name:        "filter with function call",
+			query:       Query{Sources: []string{"RTS_BGP"}, Filter: "is_mitigation()"},
+			expectedErr: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.expectedErr {
+				assert.Error(t, testCase.query.Validate())
+			} else {
+				assert.NoError(t, testCase.query.Validate())
+			}
+		})
+	}
+}
+
+func TestQueryCommands(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{
+			name:     "default query",
+			query:    Query{Sources: []string{"RTS_BGP"}},
+			expected: []string{"show route where ((net.type = NET_FLOW4 || net.type = NET_FLOW6) && (source = RTS_BGP)) all"},
+		},
+		{
+			name:  "one command per table",
+			query: Query{Tables: []string{"flowtab4", "flowtab6"}, Sources: []string{"RTS_BGP", "RTS_STATIC"}, Filter: " bgp_path.first = 65000 "},
+			expected: []string{
+				"show route table flowtab4 where ((net.type = NET_FLOW4 || net.type = NET_FLOW6) && (source = RTS_BGP || source = RTS_STATIC) && (bgp_path.first = 65000)) all",
+				"show route table flowtab6 where ((net.type = NET_FLOW4 || net.type = NET_FLOW6) && (source = RTS_BGP || source = RTS_STATIC) && (bgp_path.first = 65000)) all",
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, testCase.query.Commands())
+		})
+	}
+}
+
+func TestQueryFilteredCommands(t *testing.T) {
+	query := Query{Tables: []string{"flowtab4"}, Sources: []string{"RTS_BGP"}}
+	assert.Equal(t, []string{
+		"show route filtered table flowtab4 where ((net.type = NET_FLOW4 || net.type = NET_FLOW6) && (source = RTS_BGP)) all",
+	}, query.FilteredCommands())
+}
@@ -0,0 +1,40 @@
+package bird
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadReply reads the reply to a BIRD CLI command up to and including its final line, e.g. "0000 " or
+// "0013 Daemon is up and running"
+func ReadReply(reader io.Reader) (string, error) {
+	var reply strings.Builder
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		reply.WriteString(line + "\n")
+		if isFinalReply(line) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading from bird socket: %v", err)
+	}
+	return reply.String(), nil
+}
+
+// isFinalReply reports whether a line is the last line of a reply. Final lines carry a reply code followed
+// by a space, the welcome banner (0001) precedes the reply to the first command.
+func isFinalReply(line string) bool {
+	if len(line) < 5 || line[4] != ' ' || strings.HasPrefix(line, "0001 ") {
+		return false
+	}
+	for _, char := range line[:4] {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package bird
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadReply(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		in       string
+		expected string
+	}{
+		{
+			name:     "show status",
+			in:       "0001 BIRD 2.0.12 ready.\n1000-BIRD 2.0.12\n1011-Router ID is 192.0.2.10\n1011-Current server time is 2025-01-13 10:00:00.000\n0013 Daemon is up and running\n",
+			expected: "0001 BIRD 2.0.12 ready.\n1000-BIRD 2.0.12\n1011-Router ID is 192.0.2.10\n1011-Current server time is 2025-01-13 10:00:00.000\n0013 Daemon is up and running\n",
+		},
+		{
+			name:     "show route",
+			in:       "0001 BIRD 2.0.12 ready.\n1007-flow4 { dst 192.0.2.0/24; }  [upstream1 2025-01-13] * (100)\n1008-\tType: BGP univ\n0000 \n1000-BIRD 2.0.12\n",
+			expected: "0001 BIRD 2.0.12 ready.\n1007-flow4 { dst 192.0.2.0/24; }  [upstream1 2025-01-13] * (100)\n1008-\tType: BGP univ\n0000 \n",
+		},
+		{
+			name:     "error",
+			in:       "0001 BIRD 2.0.12 ready.\n8001 Route not found\n",
+			expected: "0001 BIRD 2.0.12 ready.\n8001 Route not found\n",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			reply, err := ReadReply(strings.NewReader(testCase.in))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, reply)
+		})
+	}
+}
+
+func TestIsFinalReply(t *testing.T) {
+	assert.True(t, isFinalReply("0000 "))
+	assert.True(t, isFinalReply("0013 Daemon is up and running"))
+	assert.True(t, isFinalReply("9001 Permission denied"))
+	assert.False(t, isFinalReply("0001 BIRD 2.0.12 ready."))
+	assert.False(t, isFinalReply("1007-Table master4:"))
+	assert.False(t, isFinalReply(" 	BGP.origin: IGP"))
+}
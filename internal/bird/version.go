@@ -0,0 +1,62 @@
+package bird
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of a running BIRD daemon
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// ParseVersion reads the BIRD version from a CLI reply. It accepts the welcome banner
+// (e.g. "0001 BIRD 2.0.12 ready.") as well as the output of `show status` (e.g. "1000-BIRD 3.0.1").
+func ParseVersion(reply string) (Version, error) {
+	for _, line := range strings.Split(reply, "\n") {
+		if !(strings.HasPrefix(line, "0001 ") || strings.HasPrefix(line, "1000-") || strings.HasPrefix(line, "1000 ")) {
+			continue
+		}
+
+		fields := strings.Fields(line[5:])
+		if len(fields) < 2 || fields[0] != "BIRD" {
+			continue
+		}
+
+		return parseVersionNumber(fields[1])
+	}
+
+	return Version{}, errors.New("no BIRD version found in reply")
+}
+
+// parseVersionNumber parses version strings like "2.0.12", "2.15" or "3.0-alpha2"
+func parseVersionNumber(input string) (Version, error) {
+	// Strip pre-release and build suffixes
+	if index := strings.IndexAny(input, "-+~"); index >= 0 {
+		input = input[:index]
+	}
+
+	parts := strings.Split(input, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid BIRD version %q", input)
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid BIRD version %q: %v", input, err)
+		}
+		numbers[i] = number
+	}
+
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
@@ -0,0 +1,57 @@
+package bird
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		in          string
+		expectedOut Version
+		expectedErr bool
+	}{
+		{
+			name:        "bird2 welcome banner",
+			in:          "0001 BIRD 2.0.12 ready.\n",
+			expectedOut: Version{Major: 2, Minor: 0, Patch: 12},
+		},
+		{
+			name:        "bird3 show status",
+			in:          "0001 BIRD 3.0.1 ready.\n1000-BIRD 3.0.1\n1011-Router ID is 192.0.2.1\n",
+			expectedOut: Version{Major: 3, Minor: 0, Patch: 1},
+		},
+		{
+			name:        "show status without banner",
+			in:          "1000-BIRD 2.15\n1011-Router ID is 192.0.2.1\n",
+			expectedOut: Version{Major: 2, Minor: 15},
+		},
+		{
+			name:        "pre-release version",
+			in:          "0001 BIRD 3.0-alpha2 ready.\n",
+			expectedOut: Version{Major: 3},
+		},
+		{
+			name:        "no version",
+			in:          "0000 \n",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid version",
+			in:          "0001 BIRD two ready.\n",
+			expectedErr: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			out, err := ParseVersion(testCase.in)
+			assert.Equal(t, testCase.expectedOut, out)
+			if testCase.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
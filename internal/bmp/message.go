@@ -0,0 +1,148 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// BMP message types (RFC 7854 section 4.1)
+const (
+	MessageTypeRouteMonitoring = 0
+	MessageTypeStatistics      = 1
+	MessageTypePeerDown        = 2
+	MessageTypePeerUp          = 3
+	MessageTypeInitiation      = 4
+	MessageTypeTermination     = 5
+	MessageTypeRouteMirroring  = 6
+)
+
+// Per-peer header flags (RFC 7854 section 4.2)
+const (
+	peerFlagIPv6       = 0x80
+	peerFlagPostPolicy = 0x40
+	peerFlagASPath2    = 0x20
+)
+
+const (
+	version              = 3
+	commonHeaderLength   = 6
+	perPeerHeaderLength  = 42
+	maxBMPMessageLength  = 1 << 20
+	informationTLVLength = 4
+)
+
+var messageTypeNames = map[uint8]string{
+	MessageTypeRouteMonitoring: "route_monitoring",
+	MessageTypeStatistics:      "statistics",
+	MessageTypePeerDown:        "peer_down",
+	MessageTypePeerUp:          "peer_up",
+	MessageTypeInitiation:      "initiation",
+	MessageTypeTermination:     "termination",
+	MessageTypeRouteMirroring:  "route_mirroring",
+}
+
+// Message is a BMP message without its common header
+type Message struct {
+	Type uint8
+	Body []byte
+}
+
+// PeerHeader is the per-peer header of route monitoring and peer up/down messages
+type PeerHeader struct {
+	Type          uint8
+	Flags         uint8
+	Distinguisher uint64
+	Address       net.IP
+	AS            uint32
+	BGPID         net.IP
+	Timestamp     time.Time
+}
+
+// PostPolicy reports whether the message carries routes after the import policy was applied
+func (h PeerHeader) PostPolicy() bool {
+	return h.Flags&peerFlagPostPolicy != 0
+}
+
+// ASN4 reports whether AS paths of the peer are encoded with four-octet AS numbers
+func (h PeerHeader) ASN4() bool {
+	return h.Flags&peerFlagASPath2 == 0
+}
+
+// key identifies the peer and the RIB view (pre- or post-policy) of a monitored session
+func (h PeerHeader) key() string {
+	return peerKey(h.Distinguisher, h.Address, h.PostPolicy())
+}
+
+func peerKey(distinguisher uint64, address net.IP, postPolicy bool) string {
+	return fmt.Sprintf("%d/%s/%t", distinguisher, address, postPolicy)
+}
+
+// ReadMessage reads one BMP message from r
+func ReadMessage(r io.Reader) (Message, error) {
+	header := make([]byte, commonHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Message{}, err
+	}
+	if header[0] != version {
+		return Message{}, fmt.Errorf("unsupported BMP version %d", header[0])
+	}
+
+	length := int(binary.BigEndian.Uint32(header[1:5]))
+	if length < commonHeaderLength || length > maxBMPMessageLength {
+		return Message{}, fmt.Errorf("invalid BMP message length %d", length)
+	}
+
+	body := make([]byte, length-commonHeaderLength)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Type: header[5], Body: body}, nil
+}
+
+// parsePeerHeader parses the per-peer header at the start of body and returns the remaining bytes
+func parsePeerHeader(body []byte) (PeerHeader, []byte, error) {
+	if len(body) < perPeerHeaderLength {
+		return PeerHeader{}, nil, errors.New("per-peer header truncated")
+	}
+
+	header := PeerHeader{
+		Type:          body[0],
+		Flags:         body[1],
+		Distinguisher: binary.BigEndian.Uint64(body[2:10]),
+		AS:            binary.BigEndian.Uint32(body[26:30]),
+		BGPID:         net.IP(body[30:34]).To16(),
+	}
+	if header.Flags&peerFlagIPv6 != 0 {
+		header.Address = net.IP(body[10:26])
+	} else {
+		header.Address = net.IP(body[22:26]).To16()
+	}
+	if seconds := binary.BigEndian.Uint32(body[34:38]); seconds != 0 {
+		header.Timestamp = time.Unix(int64(seconds), int64(binary.BigEndian.Uint32(body[38:42]))*int64(time.Microsecond))
+	}
+
+	return header, body[perPeerHeaderLength:], nil
+}
+
+// parseInformationTLVs parses the information TLVs of initiation and termination messages
+func parseInformationTLVs(body []byte) (map[uint16]string, error) {
+	tlvs := make(map[uint16]string)
+	for len(body) > 0 {
+		if len(body) < informationTLVLength {
+			return nil, errors.New("information TLV truncated")
+		}
+		tlvType := binary.BigEndian.Uint16(body[0:2])
+		length := int(binary.BigEndian.Uint16(body[2:4]))
+		if len(body) < informationTLVLength+length {
+			return nil, errors.New("information TLV truncated")
+		}
+		tlvs[tlvType] = string(body[informationTLVLength : informationTLVLength+length])
+		body = body[informationTLVLength+length:]
+	}
+	return tlvs, nil
+}
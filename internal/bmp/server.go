@@ -0,0 +1,285 @@
+package bmp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"bird-flowspec-daemon/internal/bgp"
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// Information TLV types of initiation messages (RFC 7854 section 4.4)
+const (
+	informationSysDescr = 1
+	informationSysName  = 2
+)
+
+type peer struct {
+	header PeerHeader
+	routes map[string]route.FlowspecRoute
+}
+
+// Server is a BMP monitoring station that keeps the flowspec routes reported by connected routers
+type Server struct {
+	postPolicy bool
+
+	mu sync.RWMutex
+	// peers are indexed by router connection and peer key
+	peers   map[string]map[string]*peer
+	updates chan struct{}
+}
+
+// NewServer creates a BMP monitoring station. Only routes of the post-policy (Adj-RIB-In after import
+// filters) or the pre-policy view are kept, depending on postPolicy.
+func NewServer(postPolicy bool) *Server {
+	return &Server{
+		postPolicy: postPolicy,
+		peers:      make(map[string]map[string]*peer),
+		updates:    make(chan struct{}, 1),
+	}
+}
+
+// Updates signals changes of the monitored routes
+func (s *Server) Updates() <-chan struct{} {
+	return s.updates
+}
+
+// Routes returns the flowspec routes of all monitored peers in a stable order
+func (s *Server) Routes() []route.FlowspecRoute {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	index := make(map[string]route.FlowspecRoute)
+	for router, peers := range s.peers {
+		for peerKey, p := range peers {
+			for nlriKey, flowSpecRoute := range p.routes {
+				key := router + "|" + peerKey + "|" + nlriKey
+				keys = append(keys, key)
+				index[key] = flowSpecRoute
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	routes := make([]route.FlowspecRoute, 0, len(keys))
+	for _, key := range keys {
+		routes = append(routes, index[key])
+	}
+	return routes
+}
+
+// ListenAndServe accepts BMP sessions of routers on address until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for BMP: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	slog.Info("serving BMP", slog.String("address", listener.Addr().String()))
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept BMP session: %v", err)
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	router := conn.RemoteAddr().String()
+	slog.Info("BMP session established", slog.String("router", router))
+	defer func() {
+		conn.Close()
+		s.removeRouter(router)
+		slog.Info("BMP session closed", slog.String("router", router))
+	}()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		message, err := ReadMessage(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				slog.Warn("error reading BMP message", slog.String("router", router), slog.String("error", err.Error()))
+			}
+			return
+		}
+		if err := s.handleMessage(router, message); err != nil {
+			slog.Warn("error handling BMP message", slog.String("router", router), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (s *Server) handleMessage(router string, message Message) error {
+	messageType, ok := messageTypeNames[message.Type]
+	if !ok {
+		messageType = "unknown"
+	}
+	metrics.BMPMessagesTotal.With(prometheus.Labels{"type": messageType}).Inc()
+
+	switch message.Type {
+	case MessageTypeRouteMonitoring:
+		header, rest, err := parsePeerHeader(message.Body)
+		if err != nil {
+			return err
+		}
+		if header.PostPolicy() != s.postPolicy {
+			return nil
+		}
+		bgpMessage, err := bgp.ParseMessage(rest)
+		if err != nil {
+			return err
+		}
+		if bgpMessage.Type != bgp.MessageTypeUpdate {
+			return fmt.Errorf("unexpected BGP message type %d in route monitoring", bgpMessage.Type)
+		}
+		update, err := bgp.ParseUpdate(bgpMessage.Body, header.ASN4())
+		var treatAsWithdraw bgp.TreatAsWithdrawError
+		if err != nil && !errors.As(err, &treatAsWithdraw) {
+			return err
+		}
+		s.applyUpdate(router, header, update)
+		return err
+	case MessageTypePeerUp:
+		header, rest, err := parsePeerHeader(message.Body)
+		if err != nil {
+			return err
+		}
+		if len(rest) < 20 {
+			return errors.New("peer up notification truncated")
+		}
+		slog.Info("BMP peer up",
+			slog.String("router", router),
+			slog.String("peer", header.Address.String()),
+			slog.Any("as", header.AS),
+			slog.Any("local_port", binary.BigEndian.Uint16(rest[16:18])),
+		)
+		s.resetPeer(router, header)
+	case MessageTypePeerDown:
+		header, rest, err := parsePeerHeader(message.Body)
+		if err != nil {
+			return err
+		}
+		var reason uint8
+		if len(rest) > 0 {
+			reason = rest[0]
+		}
+		slog.Info("BMP peer down", slog.String("router", router), slog.String("peer", header.Address.String()), slog.Any("reason", reason))
+		s.removePeer(router, header)
+	case MessageTypeInitiation:
+		information, err := parseInformationTLVs(message.Body)
+		if err != nil {
+			return err
+		}
+		slog.Info("BMP initiation", slog.String("router", router), slog.String("sys_name", information[informationSysName]), slog.String("sys_descr", information[informationSysDescr]))
+	case MessageTypeTermination:
+		slog.Info("BMP termination", slog.String("router", router))
+	}
+
+	return nil
+}
+
+// applyUpdate applies the announcements and withdrawals of a route monitoring message to the peer RIB
+func (s *Server) applyUpdate(router string, header PeerHeader, update bgp.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.peer(router, header)
+	template := update.Route
+	template.SessionAttrs.SessionName = header.Address.String()
+	template.SessionAttrs.NeighborAddress = header.Address
+	template.SessionAttrs.ImportTime = header.Timestamp
+	err := source.UpdateRIB(p.routes, update.Withdrawn, update.Announced, nlriKey, func(nlri bgp.NLRI) (route.FlowspecRoute, error) {
+		return bgp.RouteFromNLRI(nlri.AFI, nlri.Data, template)
+	})
+	if err != nil {
+		slog.Warn("error decoding flowspec NLRI", slog.String("router", router), slog.String("peer", header.Address.String()), slog.String("error", err.Error()))
+	}
+
+	source.Notify(s.updates)
+}
+
+// peer returns the state of a peer, creating it if required. s.mu must be held.
+func (s *Server) peer(router string, header PeerHeader) *peer {
+	peers, ok := s.peers[router]
+	if !ok {
+		peers = make(map[string]*peer)
+		s.peers[router] = peers
+	}
+	p, ok := peers[header.key()]
+	if !ok {
+		p = &peer{header: header, routes: make(map[string]route.FlowspecRoute)}
+		peers[header.key()] = p
+		metrics.BMPPeers.Set(float64(s.peerCount()))
+	}
+	return p
+}
+
+// peerCount returns the number of monitored peers. Peers reported with both RIB views count once. s.mu must
+// be held.
+func (s *Server) peerCount() int {
+	peers := make(map[string]struct{})
+	for router, routerPeers := range s.peers {
+		for _, p := range routerPeers {
+			peers[fmt.Sprintf("%s|%d/%s", router, p.header.Distinguisher, p.header.Address)] = struct{}{}
+		}
+	}
+	return len(peers)
+}
+
+func (s *Server) resetPeer(router string, header PeerHeader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.peer(router, header)
+	p.header = header
+	p.routes = make(map[string]route.FlowspecRoute)
+	source.Notify(s.updates)
+}
+
+func (s *Server) removePeer(router string, header PeerHeader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A peer down notification applies to both RIB views of the peer
+	for _, postPolicy := range []bool{false, true} {
+		key := peerKey(header.Distinguisher, header.Address, postPolicy)
+		delete(s.peers[router], key)
+	}
+	metrics.BMPPeers.Set(float64(s.peerCount()))
+	source.Notify(s.updates)
+}
+
+func (s *Server) removeRouter(router string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.peers, router)
+	metrics.BMPPeers.Set(float64(s.peerCount()))
+	source.Notify(s.updates)
+}
+
+func nlriKey(nlri bgp.NLRI) string {
+	return fmt.Sprintf("%d/%x", nlri.AFI, nlri.Data)
+}
@@ -0,0 +1,109 @@
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flow4NLRI matches "flow4 { dst 192.0.2.1/32; proto 17; dport 123; }"
+var flow4NLRI = []byte{0x01, 0x20, 0xc0, 0x00, 0x02, 0x01, 0x03, 0x81, 0x11, 0x05, 0x81, 0x7b}
+
+func bmpMessage(messageType uint8, body []byte) []byte {
+	message := make([]byte, commonHeaderLength, commonHeaderLength+len(body))
+	message[0] = version
+	binary.BigEndian.PutUint32(message[1:5], uint32(commonHeaderLength+len(body)))
+	message[5] = messageType
+	return append(message, body...)
+}
+
+func peerHeader(address string, flags uint8) []byte {
+	header := make([]byte, perPeerHeaderLength)
+	header[1] = flags
+	copy(header[10:26], net.ParseIP(address).To16())
+	binary.BigEndian.PutUint32(header[26:30], 65001)
+	copy(header[30:34], net.ParseIP(address).To4())
+	binary.BigEndian.PutUint32(header[34:38], 1736769600)
+	return header
+}
+
+func bgpUpdate(mpAttribute []byte) []byte {
+	extCommunity := []byte{0xc0, 0x10, 0x08, 0x80, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	attributes := append(extCommunity, mpAttribute...)
+
+	body := []byte{0x00, 0x00, byte(len(attributes) >> 8), byte(len(attributes))}
+	body = append(body, attributes...)
+
+	message := bytes.Repeat([]byte{0xff}, 16)
+	message = append(message, byte((19+len(body))>>8), byte(19+len(body)), 0x02)
+	return append(message, body...)
+}
+
+func routeMonitoring(address string, flags uint8, mpAttribute []byte) Message {
+	return Message{Type: MessageTypeRouteMonitoring, Body: append(peerHeader(address, flags), bgpUpdate(mpAttribute)...)}
+}
+
+func TestReadMessage(t *testing.T) {
+	message, err := ReadMessage(bytes.NewReader(bmpMessage(MessageTypeTermination, []byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x00})))
+	require.NoError(t, err)
+	assert.Equal(t, Message{Type: MessageTypeTermination, Body: []byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x00}}, message)
+
+	_, err = ReadMessage(bytes.NewReader([]byte{0x01, 0x00, 0x00, 0x00, 0x06, 0x04}))
+	assert.Error(t, err)
+}
+
+func TestServer(t *testing.T) {
+	announce := append([]byte{0x80, 0x0e, byte(5 + 1 + len(flow4NLRI)), 0x00, 0x01, 0x85, 0x00, 0x00, byte(len(flow4NLRI))}, flow4NLRI...)
+	withdraw := append([]byte{0x80, 0x0f, byte(3 + 1 + len(flow4NLRI)), 0x00, 0x01, 0x85, byte(len(flow4NLRI))}, flow4NLRI...)
+
+	server := NewServer(true)
+
+	// Pre-policy routes are ignored by a post-policy server
+	require.NoError(t, server.handleMessage("router1", routeMonitoring("198.51.100.1", 0, announce)))
+	assert.Empty(t, server.Routes())
+
+	require.NoError(t, server.handleMessage("router1", routeMonitoring("198.51.100.1", peerFlagPostPolicy, announce)))
+	require.NoError(t, server.handleMessage("router1", routeMonitoring("198.51.100.2", peerFlagPostPolicy, announce)))
+	routes := server.Routes()
+	require.Len(t, routes, 2)
+	assert.Equal(t, "flow4 { dst 192.0.2.1/32; proto 17; dport 123; }", routes[0].Net())
+	assert.Equal(t, "198.51.100.1", routes[0].SessionAttrs.SessionName)
+	assert.Equal(t, int64(1736769600), routes[0].SessionAttrs.ImportTime.Unix())
+	assert.Len(t, server.Updates(), 1)
+
+	require.NoError(t, server.handleMessage("router1", routeMonitoring("198.51.100.2", peerFlagPostPolicy, withdraw)))
+	assert.Len(t, server.Routes(), 1)
+
+	peerDown := Message{Type: MessageTypePeerDown, Body: append(peerHeader("198.51.100.1", 0), 0x02)}
+	require.NoError(t, server.handleMessage("router1", peerDown))
+	assert.Empty(t, server.Routes())
+
+	require.NoError(t, server.handleMessage("router2", routeMonitoring("198.51.100.1", peerFlagPostPolicy, announce)))
+	assert.Len(t, server.Routes(), 1)
+	server.removeRouter("router2")
+	assert.Empty(t, server.Routes())
+}
+
+func TestServerPeerCount(t *testing.T) {
+	server := NewServer(true)
+
+	// Both RIB views of a peer count once
+	for _, flags := range []uint8{0, peerFlagPostPolicy} {
+		header, _, err := parsePeerHeader(peerHeader("198.51.100.1", flags))
+		require.NoError(t, err)
+		server.resetPeer("router1", header)
+	}
+	assert.Equal(t, 1, server.peerCount())
+
+	header, _, err := parsePeerHeader(peerHeader("198.51.100.1", peerFlagPostPolicy))
+	require.NoError(t, err)
+	server.resetPeer("router2", header)
+	assert.Equal(t, 2, server.peerCount())
+
+	server.removePeer("router1", header)
+	assert.Equal(t, 1, server.peerCount())
+}
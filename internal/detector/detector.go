@@ -0,0 +1,225 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// Sample is the traffic counted for a destination address since it was added to the accounting set
+type Sample struct {
+	Destination net.IP
+	Packets     uint64
+	Bytes       uint64
+}
+
+// Config configures the thresholds and the mitigation of the detector
+type Config struct {
+	Interval time.Duration
+	// PacketRate and ByteRate are the thresholds per second and destination, 0 disables a threshold
+	PacketRate uint64
+	ByteRate   uint64
+	// HoldDown is the time a mitigation stays installed after the threshold was exceeded the last time
+	HoldDown time.Duration
+	// Action and Rate of mitigations as in static rules, e.g. "drop"
+	Action string
+	Rate   int64
+}
+
+// Originate installs a mitigation elsewhere, e.g. in BIRD, for ttl
+type Originate func(ctx context.Context, rule source.StaticRule, ttl time.Duration) error
+
+// mitigation is an active mitigation of a destination
+type mitigation struct {
+	rule    source.StaticRule
+	expires time.Time
+	// originatedUntil is the expiry of the originated route
+	originatedUntil time.Time
+}
+
+// Detector watches the traffic rates per destination and mitigates destinations exceeding the thresholds.
+// Mitigations are provided as route source or originated via Originate.
+type Detector struct {
+	name      string
+	config    Config
+	read      func() ([]Sample, error)
+	originate Originate
+
+	mu          sync.RWMutex
+	last        map[string]Sample
+	lastTime    time.Time
+	mitigations map[string]*mitigation
+	updates     chan struct{}
+}
+
+// New creates a detector reading the accounting counters with read. Mitigations are installed locally if
+// originate is nil.
+func New(name string, config Config, read func() ([]Sample, error), originate Originate) *Detector {
+	return &Detector{
+		name:        name,
+		config:      config,
+		read:        read,
+		originate:   originate,
+		last:        make(map[string]Sample),
+		mitigations: make(map[string]*mitigation),
+		updates:     make(chan struct{}, 1),
+	}
+}
+
+// Validate checks the thresholds and the mitigation action
+func (c Config) Validate() error {
+	if c.PacketRate == 0 && c.ByteRate == 0 {
+		return fmt.Errorf("at least one threshold is required")
+	}
+	if c.HoldDown <= 0 {
+		return fmt.Errorf("hold-down has to be positive")
+	}
+	_, err := c.rule(net.IPv4zero).Route()
+	return err
+}
+
+// rule returns the mitigation rule for a destination
+func (c Config) rule(destination net.IP) source.StaticRule {
+	bits := 32
+	if destination.To4() == nil {
+		bits = 128
+	}
+	prefix := net.IPNet{IP: destination, Mask: net.CIDRMask(bits, bits)}
+	return source.StaticRule{
+		Name:        "detector " + destination.String(),
+		Destination: prefix.String(),
+		Action:      c.Action,
+		Rate:        c.Rate,
+	}
+}
+
+func (d *Detector) Name() string {
+	return d.name
+}
+
+func (d *Detector) Updates() <-chan struct{} {
+	return d.updates
+}
+
+// Routes returns the locally installed mitigations, none if mitigations are originated
+func (d *Detector) Routes() []route.FlowspecRoute {
+	if d.originate != nil {
+		return nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	keys := make([]string, 0, len(d.mitigations))
+	for key := range d.mitigations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	routes := make([]route.FlowspecRoute, 0, len(keys))
+	for _, key := range keys {
+		flowSpecRoute, err := d.mitigations[key].rule.Route()
+		if err != nil {
+			continue
+		}
+		flowSpecRoute.SessionAttrs.SessionName = d.name
+		routes = append(routes, flowSpecRoute)
+	}
+	return routes
+}
+
+// Run reads the accounting counters once per interval until ctx is done
+func (d *Detector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			samples, err := d.read()
+			if err != nil {
+				slog.Error("error reading accounting counters", slog.String("error", err.Error()))
+				continue
+			}
+			d.update(ctx, now, samples)
+		}
+	}
+}
+
+// update calculates the rates since the previous samples, mitigates destinations exceeding a threshold and
+// removes expired mitigations
+func (d *Detector) update(ctx context.Context, now time.Time, samples []Sample) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	elapsed := now.Sub(d.lastTime).Seconds()
+	current := make(map[string]Sample, len(samples))
+	changed := false
+	for _, sample := range samples {
+		key := sample.Destination.String()
+		current[key] = sample
+
+		previous, ok := d.last[key]
+		if !ok || d.lastTime.IsZero() || elapsed <= 0 {
+			continue
+		}
+		// Counters restart if the element timed out in the meantime
+		packets, bytes := sample.Packets, sample.Bytes
+		if packets >= previous.Packets && bytes >= previous.Bytes {
+			packets -= previous.Packets
+			bytes -= previous.Bytes
+		}
+		packetRate, byteRate := float64(packets)/elapsed, float64(bytes)/elapsed
+		if !d.exceeds(packetRate, byteRate) {
+			continue
+		}
+
+		active, ok := d.mitigations[key]
+		if !ok {
+			slog.Warn("threshold exceeded, mitigating destination", slog.String("destination", key),
+				slog.Float64("packets_per_second", packetRate), slog.Float64("bytes_per_second", byteRate))
+			metrics.DetectorMitigationsTotal.Inc()
+			active = &mitigation{rule: d.config.rule(sample.Destination)}
+			d.mitigations[key] = active
+			changed = true
+		}
+		active.expires = now.Add(d.config.HoldDown)
+
+		// Originated routes are renewed once half of the hold-down passed
+		if d.originate != nil && active.originatedUntil.Sub(now) < d.config.HoldDown/2 {
+			if err := d.originate(ctx, active.rule, d.config.HoldDown); err != nil {
+				slog.Error("error originating mitigation", slog.String("destination", key), slog.String("error", err.Error()))
+			} else {
+				active.originatedUntil = now.Add(d.config.HoldDown)
+			}
+		}
+	}
+	d.last = current
+	d.lastTime = now
+
+	for key, active := range d.mitigations {
+		if !now.Before(active.expires) {
+			slog.Info("mitigation expired", slog.String("destination", key))
+			delete(d.mitigations, key)
+			changed = true
+		}
+	}
+	metrics.DetectorMitigations.Set(float64(len(d.mitigations)))
+
+	if changed && d.originate == nil {
+		source.Notify(d.updates)
+	}
+}
+
+func (d *Detector) exceeds(packetRate, byteRate float64) bool {
+	return (d.config.PacketRate > 0 && packetRate > float64(d.config.PacketRate)) ||
+		(d.config.ByteRate > 0 && byteRate > float64(d.config.ByteRate))
+}
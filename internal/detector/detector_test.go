@@ -0,0 +1,105 @@
+package detector
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/source"
+)
+
+func sample(destination string, packets, bytes uint64) Sample {
+	return Sample{Destination: net.ParseIP(destination), Packets: packets, Bytes: bytes}
+}
+
+func TestConfigValidate(t *testing.T) {
+	type testCase struct {
+		name   string
+		config Config
+		err    string
+	}
+
+	testCases := []testCase{
+		{name: "valid", config: Config{PacketRate: 1000, HoldDown: time.Minute, Action: "drop"}},
+		{name: "no threshold", config: Config{HoldDown: time.Minute, Action: "drop"}, err: "at least one threshold is required"},
+		{name: "no hold-down", config: Config{ByteRate: 1000, Action: "drop"}, err: "hold-down has to be positive"},
+		{name: "missing rate", config: Config{ByteRate: 1000, HoldDown: time.Minute, Action: "rate-limit-bytes"}, err: "action rate-limit-bytes requires a positive rate"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDetectorLocal(t *testing.T) {
+	config := Config{Interval: time.Second, PacketRate: 100, HoldDown: 10 * time.Second, Action: "drop"}
+	detector := New("detector", config, nil, nil)
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+
+	detector.update(ctx, start, []Sample{sample("192.0.2.1", 0, 0), sample("2001:db8::1", 0, 0)})
+	assert.Empty(t, detector.Routes())
+
+	// 200 packets per second to 2001:db8::1 exceed the threshold
+	detector.update(ctx, start.Add(time.Second), []Sample{sample("192.0.2.1", 50, 5000), sample("2001:db8::1", 200, 20000)})
+	<-detector.Updates()
+	routes := detector.Routes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, "flow6 { dst 2001:db8::1/128; }", routes[0].Net())
+	assert.Equal(t, "detector", routes[0].SessionAttrs.SessionName)
+
+	// The mitigation is held down after the traffic stopped
+	detector.update(ctx, start.Add(5*time.Second), []Sample{sample("2001:db8::1", 200, 20000)})
+	assert.Len(t, detector.Routes(), 1)
+
+	// A counter reset after the element timed out counts as new traffic
+	detector.update(ctx, start.Add(6*time.Second), []Sample{sample("2001:db8::1", 150, 15000)})
+	assert.Len(t, detector.Routes(), 1)
+
+	// and extends the hold-down
+	detector.update(ctx, start.Add(15*time.Second), nil)
+	assert.Len(t, detector.Routes(), 1)
+
+	detector.update(ctx, start.Add(16*time.Second), nil)
+	<-detector.Updates()
+	assert.Empty(t, detector.Routes())
+}
+
+func TestDetectorOriginate(t *testing.T) {
+	type origination struct {
+		rule source.StaticRule
+		ttl  time.Duration
+	}
+	var originated []origination
+	originate := func(_ context.Context, rule source.StaticRule, ttl time.Duration) error {
+		originated = append(originated, origination{rule, ttl})
+		return nil
+	}
+
+	config := Config{Interval: time.Second, ByteRate: 1000, HoldDown: 10 * time.Second, Action: "rate-limit-bytes", Rate: 500}
+	detector := New("detector", config, nil, originate)
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+
+	for i := range 8 {
+		detector.update(ctx, start.Add(time.Duration(i)*time.Second), []Sample{sample("192.0.2.1", uint64(i), uint64(i)*2000)})
+	}
+
+	// Originated at the first detection and renewed once less than half of the hold-down remained
+	require.Len(t, originated, 2)
+	expected := source.StaticRule{Name: "detector 192.0.2.1", Destination: "192.0.2.1/32", Action: "rate-limit-bytes", Rate: 500}
+	assert.Equal(t, origination{expected, 10 * time.Second}, originated[0])
+	assert.Equal(t, origination{expected, 10 * time.Second}, originated[1])
+	assert.Empty(t, detector.Routes())
+}
@@ -0,0 +1,159 @@
+package exabgp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"bird-flowspec-daemon/internal/flowspec"
+)
+
+// componentTypes maps the ExaBGP flow match names to flowspec component types
+var componentTypes = map[string]uint8{
+	"destination":      flowspec.TypeDestinationPrefix,
+	"destination-ipv4": flowspec.TypeDestinationPrefix,
+	"destination-ipv6": flowspec.TypeDestinationPrefix,
+	"source":           flowspec.TypeSourcePrefix,
+	"source-ipv4":      flowspec.TypeSourcePrefix,
+	"source-ipv6":      flowspec.TypeSourcePrefix,
+	"protocol":         flowspec.TypeIPProtocol,
+	"next-header":      flowspec.TypeIPProtocol,
+	"port":             flowspec.TypePort,
+	"destination-port": flowspec.TypeDestinationPort,
+	"source-port":      flowspec.TypeSourcePort,
+	"icmp-type":        flowspec.TypeICMPType,
+	"icmp-code":        flowspec.TypeICMPCode,
+	"tcp-flags":        flowspec.TypeTCPFlags,
+	"packet-length":    flowspec.TypePacketLength,
+	"dscp":             flowspec.TypeDSCP,
+	"traffic-class":    flowspec.TypeDSCP,
+	"fragment":         flowspec.TypeFragment,
+	"flow-label":       flowspec.TypeFlowLabel,
+}
+
+// valueNames are the symbolic values ExaBGP prints for protocols, TCP flags and fragment flags
+var valueNames = map[uint8]map[string]uint64{
+	flowspec.TypeIPProtocol: {
+		"icmp": 1, "igmp": 2, "tcp": 6, "egp": 8, "udp": 17, "rsvp": 46, "gre": 47, "esp": 50, "ah": 51,
+		"ospf": 89, "ipip": 94, "pim": 103, "sctp": 132,
+	},
+	flowspec.TypeTCPFlags: {
+		"fin": 0x01, "syn": 0x02, "rst": 0x04, "push": 0x08, "ack": 0x10, "urgent": 0x20, "ece": 0x40, "cwr": 0x80,
+	},
+	flowspec.TypeFragment: {
+		"dont-fragment": 0x01, "is-fragment": 0x02, "first-fragment": 0x04, "last-fragment": 0x08,
+	},
+}
+
+// parseComponent parses the values of an ExaBGP flow match into a flowspec component. Values are
+// OR-ed terms, each term may combine several operations with "&".
+func parseComponent(name string, values []string) (flowspec.Component, error) {
+	componentType, ok := componentTypes[name]
+	if !ok {
+		return flowspec.Component{}, fmt.Errorf("unsupported flow match %q", name)
+	}
+	component := flowspec.Component{Type: componentType}
+
+	if component.IsPrefix() {
+		if len(values) != 1 {
+			return flowspec.Component{}, fmt.Errorf("%s: expected a single prefix", name)
+		}
+		prefix, offset, err := parsePrefix(values[0])
+		if err != nil {
+			return flowspec.Component{}, fmt.Errorf("%s: %v", name, err)
+		}
+		component.Prefix, component.Offset = prefix, offset
+		return component, nil
+	}
+
+	for _, value := range values {
+		for i, term := range strings.Split(value, "&") {
+			operator, err := parseOperator(componentType, term)
+			if err != nil {
+				return flowspec.Component{}, fmt.Errorf("%s: %v", name, err)
+			}
+			operator.And = i > 0
+			component.Operators = append(component.Operators, operator)
+		}
+	}
+	if len(component.Operators) == 0 {
+		return flowspec.Component{}, fmt.Errorf("%s: no values", name)
+	}
+	return component, nil
+}
+
+// parsePrefix parses a prefix, IPv6 prefixes may carry an offset, e.g. "2001:db8::/32/0"
+func parsePrefix(value string) (net.IPNet, uint8, error) {
+	var offset uint64
+	if strings.Count(value, "/") == 2 {
+		index := strings.LastIndex(value, "/")
+		var err error
+		offset, err = strconv.ParseUint(value[index+1:], 10, 8)
+		if err != nil {
+			return net.IPNet{}, 0, fmt.Errorf("invalid prefix offset %q", value)
+		}
+		value = value[:index]
+	}
+
+	ip, prefix, err := net.ParseCIDR(value)
+	if err != nil {
+		return net.IPNet{}, 0, err
+	}
+	if ip.To4() != nil {
+		prefix.IP = prefix.IP.To4()
+	}
+	return *prefix, uint8(offset), nil
+}
+
+// parseOperator parses a single operation like "=17", ">=1024", "!=80", "=udp" or "syn"
+func parseOperator(componentType uint8, term string) (flowspec.Operator, error) {
+	term = strings.TrimSpace(term)
+	var operator flowspec.Operator
+	prefixLength := len(term) - len(strings.TrimLeft(term, "=<>!"))
+	symbol, value := term[:prefixLength], term[prefixLength:]
+
+	if componentType == flowspec.TypeTCPFlags || componentType == flowspec.TypeFragment {
+		switch symbol {
+		case "":
+		case "=":
+			operator.Match = true
+		case "!":
+			operator.Not = true
+		case "!=":
+			operator.Not, operator.Match = true, true
+		default:
+			return flowspec.Operator{}, fmt.Errorf("invalid bitmask operator %q", term)
+		}
+	} else {
+		switch symbol {
+		case "=":
+			operator.Equal = true
+		case ">":
+			operator.Greater = true
+		case ">=":
+			operator.Greater, operator.Equal = true, true
+		case "<":
+			operator.Less = true
+		case "<=":
+			operator.Less, operator.Equal = true, true
+		case "!=":
+			operator.Less, operator.Greater = true, true
+		case "":
+			operator.Equal = true
+		default:
+			return flowspec.Operator{}, fmt.Errorf("invalid numeric operator %q", term)
+		}
+	}
+
+	if named, ok := valueNames[componentType][strings.ToLower(value)]; ok {
+		operator.Value = named
+		return operator, nil
+	}
+	number, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return flowspec.Operator{}, fmt.Errorf("invalid value %q", term)
+	}
+	operator.Value = number
+	return operator, nil
+}
@@ -0,0 +1,371 @@
+package exabgp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bird-flowspec-daemon/internal/flowspec"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// maxMessageSize limits the length of a single JSON message line
+const maxMessageSize = 16 * 1024 * 1024
+
+var origins = map[string]string{"igp": "IGP", "egp": "EGP", "incomplete": "Incomplete"}
+
+// message is a JSON message of the ExaBGP API (encoder json)
+type message struct {
+	Type         string  `json:"type"`
+	Time         float64 `json:"time"`
+	Notification string  `json:"notification"`
+	Neighbor     struct {
+		Address struct {
+			Peer string `json:"peer"`
+		} `json:"address"`
+		State   string `json:"state"`
+		Message struct {
+			Update *update `json:"update"`
+		} `json:"message"`
+	} `json:"neighbor"`
+}
+
+type update struct {
+	Attribute attributes `json:"attribute"`
+	// Announce is indexed by family (e.g. "ipv4 flow") and next hop
+	Announce map[string]map[string][]map[string]json.RawMessage `json:"announce"`
+	// Withdraw is indexed by family
+	Withdraw map[string][]map[string]json.RawMessage `json:"withdraw"`
+}
+
+type attributes struct {
+	Origin            string            `json:"origin"`
+	ASPath            json.RawMessage   `json:"as-path"`
+	LocalPreference   uint32            `json:"local-preference"`
+	MED               uint32            `json:"med"`
+	Community         [][]uint16        `json:"community"`
+	LargeCommunity    [][]uint32        `json:"large-community"`
+	ExtendedCommunity []json.RawMessage `json:"extended-community"`
+	OriginatorID      string            `json:"originator-id"`
+	ClusterList       []string          `json:"cluster-list"`
+}
+
+// Process receives flowspec routes as ExaBGP API process and keeps the routes of all neighbors
+type Process struct {
+	mu sync.RWMutex
+	// routes are indexed by neighbor and flow key
+	routes  map[string]map[string]route.FlowspecRoute
+	updates chan struct{}
+}
+
+// NewProcess creates an API process with an empty RIB
+func NewProcess() *Process {
+	return &Process{
+		routes:  make(map[string]map[string]route.FlowspecRoute),
+		updates: make(chan struct{}, 1),
+	}
+}
+
+// Updates signals changes of the received routes
+func (p *Process) Updates() <-chan struct{} {
+	return p.updates
+}
+
+// Routes returns the flowspec routes of all neighbors in a stable order
+func (p *Process) Routes() []route.FlowspecRoute {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var keys []string
+	index := make(map[string]route.FlowspecRoute)
+	for neighbor, routes := range p.routes {
+		for flowKey, flowSpecRoute := range routes {
+			key := neighbor + "|" + flowKey
+			keys = append(keys, key)
+			index[key] = flowSpecRoute
+		}
+	}
+	sort.Strings(keys)
+
+	routes := make([]route.FlowspecRoute, 0, len(keys))
+	for _, key := range keys {
+		routes = append(routes, index[key])
+	}
+	return routes
+}
+
+// Run reads the JSON messages ExaBGP writes to the API process, one per line, until input is closed
+func (p *Process) Run(ctx context.Context, input io.Reader) error {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		line := strings.TrimSpace(scanner.Text())
+		// Plain text replies like "done" acknowledge commands and are not of interest
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		if err := p.handleMessage([]byte(line)); err != nil {
+			slog.Warn("error handling ExaBGP message", slog.String("error", err.Error()))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ExaBGP messages: %v", err)
+	}
+	return errors.New("ExaBGP closed the API pipe")
+}
+
+func (p *Process) handleMessage(data []byte) error {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("invalid JSON message: %v", err)
+	}
+	neighbor := msg.Neighbor.Address.Peer
+
+	switch msg.Type {
+	case "state":
+		slog.Info("ExaBGP neighbor state", slog.String("neighbor", neighbor), slog.String("state", msg.Neighbor.State))
+		if msg.Neighbor.State == "down" {
+			p.removeNeighbor(neighbor)
+		}
+	case "notification":
+		if msg.Notification == "shutdown" {
+			p.removeNeighbor("")
+		}
+	case "update":
+		if msg.Neighbor.Message.Update != nil {
+			return p.applyUpdate(neighbor, msg.Time, *msg.Neighbor.Message.Update)
+		}
+	}
+	return nil
+}
+
+// applyUpdate applies the flow announcements and withdrawals of an update message to the RIB
+func (p *Process) applyUpdate(neighbor string, timestamp float64, u update) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer source.Notify(p.updates)
+
+	routes, ok := p.routes[neighbor]
+	if !ok {
+		routes = make(map[string]route.FlowspecRoute)
+		p.routes[neighbor] = routes
+	}
+
+	var withdrawn, announced []flowRule
+	for family, rules := range u.Withdraw {
+		if ipv6, ok := flowFamily(family); ok {
+			for _, rule := range rules {
+				withdrawn = append(withdrawn, flowRule{ipv6: ipv6, rule: rule})
+			}
+		}
+	}
+	for family, nextHops := range u.Announce {
+		if ipv6, ok := flowFamily(family); ok {
+			for _, rules := range nextHops {
+				for _, rule := range rules {
+					announced = append(announced, flowRule{ipv6: ipv6, rule: rule})
+				}
+			}
+		}
+	}
+
+	template := u.Attribute.route()
+	template.SessionAttrs.SessionName = neighbor
+	template.SessionAttrs.NeighborAddress = net.ParseIP(neighbor)
+	seconds, fraction := math.Modf(timestamp)
+	template.SessionAttrs.ImportTime = time.Unix(int64(seconds), int64(fraction*1e9))
+	return source.UpdateRIB(routes, withdrawn, announced, flowRule.key, func(f flowRule) (route.FlowspecRoute, error) {
+		return parseFlow(f.ipv6, f.rule, template)
+	})
+}
+
+// flowRule is a flow rule of an ExaBGP update with the address family it was received in
+type flowRule struct {
+	ipv6 bool
+	rule map[string]json.RawMessage
+}
+
+func (f flowRule) key() string {
+	return flowKey(f.ipv6, f.rule)
+}
+
+// removeNeighbor removes the routes of a neighbor, or of all neighbors if neighbor is empty
+func (p *Process) removeNeighbor(neighbor string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if neighbor == "" {
+		p.routes = make(map[string]map[string]route.FlowspecRoute)
+	} else {
+		delete(p.routes, neighbor)
+	}
+	source.Notify(p.updates)
+}
+
+// flowFamily reports whether an ExaBGP family is a flowspec family and whether it is IPv6
+func flowFamily(family string) (bool, bool) {
+	switch family {
+	case "ipv4 flow":
+		return false, true
+	case "ipv6 flow":
+		return true, true
+	}
+	return false, false
+}
+
+// flowKey identifies a flow rule by its match values, independent of the order of fields
+func flowKey(ipv6 bool, rule map[string]json.RawMessage) string {
+	matches := make(map[string]json.RawMessage, len(rule))
+	for name, value := range rule {
+		if name != "string" {
+			matches[name] = value
+		}
+	}
+	data, _ := json.Marshal(matches)
+	return fmt.Sprintf("%t/%s", ipv6, data)
+}
+
+// parseFlow converts the match values of a flow rule into a route based on template
+func parseFlow(ipv6 bool, rule map[string]json.RawMessage, template route.FlowspecRoute) (route.FlowspecRoute, error) {
+	nlri := flowspec.NLRI{IPv6: ipv6}
+	for name, raw := range rule {
+		if name == "string" {
+			continue
+		}
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return route.FlowspecRoute{}, fmt.Errorf("invalid value of %s: %s", name, raw)
+			}
+			values = []string{value}
+		}
+		component, err := parseComponent(name, values)
+		if err != nil {
+			return route.FlowspecRoute{}, err
+		}
+		nlri.Components = append(nlri.Components, component)
+	}
+	return nlri.Route(template)
+}
+
+// route converts the path attributes into a route without match attributes
+func (a attributes) route() route.FlowspecRoute {
+	var flowSpecRoute route.FlowspecRoute
+	flowSpecRoute.BGPAttrs.Origin = origins[a.Origin]
+	flowSpecRoute.BGPAttrs.ASPath = parseASPath(a.ASPath)
+	flowSpecRoute.BGPAttrs.LocalPref = a.LocalPreference
+	flowSpecRoute.BGPAttrs.MED = a.MED
+	for _, community := range a.Community {
+		if len(community) == 2 {
+			flowSpecRoute.BGPAttrs.Communities = append(flowSpecRoute.BGPAttrs.Communities, route.Community{ASN: community[0], Value: community[1]})
+		}
+	}
+	for _, community := range a.LargeCommunity {
+		if len(community) == 3 {
+			flowSpecRoute.BGPAttrs.LargeCommunities = append(flowSpecRoute.BGPAttrs.LargeCommunities, route.LargeCommunity{GlobalAdmin: community[0], LocalData1: community[1], LocalData2: community[2]})
+		}
+	}
+	for _, raw := range a.ExtendedCommunity {
+		// Only communities with their numeric value (ExaBGP 4 and later) are supported
+		var community struct {
+			Value *uint64 `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &community); err == nil && community.Value != nil {
+			flowSpecRoute.BGPAttrs.ExtCommunities = append(flowSpecRoute.BGPAttrs.ExtCommunities, route.ExtCommunity(*community.Value))
+		}
+	}
+	flowSpecRoute.BGPAttrs.OriginatorID = net.ParseIP(a.OriginatorID)
+	for _, clusterID := range a.ClusterList {
+		flowSpecRoute.BGPAttrs.ClusterList = append(flowSpecRoute.BGPAttrs.ClusterList, net.ParseIP(clusterID))
+	}
+
+	if action, argument, err := route.ActionFromExtCommunities(flowSpecRoute.BGPAttrs.ExtCommunities); err == nil {
+		flowSpecRoute.Action = action
+		flowSpecRoute.Argument = argument
+	}
+	return flowSpecRoute
+}
+
+// exabgpSegmentTypes are the AS path segment types by the element names of ExaBGP
+var exabgpSegmentTypes = map[string]route.ASPathSegmentType{
+	"as-sequence":     route.ASSequence,
+	"as-set":          route.ASSet,
+	"confed-sequence": route.ASConfedSequence,
+	"confed-set":      route.ASConfedSet,
+}
+
+// parseASPath parses an AS path, which ExaBGP prints as list of AS numbers with nested lists for AS sets or
+// as object of numbered segments, depending on the version
+func parseASPath(raw json.RawMessage) route.ASPath {
+	var path any
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	if len(raw) == 0 || decoder.Decode(&path) != nil {
+		return nil
+	}
+
+	var asPath route.ASPath
+	switch v := path.(type) {
+	case []any:
+		for _, element := range v {
+			if set, ok := element.([]any); ok {
+				asPath = append(asPath, route.ASPathSegment{Type: route.ASSet, ASNs: parseASNs(set)})
+				continue
+			}
+			if len(asPath) == 0 || asPath[len(asPath)-1].Type != route.ASSequence {
+				asPath = append(asPath, route.ASPathSegment{Type: route.ASSequence})
+			}
+			asPath[len(asPath)-1].ASNs = append(asPath[len(asPath)-1].ASNs, parseASNs([]any{element})...)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, _ := strconv.Atoi(keys[i])
+			b, _ := strconv.Atoi(keys[j])
+			return a < b
+		})
+		for _, key := range keys {
+			segment, _ := v[key].(map[string]any)
+			element, _ := segment["element"].(string)
+			asns, _ := segment["value"].([]any)
+			segmentType, ok := exabgpSegmentTypes[element]
+			if !ok {
+				continue
+			}
+			asPath = append(asPath, route.ASPathSegment{Type: segmentType, ASNs: parseASNs(asns)})
+		}
+	}
+	return asPath
+}
+
+// parseASNs returns the valid AS numbers of a list
+func parseASNs(values []any) []uint32 {
+	var asns []uint32
+	for _, value := range values {
+		if number, ok := value.(json.Number); ok {
+			if asn, err := strconv.ParseUint(number.String(), 10, 32); err == nil {
+				asns = append(asns, uint32(asn))
+			}
+		}
+	}
+	return asns
+}
@@ -0,0 +1,114 @@
+package exabgp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/flowspec"
+	"bird-flowspec-daemon/internal/route"
+)
+
+const announce = `{ "exabgp": "4.0.1", "time": 1736762400.5, "host" : "edge1", "pid" : 42, "ppid" : 1, "counter": 1, "type": "update", "neighbor": { "address": { "local": "192.0.2.10", "peer": "192.0.2.1" }, "asn": { "local": 65000, "peer": 65000 } , "direction": "receive", "message": { "update": { "attribute": { "origin": "igp", "as-path": [ 65001, [ 65002, 65003 ] ], "local-preference": 100, "community": [ [ 65535, 666 ] ], "extended-community": [ { "value": 9225060886715039744, "string": "rate-limit:0" } ] }, "announce": { "ipv4 flow": { "no-nexthop": [ { "destination-ipv4": [ "192.0.2.1/32" ], "protocol": [ "=udp" ], "destination-port": [ "=123" ], "string": "flow destination-ipv4 192.0.2.1/32 protocol =udp destination-port =123" } ] }, "ipv6 flow": { "no-nexthop": [ { "destination-ipv6": [ "2001:db8::/32/0" ], "next-header": [ "=tcp" ], "string": "flow destination-ipv6 2001:db8::/32/0 next-header =tcp" } ] } } } } } }`
+
+const withdraw = `{ "exabgp": "4.0.1", "time": 1736762460.0, "type": "update", "neighbor": { "address": { "local": "192.0.2.10", "peer": "192.0.2.1" }, "direction": "receive", "message": { "update": { "withdraw": { "ipv4 flow": [ { "protocol": [ "=udp" ], "destination-port": [ "=123" ], "destination-ipv4": [ "192.0.2.1/32" ], "string": "flow destination-ipv4 192.0.2.1/32 protocol =udp destination-port =123" } ] } } } } }`
+
+const down = `{ "exabgp": "4.0.1", "time": 1736762520.0, "type": "state", "neighbor": { "address": { "local": "192.0.2.10", "peer": "192.0.2.1" }, "state": "down", "reason": "peer reset" } }`
+
+func TestProcess(t *testing.T) {
+	process := NewProcess()
+
+	require.NoError(t, process.handleMessage([]byte(announce)))
+	routes := process.Routes()
+	require.Len(t, routes, 2)
+
+	var nets []string
+	for _, flowSpecRoute := range routes {
+		nets = append(nets, flowSpecRoute.Net())
+	}
+	assert.ElementsMatch(t, []string{"flow4 { dst 192.0.2.1/32; proto 17; dport 123; }", "flow6 { dst 2001:db8::/32; next header 6; }"}, nets)
+
+	flowSpecRoute := routes[0]
+	assert.Equal(t, "192.0.2.1", flowSpecRoute.SessionAttrs.SessionName)
+	assert.Equal(t, time.Unix(1736762400, 500000000), flowSpecRoute.SessionAttrs.ImportTime)
+	assert.Equal(t, route.ASPath{
+		{Type: route.ASSequence, ASNs: []uint32{65001}},
+		{Type: route.ASSet, ASNs: []uint32{65002, 65003}},
+	}, flowSpecRoute.BGPAttrs.ASPath)
+	assert.Equal(t, uint32(0), flowSpecRoute.OriginAS())
+	assert.Equal(t, []route.Community{{ASN: 65535, Value: 666}}, flowSpecRoute.BGPAttrs.Communities)
+	assert.Equal(t, int64(route.ActionTrafficRateBytes), flowSpecRoute.Action)
+	assert.Equal(t, int64(0), flowSpecRoute.Argument)
+
+	// Withdrawals match independent of the order of the match fields
+	require.NoError(t, process.handleMessage([]byte(withdraw)))
+	routes = process.Routes()
+	require.Len(t, routes, 1)
+	assert.True(t, routes[0].IsIPv6())
+
+	err := process.Run(context.Background(), strings.NewReader("done\n"+down+"\n"))
+	assert.EqualError(t, err, "ExaBGP closed the API pipe")
+	assert.Empty(t, process.Routes())
+}
+
+func TestParseComponent(t *testing.T) {
+	type testCase struct {
+		name     string
+		values   []string
+		expected flowspec.Component
+	}
+
+	testCases := []testCase{
+		{
+			name:   "destination-port",
+			values: []string{">=1024&<=2048", "=8080"},
+			expected: flowspec.Component{Type: flowspec.TypeDestinationPort, Operators: []flowspec.Operator{
+				{Greater: true, Equal: true, Value: 1024},
+				{And: true, Less: true, Equal: true, Value: 2048},
+				{Equal: true, Value: 8080},
+			}},
+		},
+		{
+			name:   "tcp-flags",
+			values: []string{"syn&!=ack"},
+			expected: flowspec.Component{Type: flowspec.TypeTCPFlags, Operators: []flowspec.Operator{
+				{Value: 0x02},
+				{And: true, Not: true, Match: true, Value: 0x10},
+			}},
+		},
+		{
+			name:   "fragment",
+			values: []string{"=is-fragment"},
+			expected: flowspec.Component{Type: flowspec.TypeFragment, Operators: []flowspec.Operator{
+				{Match: true, Value: 0x02},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			component, err := parseComponent(tc.name, tc.values)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, component)
+		})
+	}
+
+	_, err := parseComponent("protocol", []string{"=unknown"})
+	assert.Error(t, err)
+	_, err = parseComponent("extended-something", []string{"=1"})
+	assert.Error(t, err)
+}
+
+func TestParseASPathSegments(t *testing.T) {
+	asPath := parseASPath([]byte(`{ "0": { "element": "as-sequence", "value": [ 65001, 65002 ] }, "1": { "element": "as-set", "value": [ 65003, 65004 ] }, "2": { "element": "as-sequence", "value": [ 65005 ] } }`))
+	assert.Equal(t, route.ASPath{
+		{Type: route.ASSequence, ASNs: []uint32{65001, 65002}},
+		{Type: route.ASSet, ASNs: []uint32{65003, 65004}},
+		{Type: route.ASSequence, ASNs: []uint32{65005}},
+	}, asPath)
+	assert.Nil(t, parseASPath(nil))
+}
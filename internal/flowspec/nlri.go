@@ -0,0 +1,346 @@
+package flowspec
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// Component types (RFC 8955 section 4.2.2, RFC 8956 section 3)
+const (
+	TypeDestinationPrefix = 1
+	TypeSourcePrefix      = 2
+	TypeIPProtocol        = 3
+	TypePort              = 4
+	TypeDestinationPort   = 5
+	TypeSourcePort        = 6
+	TypeICMPType          = 7
+	TypeICMPCode          = 8
+	TypeTCPFlags          = 9
+	TypePacketLength      = 10
+	TypeDSCP              = 11
+	TypeFragment          = 12
+	TypeFlowLabel         = 13
+)
+
+// Operator byte bits (RFC 8955 section 4.2.1)
+const (
+	operatorEndOfList = 0x80
+	operatorAnd       = 0x40
+	operatorLength    = 0x30
+	operatorLess      = 0x04
+	operatorGreater   = 0x02
+	operatorEqual     = 0x01
+	operatorNot       = 0x02
+	operatorMatch     = 0x01
+)
+
+// maxLength is the largest NLRI length that can be encoded (RFC 8955 section 4.1)
+const maxLength = 0xfff
+
+// Operator is one term of a numeric or bitmask component
+type Operator struct {
+	// And combines the term with the previous one by logical AND instead of OR
+	And bool
+	// Less, Greater and Equal are the comparison of numeric operators
+	Less    bool
+	Greater bool
+	Equal   bool
+	// Not and Match are the flags of bitmask operators
+	Not   bool
+	Match bool
+	Value uint64
+}
+
+// Component is a single flowspec NLRI component
+type Component struct {
+	Type uint8
+	// Prefix is the prefix of prefix components
+	Prefix net.IPNet
+	// Offset is the bit offset of IPv6 prefix components
+	Offset uint8
+	// Operators are the terms of numeric and bitmask components
+	Operators []Operator
+}
+
+// NLRI is a decoded flowspec NLRI
+type NLRI struct {
+	IPv6       bool
+	Components []Component
+}
+
+// IsPrefix reports whether the component carries a prefix
+func (c Component) IsPrefix() bool {
+	return c.Type == TypeDestinationPrefix || c.Type == TypeSourcePrefix
+}
+
+// IsBitmask reports whether the component uses bitmask instead of numeric operators
+func (c Component) IsBitmask() bool {
+	return c.Type == TypeTCPFlags || c.Type == TypeFragment
+}
+
+// Split splits length prefixed flowspec NLRI, e.g. of a MP_REACH_NLRI attribute, into their encoded components
+func Split(data []byte) ([][]byte, error) {
+	var nlri [][]byte
+	for len(data) > 0 {
+		next, rest, err := Next(data)
+		if err != nil {
+			return nil, err
+		}
+		nlri = append(nlri, next)
+		data = rest
+	}
+	return nlri, nil
+}
+
+// Next returns the encoded components of the first length prefixed NLRI of data and the remaining data
+func Next(data []byte) ([]byte, []byte, error) {
+	if len(data) < 1 {
+		return nil, nil, errors.New("flowspec NLRI length truncated")
+	}
+	length := int(data[0])
+	offset := 1
+	if length >= 0xf0 {
+		if len(data) < 2 {
+			return nil, nil, errors.New("flowspec NLRI length truncated")
+		}
+		length = (length&0x0f)<<8 | int(data[1])
+		offset = 2
+	}
+	if len(data) < offset+length {
+		return nil, nil, errors.New("flowspec NLRI truncated")
+	}
+	return data[offset : offset+length], data[offset+length:], nil
+}
+
+// AppendLength appends the length prefix and the encoded components of a NLRI to dst
+func AppendLength(dst []byte, data []byte) ([]byte, error) {
+	switch {
+	case len(data) < 0xf0:
+		dst = append(dst, byte(len(data)))
+	case len(data) <= maxLength:
+		dst = append(dst, byte(0xf0|len(data)>>8), byte(len(data)))
+	default:
+		return nil, fmt.Errorf("flowspec NLRI too long (%d bytes)", len(data))
+	}
+	return append(dst, data...), nil
+}
+
+// Decode decodes the components of a flowspec NLRI without length prefix
+func Decode(data []byte, ipv6 bool) (NLRI, error) {
+	nlri := NLRI{IPv6: ipv6}
+
+	for len(data) > 0 {
+		component := Component{Type: data[0]}
+		data = data[1:]
+		if component.Type == 0 || component.Type > TypeFlowLabel || (component.Type == TypeFlowLabel && !ipv6) {
+			return NLRI{}, fmt.Errorf("unsupported component type %d", component.Type)
+		}
+		if n := len(nlri.Components); n > 0 && nlri.Components[n-1].Type >= component.Type {
+			return NLRI{}, fmt.Errorf("component type %d out of order", component.Type)
+		}
+
+		var err error
+		if component.IsPrefix() {
+			data, err = component.decodePrefix(data, ipv6)
+		} else {
+			data, err = component.decodeOperators(data)
+		}
+		if err != nil {
+			return NLRI{}, fmt.Errorf("component %d: %v", component.Type, err)
+		}
+		nlri.Components = append(nlri.Components, component)
+	}
+
+	if len(nlri.Components) == 0 {
+		return NLRI{}, errors.New("empty flowspec NLRI")
+	}
+	return nlri, nil
+}
+
+func (c *Component) decodePrefix(data []byte, ipv6 bool) ([]byte, error) {
+	addressLength := net.IPv4len
+	if ipv6 {
+		addressLength = net.IPv6len
+	}
+	if len(data) < 1 {
+		return nil, errors.New("prefix truncated")
+	}
+	prefixLength := int(data[0])
+	data = data[1:]
+	if ipv6 {
+		if len(data) < 1 {
+			return nil, errors.New("prefix truncated")
+		}
+		c.Offset = data[0]
+		data = data[1:]
+	}
+	if prefixLength > addressLength*8 || int(c.Offset) > prefixLength {
+		return nil, fmt.Errorf("invalid prefix length %d with offset %d", prefixLength, c.Offset)
+	}
+
+	patternLength := (prefixLength - int(c.Offset) + 7) / 8
+	if len(data) < patternLength {
+		return nil, errors.New("prefix truncated")
+	}
+	ip := make(net.IP, addressLength)
+	copyBits(ip, int(c.Offset), data, 0, prefixLength-int(c.Offset))
+	mask := net.CIDRMask(prefixLength, addressLength*8)
+	c.Prefix = net.IPNet{IP: ip, Mask: mask}
+
+	return data[patternLength:], nil
+}
+
+func (c *Component) decodeOperators(data []byte) ([]byte, error) {
+	for {
+		if len(data) < 1 {
+			return nil, errors.New("operator truncated")
+		}
+		operator := data[0]
+		valueLength := 1 << ((operator & operatorLength) >> 4)
+		if len(data) < 1+valueLength {
+			return nil, errors.New("value truncated")
+		}
+
+		term := Operator{And: operator&operatorAnd != 0}
+		if c.IsBitmask() {
+			term.Not = operator&operatorNot != 0
+			term.Match = operator&operatorMatch != 0
+		} else {
+			term.Less = operator&operatorLess != 0
+			term.Greater = operator&operatorGreater != 0
+			term.Equal = operator&operatorEqual != 0
+		}
+		for _, b := range data[1 : 1+valueLength] {
+			term.Value = term.Value<<8 | uint64(b)
+		}
+		// Protocol and next header values are a single octet, larger values can not match any packet
+		if c.Type == TypeIPProtocol && term.Value > 0xff {
+			return nil, fmt.Errorf("invalid protocol %d", term.Value)
+		}
+		c.Operators = append(c.Operators, term)
+		data = data[1+valueLength:]
+
+		if operator&operatorEndOfList != 0 {
+			return data, nil
+		}
+	}
+}
+
+// Encode encodes the components of the NLRI without length prefix, components are sorted by type
+func (n NLRI) Encode() ([]byte, error) {
+	components := make([]Component, len(n.Components))
+	copy(components, n.Components)
+	sort.SliceStable(components, func(i, j int) bool { return components[i].Type < components[j].Type })
+
+	var data []byte
+	for i, component := range components {
+		if i > 0 && components[i-1].Type == component.Type {
+			return nil, fmt.Errorf("duplicate component type %d", component.Type)
+		}
+		data = append(data, component.Type)
+
+		var err error
+		if component.IsPrefix() {
+			data, err = component.appendPrefix(data, n.IPv6)
+		} else {
+			data, err = component.appendOperators(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("component %d: %v", component.Type, err)
+		}
+	}
+
+	if len(data) > maxLength {
+		return nil, fmt.Errorf("flowspec NLRI too long (%d bytes)", len(data))
+	}
+	return data, nil
+}
+
+func (c Component) appendPrefix(data []byte, ipv6 bool) ([]byte, error) {
+	ip := c.Prefix.IP.To4()
+	if ipv6 {
+		ip = c.Prefix.IP.To16()
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("invalid prefix %s", c.Prefix.String())
+	}
+	prefixLength, bits := c.Prefix.Mask.Size()
+	if bits != len(ip)*8 || int(c.Offset) > prefixLength || (!ipv6 && c.Offset != 0) {
+		return nil, fmt.Errorf("invalid prefix %s with offset %d", c.Prefix.String(), c.Offset)
+	}
+
+	data = append(data, byte(prefixLength))
+	if ipv6 {
+		data = append(data, c.Offset)
+	}
+	pattern := make([]byte, (prefixLength-int(c.Offset)+7)/8)
+	copyBits(pattern, 0, ip, int(c.Offset), prefixLength-int(c.Offset))
+	return append(data, pattern...), nil
+}
+
+func (c Component) appendOperators(data []byte) ([]byte, error) {
+	if len(c.Operators) == 0 {
+		return nil, errors.New("no operators")
+	}
+
+	for i, term := range c.Operators {
+		var operator byte
+		if i == len(c.Operators)-1 {
+			operator |= operatorEndOfList
+		}
+		if term.And {
+			operator |= operatorAnd
+		}
+		if c.IsBitmask() {
+			if term.Not {
+				operator |= operatorNot
+			}
+			if term.Match {
+				operator |= operatorMatch
+			}
+		} else {
+			if term.Less {
+				operator |= operatorLess
+			}
+			if term.Greater {
+				operator |= operatorGreater
+			}
+			if term.Equal {
+				operator |= operatorEqual
+			}
+		}
+
+		var valueLength int
+		switch {
+		case term.Value <= 0xff:
+			valueLength = 1
+		case term.Value <= 0xffff:
+			valueLength = 2
+			operator |= 0x10
+		case term.Value <= 0xffffffff:
+			valueLength = 4
+			operator |= 0x20
+		default:
+			valueLength = 8
+			operator |= 0x30
+		}
+
+		data = append(data, operator)
+		for shift := (valueLength - 1) * 8; shift >= 0; shift -= 8 {
+			data = append(data, byte(term.Value>>shift))
+		}
+	}
+	return data, nil
+}
+
+// copyBits copies length bits of src starting at bit srcOffset to dst starting at bit dstOffset
+func copyBits(dst []byte, dstOffset int, src []byte, srcOffset int, length int) {
+	for i := 0; i < length; i++ {
+		s, d := srcOffset+i, dstOffset+i
+		if src[s/8]&(0x80>>(s%8)) != 0 {
+			dst[d/8] |= 0x80 >> (d % 8)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package flowspec
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func prefix(cidr string) net.IPNet {
+	_, network, _ := net.ParseCIDR(cidr)
+	return *network
+}
+
+func TestDecodeEncode(t *testing.T) {
+	type testCase struct {
+		name     string
+		ipv6     bool
+		data     []byte
+		expected []Component
+	}
+
+	testCases := []testCase{
+		{
+			// RFC 8955 section 4.2.3, example 1
+			name: "destination and port",
+			data: []byte{0x01, 0x18, 0xc0, 0x00, 0x02, 0x03, 0x81, 0x06, 0x04, 0x81, 0x19},
+			expected: []Component{
+				{Type: TypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: TypeIPProtocol, Operators: []Operator{{Equal: true, Value: 6}}},
+				{Type: TypePort, Operators: []Operator{{Equal: true, Value: 25}}},
+			},
+		},
+		{
+			// RFC 8955 section 4.2.3, example 2
+			name: "port ranges",
+			data: []byte{0x01, 0x18, 0xc0, 0x00, 0x02, 0x02, 0x18, 0xcb, 0x00, 0x71, 0x04, 0x03, 0x89, 0x45, 0x8b, 0x91, 0x1f, 0x90},
+			expected: []Component{
+				{Type: TypeDestinationPrefix, Prefix: prefix("192.0.2.0/24")},
+				{Type: TypeSourcePrefix, Prefix: prefix("203.0.113.0/24")},
+				{Type: TypePort, Operators: []Operator{
+					{Greater: true, Equal: true, Value: 137},
+					{And: true, Less: true, Equal: true, Value: 139},
+					{Equal: true, Value: 8080},
+				}},
+			},
+		},
+		{
+			name: "tcp flags syn and not ack",
+			data: []byte{0x09, 0x01, 0x02, 0xc3, 0x10},
+			expected: []Component{
+				{Type: TypeTCPFlags, Operators: []Operator{
+					{Match: true, Value: 0x02},
+					{And: true, Not: true, Match: true, Value: 0x10},
+				}},
+			},
+		},
+		{
+			name: "ipv6 prefix offset and flow label",
+			ipv6: true,
+			data: []byte{0x01, 0x40, 0x20, 0x00, 0x00, 0x00, 0x01, 0x0d, 0x91, 0x12, 0x34},
+			expected: []Component{
+				{Type: TypeDestinationPrefix, Offset: 32, Prefix: net.IPNet{IP: net.ParseIP("0:0:0:1::"), Mask: net.CIDRMask(64, 128)}},
+				{Type: TypeFlowLabel, Operators: []Operator{{Equal: true, Value: 0x1234}}},
+			},
+		},
+		{
+			name: "ipv6 destination prefix",
+			ipv6: true,
+			data: []byte{0x01, 0x20, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x0a, 0x91, 0x05, 0xdc},
+			expected: []Component{
+				{Type: TypeDestinationPrefix, Prefix: prefix("2001:db8::/32")},
+				{Type: TypePacketLength, Operators: []Operator{{Equal: true, Value: 1500}}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nlri, err := Decode(tc.data, tc.ipv6)
+			require.NoError(t, err)
+			assert.Equal(t, NLRI{IPv6: tc.ipv6, Components: tc.expected}, nlri)
+
+			encoded, err := nlri.Encode()
+			require.NoError(t, err)
+			assert.Equal(t, tc.data, encoded)
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	type testCase struct {
+		name string
+		ipv6 bool
+		data []byte
+	}
+
+	testCases := []testCase{
+		{name: "empty", data: []byte{}},
+		{name: "out of order", data: []byte{0x03, 0x81, 0x06, 0x01, 0x18, 0xc0, 0x00, 0x02}},
+		{name: "unknown type", data: []byte{0x0e, 0x81, 0x01}},
+		{name: "flow label in ipv4", data: []byte{0x0d, 0x81, 0x01}},
+		{name: "prefix truncated", data: []byte{0x01, 0x18, 0xc0, 0x00}},
+		{name: "prefix too long", data: []byte{0x01, 0x21, 0xc0, 0x00, 0x02, 0x01, 0x00}},
+		{name: "offset beyond length", ipv6: true, data: []byte{0x01, 0x10, 0x20}},
+		{name: "missing end of list", data: []byte{0x03, 0x01, 0x06}},
+		{name: "value truncated", data: []byte{0x05, 0x91, 0x01}},
+		{name: "protocol above 255", data: []byte{0x03, 0x91, 0x01, 0x06}},
+		{name: "next header above 255", ipv6: true, data: []byte{0x03, 0x91, 0x01, 0x11}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode(tc.data, tc.ipv6)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLengthEncoding(t *testing.T) {
+	short := []byte{0x03, 0x81, 0x06}
+	long := bytes.Repeat([]byte{0x00}, 0x1f4)
+
+	data, err := AppendLength(nil, short)
+	require.NoError(t, err)
+	data, err = AppendLength(data, long)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x03, 0x03, 0x81, 0x06, 0xf1, 0xf4}, data[:6])
+
+	split, err := Split(data)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{short, long}, split)
+
+	_, err = AppendLength(nil, make([]byte, maxLength+1))
+	assert.Error(t, err)
+	_, err = Split([]byte{0xf1})
+	assert.Error(t, err)
+}
+
+func TestRouteConversion(t *testing.T) {
+	var flowSpecRoute route.FlowspecRoute
+	flowSpecRoute.MatchAttrs.Destination = prefix("2001:db8::/32")
+	flowSpecRoute.MatchAttrs.Source = prefix("2001:db8:1::/48")
+	flowSpecRoute.MatchAttrs.Protocol = 17
+	flowSpecRoute.MatchAttrs.DestinationPort = 53
+	flowSpecRoute.Action = route.ActionTrafficRateBytes
+
+	data, err := FromRoute(flowSpecRoute).Encode()
+	require.NoError(t, err)
+	nlri, err := Decode(data, true)
+	require.NoError(t, err)
+
+	decoded, err := nlri.Route(route.FlowspecRoute{Action: route.ActionTrafficRateBytes})
+	require.NoError(t, err)
+	assert.Equal(t, flowSpecRoute, decoded)
+
+	// Destination port range "dport >= 1024 && <= 2048"
+	nlri, err = Decode([]byte{0x05, 0x13, 0x04, 0x00, 0xd5, 0x08, 0x00}, false)
+	require.NoError(t, err)
+	_, err = nlri.Route(route.FlowspecRoute{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package flowspec
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Compare orders flowspec NLRI by precedence (RFC 8955 section 5.1, RFC 8956 section 4). It returns a negative
+// number if a has precedence over b, a positive number if b has precedence and 0 if both are equal.
+// IPv4 NLRI are ordered before IPv6 NLRI.
+func Compare(a, b NLRI) int {
+	if a.IPv6 != b.IPv6 {
+		if b.IPv6 {
+			return -1
+		}
+		return 1
+	}
+
+	componentsA, componentsB := sortedComponents(a), sortedComponents(b)
+	for i := 0; i < len(componentsA) && i < len(componentsB); i++ {
+		componentA, componentB := componentsA[i], componentsB[i]
+		// The NLRI with the lower component type has precedence
+		if componentA.Type != componentB.Type {
+			return int(componentA.Type) - int(componentB.Type)
+		}
+
+		if componentA.IsPrefix() {
+			if cmp := comparePrefixes(componentA, componentB, a.IPv6); cmp != 0 {
+				return cmp
+			}
+			continue
+		}
+
+		dataA, _ := componentA.appendOperators(nil)
+		dataB, _ := componentB.appendOperators(nil)
+		common := min(len(dataA), len(dataB))
+		// The lower value has precedence, for equal values the longer component
+		if cmp := bytes.Compare(dataA[:common], dataB[:common]); cmp != 0 {
+			return cmp
+		}
+		if len(dataA) != len(dataB) {
+			return len(dataB) - len(dataA)
+		}
+	}
+
+	// The NLRI with more components has precedence
+	return len(componentsB) - len(componentsA)
+}
+
+// comparePrefixes compares prefix components: the lower offset, the lower prefix value over the common
+// length and then the longer prefix have precedence
+func comparePrefixes(a, b Component, ipv6 bool) int {
+	if a.Offset != b.Offset {
+		return int(a.Offset) - int(b.Offset)
+	}
+
+	ipA, ipB := a.Prefix.IP.To4(), b.Prefix.IP.To4()
+	if ipv6 {
+		ipA, ipB = a.Prefix.IP.To16(), b.Prefix.IP.To16()
+	}
+	lengthA, _ := a.Prefix.Mask.Size()
+	lengthB, _ := b.Prefix.Mask.Size()
+	common := min(lengthA, lengthB) - int(a.Offset)
+	if common > 0 {
+		patternA := make([]byte, (common+7)/8)
+		patternB := make([]byte, (common+7)/8)
+		copyBits(patternA, 0, ipA, int(a.Offset), common)
+		copyBits(patternB, 0, ipB, int(b.Offset), common)
+		if cmp := bytes.Compare(patternA, patternB); cmp != 0 {
+			return cmp
+		}
+	}
+	return lengthB - lengthA
+}
+
+func sortedComponents(n NLRI) []Component {
+	components := make([]Component, len(n.Components))
+	copy(components, n.Components)
+	sort.SliceStable(components, func(i, j int) bool { return components[i].Type < components[j].Type })
+	return components
+}
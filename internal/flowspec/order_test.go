@@ -0,0 +1,74 @@
+package flowspec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	type testCase struct {
+		name string
+		// first has precedence over second
+		first  NLRI
+		second NLRI
+	}
+
+	destination := func(cidr string) Component {
+		return Component{Type: TypeDestinationPrefix, Prefix: prefix(cidr)}
+	}
+	protocol := func(value uint64) Component {
+		return Component{Type: TypeIPProtocol, Operators: []Operator{{Equal: true, Value: value}}}
+	}
+
+	testCases := []testCase{
+		{
+			name:   "longer prefix",
+			first:  NLRI{Components: []Component{destination("192.0.2.0/25")}},
+			second: NLRI{Components: []Component{destination("192.0.2.0/24")}},
+		},
+		{
+			name:   "lower prefix",
+			first:  NLRI{Components: []Component{destination("192.0.2.0/24")}},
+			second: NLRI{Components: []Component{destination("198.51.100.0/25")}},
+		},
+		{
+			name:   "lower component type",
+			first:  NLRI{Components: []Component{destination("198.51.100.0/24")}},
+			second: NLRI{Components: []Component{{Type: TypeSourcePrefix, Prefix: prefix("192.0.2.0/24")}}},
+		},
+		{
+			name:   "more components",
+			first:  NLRI{Components: []Component{protocol(6), destination("192.0.2.0/24")}},
+			second: NLRI{Components: []Component{destination("192.0.2.0/24")}},
+		},
+		{
+			name:   "lower value",
+			first:  NLRI{Components: []Component{protocol(6)}},
+			second: NLRI{Components: []Component{protocol(17)}},
+		},
+		{
+			name:   "longer value",
+			first:  NLRI{Components: []Component{{Type: TypeIPProtocol, Operators: []Operator{{Equal: true, Value: 6}, {Equal: true, Value: 17}}}}},
+			second: NLRI{Components: []Component{{Type: TypeIPProtocol, Operators: []Operator{{Equal: true, Value: 6}}}}},
+		},
+		{
+			name:   "ipv6 offset",
+			first:  NLRI{IPv6: true, Components: []Component{destination("2001:db8::/32")}},
+			second: NLRI{IPv6: true, Components: []Component{{Type: TypeDestinationPrefix, Offset: 16, Prefix: prefix("::db8:0:0:0:0:0/32")}}},
+		},
+		{
+			name:   "ipv4 before ipv6",
+			first:  NLRI{Components: []Component{destination("192.0.2.0/24")}},
+			second: NLRI{IPv6: true, Components: []Component{destination("2001:db8::/64")}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Negative(t, Compare(tc.first, tc.second))
+			assert.Positive(t, Compare(tc.second, tc.first))
+			assert.Zero(t, Compare(tc.first, tc.first))
+		})
+	}
+}
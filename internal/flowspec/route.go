@@ -0,0 +1,89 @@
+package flowspec
+
+import (
+	"fmt"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// FromRoute builds the NLRI matching the match attributes of a route
+func FromRoute(r route.FlowspecRoute) NLRI {
+	nlri := NLRI{IPv6: r.IsIPv6()}
+
+	if r.MatchAttrs.Destination.IP != nil {
+		nlri.Components = append(nlri.Components, Component{Type: TypeDestinationPrefix, Prefix: r.MatchAttrs.Destination})
+	}
+	if r.MatchAttrs.Source.IP != nil {
+		nlri.Components = append(nlri.Components, Component{Type: TypeSourcePrefix, Prefix: r.MatchAttrs.Source})
+	}
+	for _, value := range []struct {
+		componentType uint8
+		value         uint64
+	}{
+		{TypeIPProtocol, r.MatchAttrs.Protocol},
+		{TypeDestinationPort, uint64(r.MatchAttrs.DestinationPort)},
+		{TypeSourcePort, uint64(r.MatchAttrs.SourcePort)},
+	} {
+		if value.value != 0 {
+			nlri.Components = append(nlri.Components, Component{Type: value.componentType, Operators: []Operator{{Equal: true, Value: value.value}}})
+		}
+	}
+
+	return nlri
+}
+
+// Route sets the match attributes of a copy of template from the NLRI. Components that can not be
+// represented as route match attributes are rejected.
+func (n NLRI) Route(template route.FlowspecRoute) (route.FlowspecRoute, error) {
+	flowSpecRoute := template
+	flowSpecRoute.MatchAttrs = route.FlowspecRoute{}.MatchAttrs
+
+	for _, component := range n.Components {
+		switch component.Type {
+		case TypeDestinationPrefix, TypeSourcePrefix:
+			if component.Offset != 0 {
+				return route.FlowspecRoute{}, fmt.Errorf("unsupported prefix offset %d", component.Offset)
+			}
+			if component.Type == TypeDestinationPrefix {
+				flowSpecRoute.MatchAttrs.Destination = component.Prefix
+			} else {
+				flowSpecRoute.MatchAttrs.Source = component.Prefix
+			}
+		case TypeIPProtocol, TypeDestinationPort, TypeSourcePort:
+			value, err := component.equalityValue()
+			if err != nil {
+				return route.FlowspecRoute{}, fmt.Errorf("component %d: %v", component.Type, err)
+			}
+			switch component.Type {
+			case TypeIPProtocol:
+				flowSpecRoute.MatchAttrs.Protocol = value
+			case TypeDestinationPort:
+				flowSpecRoute.MatchAttrs.DestinationPort = uint16(value)
+			case TypeSourcePort:
+				flowSpecRoute.MatchAttrs.SourcePort = uint16(value)
+			}
+		default:
+			return route.FlowspecRoute{}, fmt.Errorf("unsupported flowspec component type %d", component.Type)
+		}
+	}
+
+	return flowSpecRoute, nil
+}
+
+// equalityValue returns the value of a component that consists of a single equality match
+func (c Component) equalityValue() (uint64, error) {
+	if len(c.Operators) != 1 {
+		return 0, fmt.Errorf("only a single value is supported")
+	}
+	term := c.Operators[0]
+	if term.Less || term.Greater || !term.Equal {
+		return 0, fmt.Errorf("only equality matches are supported")
+	}
+	if c.Type == TypeIPProtocol && term.Value > 0xff {
+		return 0, fmt.Errorf("invalid protocol %d", term.Value)
+	}
+	if c.Type != TypeIPProtocol && term.Value > 0xffff {
+		return 0, fmt.Errorf("invalid port %d", term.Value)
+	}
+	return term.Value, nil
+}
@@ -11,8 +11,9 @@ import (
 )
 
 const (
-	counterNamespace = "nftables"
-	labelCounterName = "name"
+	counterNamespace   = "nftables"
+	labelCounterName   = "name"
+	labelCounterFamily = "family"
 )
 const (
 	CounterFlowSpecHandled      = "flowspec_handled"
@@ -27,9 +28,29 @@ type counterMetricsRegistry struct {
 
 var (
 	counters       = []string{CounterFlowSpecHandled, CounterFlowSpecDropped, CounterFlowSpecLimitMatched}
-	counterMetrics = counterMetricsRegistry{}
+	counterMetrics = counterMetricsRegistry{
+		packets: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: counterNamespace,
+			Name:      "counter_packets",
+			Help:      "counted packets per counter",
+		}, []string{labelCounterName, labelCounterFamily}),
+		bytes: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: counterNamespace,
+			Name:      "counter_bytes",
+			Help:      "counted bytes per counter",
+		}, []string{labelCounterName, labelCounterFamily}),
+	}
 )
 
+// tableFamilyNames are the values of the family label of the counters of a table
+var tableFamilyNames = map[nftables.TableFamily]string{
+	nftables.TableFamilyINet:   "inet",
+	nftables.TableFamilyIPv4:   "ip",
+	nftables.TableFamilyIPv6:   "ip6",
+	nftables.TableFamilyNetdev: "netdev",
+	nftables.TableFamilyBridge: "bridge",
+}
+
 func InstallNamedCounters(table *nftables.Table) error {
 	nft, err := nftables.New()
 	if err != nil {
@@ -44,18 +65,6 @@ func InstallNamedCounters(table *nftables.Table) error {
 		})
 	}
 
-	// Create prometheus metrics
-	counterMetrics.packets = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: counterNamespace,
-		Name:      "counter_packets",
-		Help:      "counted packets per counter",
-	}, []string{labelCounterName})
-	counterMetrics.bytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: counterNamespace,
-		Name:      "counter_bytes",
-		Help:      "counted bytes per counter",
-	}, []string{labelCounterName})
-
 	return nft.Flush()
 }
 
@@ -78,8 +87,9 @@ func queryCounterMetrics(table *nftables.Table) {
 				if counter != counterObject.Name {
 					continue
 				}
-				counterMetrics.packets.With(prometheus.Labels{labelCounterName: counter}).Set(float64(counterObject.Packets))
-				counterMetrics.bytes.With(prometheus.Labels{labelCounterName: counter}).Set(float64(counterObject.Bytes))
+				labels := prometheus.Labels{labelCounterName: counter, labelCounterFamily: tableFamilyNames[table.Family]}
+				counterMetrics.packets.With(labels).Set(float64(counterObject.Packets))
+				counterMetrics.bytes.With(labels).Set(float64(counterObject.Bytes))
 				break
 			}
 		default:
@@ -17,6 +17,81 @@ var (
 		Help: "Total number of flowspec routes",
 	})
 
+	BirdFilteredFlowSpecRoutes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bird_filtered_flowspec_routes",
+		Help: "Number of flowspec routes rejected by BIRD import filters",
+	}, []string{"protocol"})
+
+	FlowSpecRoutesRejected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flowspec_routes_rejected",
+		Help: "Number of flowspec routes the daemon was unable to turn into nftables rules",
+	}, []string{"protocol"})
+
+	FlowSpecRouteMaxAgeSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flowspec_route_max_age_seconds",
+		Help: "Age of the oldest flowspec route since its import into BIRD",
+	}, []string{"protocol"})
+
+	BMPPeers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bmp_peers",
+		Help: "Number of BGP peers monitored via BMP",
+	})
+
+	BMPMessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bmp_messages_total",
+		Help: "Total number of received BMP messages",
+	}, []string{"type"})
+
+	BGPSessionEstablished = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bgp_session_established",
+		Help: "Whether the BGP session of the built-in flowspec speaker is established",
+	})
+
+	BGPMessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bgp_messages_total",
+		Help: "Total number of BGP messages received by the built-in flowspec speaker",
+	}, []string{"type"})
+
+	SourceRoutes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flowspec_source_routes",
+		Help: "Number of flowspec routes provided by a route source",
+	}, []string{"source"})
+
+	SourceRoutesShadowed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flowspec_source_routes_shadowed",
+		Help: "Number of flowspec routes of a route source replaced by routes of other sources due to the merge policy",
+	}, []string{"source"})
+
+	SourceErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flowspec_source_errors_total",
+		Help: "Total number of errors of a route source",
+	}, []string{"source"})
+
+	OriginatedRoutes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "flowspec_originated_routes",
+		Help: "Number of flowspec routes originated into BIRD via the API",
+	})
+
+	DetectorMitigations = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "flowspec_detector_mitigations",
+		Help: "Number of active mitigations created by the threshold detector",
+	})
+
+	DetectorMitigationsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flowspec_detector_mitigations_total",
+		Help: "Total number of mitigations created by the threshold detector",
+	})
+
+	FlowSpecSessionRules = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flowspec_session_rules",
+		Help: "Number of rules in the chain of a session",
+	}, []string{"protocol"})
+
+	FlowSpecSessionChainUpdatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flowspec_session_chain_updates_total",
+		Help: "Total number of updates of the chain of a session",
+	}, []string{"protocol"})
+
 	NftablesFlushDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name: "nftables_flush_duration_seconds",
 		Help: "duration of nftables flush operations",
@@ -0,0 +1,76 @@
+package mrt
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// MRT record types (RFC 6396 section 4)
+const (
+	TypeTableDumpV2 = 13
+	TypeBGP4MP      = 16
+	TypeBGP4MPET    = 17
+)
+
+// TABLE_DUMP_V2 subtypes (RFC 6396 section 4.3, RFC 8050)
+const (
+	subtypePeerIndexTable    = 1
+	subtypeRIBGeneric        = 6
+	subtypeRIBGenericAddPath = 12
+)
+
+// BGP4MP subtypes (RFC 6396 section 4.4)
+const (
+	subtypeStateChange     = 0
+	subtypeMessage         = 1
+	subtypeMessageAS4      = 4
+	subtypeStateChangeAS4  = 5
+	subtypeMessageLocal    = 6
+	subtypeMessageAS4Local = 7
+)
+
+const headerLength = 12
+
+// Record is a MRT record
+type Record struct {
+	Timestamp time.Time
+	Type      uint16
+	Subtype   uint16
+	Body      []byte
+}
+
+// ReadRecord reads one MRT record from r. The microsecond timestamp of extended timestamp records is
+// removed from the body.
+func ReadRecord(r io.Reader) (Record, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Record{}, err
+	}
+
+	record := Record{
+		Timestamp: time.Unix(int64(binary.BigEndian.Uint32(header[0:4])), 0),
+		Type:      binary.BigEndian.Uint16(header[4:6]),
+		Subtype:   binary.BigEndian.Uint16(header[6:8]),
+		Body:      make([]byte, binary.BigEndian.Uint32(header[8:12])),
+	}
+	if _, err := io.ReadFull(r, record.Body); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+
+	if record.Type == TypeBGP4MPET {
+		if len(record.Body) < 4 {
+			return Record{}, errors.New("extended timestamp truncated")
+		}
+		microseconds := binary.BigEndian.Uint32(record.Body[0:4])
+		record.Timestamp = record.Timestamp.Add(time.Duration(microseconds) * time.Microsecond)
+		record.Type = TypeBGP4MP
+		record.Body = record.Body[4:]
+	}
+
+	return record, nil
+}
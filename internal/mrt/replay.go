@@ -0,0 +1,58 @@
+package mrt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// Replay applies the records of r to a RIB. Whenever the recorded time advances after the routes changed,
+// and once at the end of the file, apply is called with the routes at that time. speed scales the recorded
+// time between records, a speed of zero replays without delays.
+func Replay(ctx context.Context, r io.Reader, speed float64, apply func(time.Time, []route.FlowspecRoute) error) error {
+	rib := NewRIB()
+	var current time.Time
+	pending := false
+
+	for {
+		record, err := ReadRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !record.Timestamp.Equal(current) {
+			if pending {
+				if err := apply(current, rib.Routes()); err != nil {
+					return err
+				}
+				pending = false
+			}
+			if !current.IsZero() && speed > 0 && record.Timestamp.After(current) {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(float64(record.Timestamp.Sub(current)) / speed)):
+				}
+			}
+			current = record.Timestamp
+		}
+
+		changed, err := rib.Apply(record)
+		if err != nil {
+			slog.Warn("error applying MRT record", slog.Any("type", record.Type), slog.Any("subtype", record.Subtype), slog.String("error", err.Error()))
+		}
+		pending = pending || changed
+	}
+
+	if pending {
+		return apply(current, rib.Routes())
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package mrt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/bgp"
+	"bird-flowspec-daemon/internal/route"
+)
+
+// flow4NLRI matches "flow4 { dst 192.0.2.1/32; proto 17; dport 123; }"
+var flow4NLRI = []byte{0x0c, 0x01, 0x20, 0xc0, 0x00, 0x02, 0x01, 0x03, 0x81, 0x11, 0x05, 0x81, 0x7b}
+
+// otherFlow4NLRI matches "flow4 { dst 198.51.100.0/24; }"
+var otherFlow4NLRI = []byte{0x05, 0x01, 0x18, 0xc6, 0x33, 0x64}
+
+// dropCommunity is the traffic-rate 0 extended community attribute
+var dropCommunity = []byte{0xc0, 0x10, 0x08, 0x80, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+var start = time.Unix(1736762400, 0)
+
+func record(timestamp time.Time, recordType, subtype uint16, body []byte) []byte {
+	header := make([]byte, headerLength)
+	binary.BigEndian.PutUint32(header[0:4], uint32(timestamp.Unix()))
+	binary.BigEndian.PutUint16(header[4:6], recordType)
+	binary.BigEndian.PutUint16(header[6:8], subtype)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(body)))
+	return append(header, body...)
+}
+
+// bgp4mpHeader is the header of BGP4MP AS4 records of the IPv4 peer 192.0.2.2 (AS 65000)
+func bgp4mpHeader() []byte {
+	return []byte{
+		0x00, 0x00, 0xfd, 0xe8, 0x00, 0x00, 0xfd, 0xe8, 0x00, 0x00, 0x00, 0x01,
+		0xc0, 0x00, 0x02, 0x02, 0xc0, 0x00, 0x02, 0x01,
+	}
+}
+
+func mrtFile() []byte {
+	var data []byte
+
+	peerIndexTable := []byte{0xc0, 0x00, 0x02, 0x01, 0x00, 0x00, 0x00, 0x01, 0x02, 0xc0, 0x00, 0x02, 0x02, 0xc0, 0x00, 0x02, 0x02, 0x00, 0x00, 0xfd, 0xe8}
+	data = append(data, record(start, TypeTableDumpV2, subtypePeerIndexTable, peerIndexTable)...)
+
+	attributes := append([]byte{0x80, 0x0e, 0x01, 0x00}, dropCommunity...)
+	ribGeneric := []byte{0x00, 0x00, 0x00, 0x00, 0x00, bgp.AFIIPv4, bgp.SAFIFlowspec}
+	ribGeneric = append(ribGeneric, flow4NLRI...)
+	ribGeneric = append(ribGeneric, 0x00, 0x01, 0x00, 0x00)
+	ribGeneric = binary.BigEndian.AppendUint32(ribGeneric, uint32(start.Unix()-60))
+	ribGeneric = binary.BigEndian.AppendUint16(ribGeneric, uint16(len(attributes)))
+	ribGeneric = append(ribGeneric, attributes...)
+	data = append(data, record(start, TypeTableDumpV2, subtypeRIBGeneric, ribGeneric)...)
+
+	unreach := append([]byte{0x80, 0x0f, byte(3 + len(flow4NLRI)), 0x00, bgp.AFIIPv4, bgp.SAFIFlowspec}, flow4NLRI...)
+	reach := append([]byte{0x80, 0x0e, byte(5 + len(otherFlow4NLRI)), 0x00, bgp.AFIIPv4, bgp.SAFIFlowspec, 0x00, 0x00}, otherFlow4NLRI...)
+	pathAttributes := append(append(unreach, dropCommunity...), reach...)
+	update := append([]byte{0x00, 0x00, 0x00, byte(len(pathAttributes))}, pathAttributes...)
+	message := append([]byte{0x00, 0x00, 0x01, 0xf4}, bgp4mpHeader()...)
+	message = append(message, bgp.Message{Type: bgp.MessageTypeUpdate, Body: update}.Marshal()...)
+	data = append(data, record(start.Add(10*time.Second), TypeBGP4MPET, subtypeMessageAS4, message)...)
+
+	keepalive := append(bgp4mpHeader(), bgp.Message{Type: bgp.MessageTypeKeepalive}.Marshal()...)
+	data = append(data, record(start.Add(15*time.Second), TypeBGP4MP, subtypeMessageAS4, keepalive)...)
+
+	stateChange := append(bgp4mpHeader(), 0x00, 0x06, 0x00, 0x01)
+	data = append(data, record(start.Add(20*time.Second), TypeBGP4MP, subtypeStateChangeAS4, stateChange)...)
+
+	return data
+}
+
+func TestReplay(t *testing.T) {
+	type snapshot struct {
+		timestamp time.Time
+		nets      []string
+	}
+
+	var snapshots []snapshot
+	err := Replay(context.Background(), bytes.NewReader(mrtFile()), 0, func(timestamp time.Time, routes []route.FlowspecRoute) error {
+		var nets []string
+		for _, flowSpecRoute := range routes {
+			nets = append(nets, flowSpecRoute.Net())
+			assert.Equal(t, "192.0.2.2", flowSpecRoute.SessionAttrs.SessionName)
+			assert.Equal(t, int64(route.ActionTrafficRateBytes), flowSpecRoute.Action)
+		}
+		snapshots = append(snapshots, snapshot{timestamp: timestamp, nets: nets})
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []snapshot{
+		{timestamp: start, nets: []string{"flow4 { dst 192.0.2.1/32; proto 17; dport 123; }"}},
+		{timestamp: start.Add(10*time.Second + 500*time.Microsecond), nets: []string{"flow4 { dst 198.51.100.0/24; }"}},
+		{timestamp: start.Add(20 * time.Second)},
+	}, snapshots)
+}
+
+func TestRIBImportTime(t *testing.T) {
+	rib := NewRIB()
+	reader := bytes.NewReader(mrtFile())
+	for i := 0; i < 2; i++ {
+		record, err := ReadRecord(reader)
+		require.NoError(t, err)
+		changed, err := rib.Apply(record)
+		require.NoError(t, err)
+		assert.True(t, changed)
+	}
+
+	routes := rib.Routes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, start.Add(-time.Minute), routes[0].SessionAttrs.ImportTime)
+}
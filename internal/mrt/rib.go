@@ -0,0 +1,272 @@
+package mrt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"bird-flowspec-daemon/internal/bgp"
+	"bird-flowspec-daemon/internal/flowspec"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// bgpStateEstablished is the BGP FSM state of established sessions in state change records
+const bgpStateEstablished = 6
+
+// Peer is an entry of the TABLE_DUMP_V2 peer index table
+type Peer struct {
+	RouterID net.IP
+	Address  net.IP
+	AS       uint32
+}
+
+// RIB keeps the flowspec routes of replayed MRT records per peer
+type RIB struct {
+	peerIndex []Peer
+	// routes are indexed by peer address and NLRI
+	routes map[string]map[string]route.FlowspecRoute
+}
+
+// NewRIB creates an empty RIB
+func NewRIB() *RIB {
+	return &RIB{routes: make(map[string]map[string]route.FlowspecRoute)}
+}
+
+// Routes returns the flowspec routes of all peers in a stable order
+func (r *RIB) Routes() []route.FlowspecRoute {
+	var keys []string
+	index := make(map[string]route.FlowspecRoute)
+	for peer, routes := range r.routes {
+		for nlri, flowSpecRoute := range routes {
+			key := peer + "|" + nlri
+			keys = append(keys, key)
+			index[key] = flowSpecRoute
+		}
+	}
+	sort.Strings(keys)
+
+	routes := make([]route.FlowspecRoute, 0, len(keys))
+	for _, key := range keys {
+		routes = append(routes, index[key])
+	}
+	return routes
+}
+
+// Apply applies a MRT record to the RIB and reports whether flowspec routes may have changed. A peer
+// index table starts a new table dump and replaces all routes, records of other types and subtypes are
+// ignored.
+func (r *RIB) Apply(record Record) (bool, error) {
+	switch {
+	case record.Type == TypeTableDumpV2 && record.Subtype == subtypePeerIndexTable:
+		peerIndex, err := parsePeerIndexTable(record.Body)
+		if err != nil {
+			return false, err
+		}
+		r.peerIndex = peerIndex
+		r.routes = make(map[string]map[string]route.FlowspecRoute)
+		return true, nil
+	case record.Type == TypeTableDumpV2 && (record.Subtype == subtypeRIBGeneric || record.Subtype == subtypeRIBGenericAddPath):
+		return r.applyRIBGeneric(record.Body, record.Subtype == subtypeRIBGenericAddPath)
+	case record.Type == TypeBGP4MP:
+		switch record.Subtype {
+		case subtypeStateChange, subtypeStateChangeAS4:
+			return r.applyStateChange(record)
+		case subtypeMessage, subtypeMessageAS4, subtypeMessageLocal, subtypeMessageAS4Local:
+			return r.applyMessage(record)
+		}
+	}
+	return false, nil
+}
+
+func parsePeerIndexTable(body []byte) ([]Peer, error) {
+	if len(body) < 6 {
+		return nil, errors.New("peer index table truncated")
+	}
+	viewNameLength := int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < 8+viewNameLength {
+		return nil, errors.New("peer index table truncated")
+	}
+	count := int(binary.BigEndian.Uint16(body[6+viewNameLength : 8+viewNameLength]))
+	data := body[8+viewNameLength:]
+
+	peers := make([]Peer, 0, count)
+	for i := 0; i < count; i++ {
+		if len(data) < 5 {
+			return nil, errors.New("peer entry truncated")
+		}
+		peerType := data[0]
+		addressLength, asLength := net.IPv4len, 2
+		if peerType&0x01 != 0 {
+			addressLength = net.IPv6len
+		}
+		if peerType&0x02 != 0 {
+			asLength = 4
+		}
+		if len(data) < 5+addressLength+asLength {
+			return nil, errors.New("peer entry truncated")
+		}
+
+		peer := Peer{
+			RouterID: net.IP(data[1:5]).To16(),
+			Address:  net.IP(data[5 : 5+addressLength]).To16(),
+		}
+		asn := data[5+addressLength : 5+addressLength+asLength]
+		if asLength == 4 {
+			peer.AS = binary.BigEndian.Uint32(asn)
+		} else {
+			peer.AS = uint32(binary.BigEndian.Uint16(asn))
+		}
+		peers = append(peers, peer)
+		data = data[5+addressLength+asLength:]
+	}
+	return peers, nil
+}
+
+// applyRIBGeneric adds the entries of a RIB_GENERIC record, which carries flowspec NLRI
+func (r *RIB) applyRIBGeneric(body []byte, addPath bool) (bool, error) {
+	if len(body) < 7 {
+		return false, errors.New("RIB record truncated")
+	}
+	afi, safi := binary.BigEndian.Uint16(body[4:6]), body[6]
+	if safi != bgp.SAFIFlowspec {
+		return false, nil
+	}
+	nlriData, data, err := flowspec.Next(body[7:])
+	if err != nil {
+		return false, err
+	}
+	nlri, err := flowspec.Decode(nlriData, afi == bgp.AFIIPv6)
+	if err != nil {
+		return false, err
+	}
+	if len(data) < 2 {
+		return false, errors.New("RIB record truncated")
+	}
+	count := int(binary.BigEndian.Uint16(data[0:2]))
+	data = data[2:]
+
+	for i := 0; i < count; i++ {
+		entryHeaderLength := 8
+		if addPath {
+			entryHeaderLength = 12
+		}
+		if len(data) < entryHeaderLength {
+			return i > 0, errors.New("RIB entry truncated")
+		}
+		peerIndex := int(binary.BigEndian.Uint16(data[0:2]))
+		originated := time.Unix(int64(binary.BigEndian.Uint32(data[2:6])), 0)
+		attributesLength := int(binary.BigEndian.Uint16(data[entryHeaderLength-2 : entryHeaderLength]))
+		if len(data) < entryHeaderLength+attributesLength {
+			return i > 0, errors.New("RIB entry truncated")
+		}
+		attributes := data[entryHeaderLength : entryHeaderLength+attributesLength]
+		data = data[entryHeaderLength+attributesLength:]
+
+		if peerIndex >= len(r.peerIndex) {
+			return i > 0, fmt.Errorf("unknown peer index %d", peerIndex)
+		}
+		peer := r.peerIndex[peerIndex]
+		template, err := bgp.ParseRIBAttributes(attributes)
+		if err != nil {
+			return i > 0, err
+		}
+		template.SessionAttrs.SessionName = peer.Address.String()
+		template.SessionAttrs.NeighborAddress = peer.Address
+		template.SessionAttrs.ImportTime = originated
+		flowSpecRoute, err := nlri.Route(template)
+		if err != nil {
+			return i > 0, err
+		}
+		r.peerRoutes(peer.Address.String())[nlriKey(afi, nlriData)] = flowSpecRoute
+	}
+	return true, nil
+}
+
+// parseBGP4MPHeader returns the peer address and the remaining body of a BGP4MP record
+func parseBGP4MPHeader(record Record) (net.IP, []byte, error) {
+	asLength := 2
+	if record.Subtype == subtypeMessageAS4 || record.Subtype == subtypeMessageAS4Local || record.Subtype == subtypeStateChangeAS4 {
+		asLength = 4
+	}
+	if len(record.Body) < 2*asLength+4 {
+		return nil, nil, errors.New("BGP4MP record truncated")
+	}
+	afi := binary.BigEndian.Uint16(record.Body[2*asLength+2 : 2*asLength+4])
+	addressLength := net.IPv4len
+	if afi == bgp.AFIIPv6 {
+		addressLength = net.IPv6len
+	}
+	data := record.Body[2*asLength+4:]
+	if len(data) < 2*addressLength {
+		return nil, nil, errors.New("BGP4MP record truncated")
+	}
+	return net.IP(data[:addressLength]).To16(), data[2*addressLength:], nil
+}
+
+// applyStateChange removes the routes of a peer whose session left the established state
+func (r *RIB) applyStateChange(record Record) (bool, error) {
+	peer, data, err := parseBGP4MPHeader(record)
+	if err != nil {
+		return false, err
+	}
+	if len(data) < 4 {
+		return false, errors.New("state change record truncated")
+	}
+	_, ok := r.routes[peer.String()]
+	if !ok || binary.BigEndian.Uint16(data[2:4]) == bgpStateEstablished {
+		return false, nil
+	}
+	delete(r.routes, peer.String())
+	return true, nil
+}
+
+// applyMessage applies the flowspec announcements and withdrawals of a recorded BGP UPDATE message
+func (r *RIB) applyMessage(record Record) (bool, error) {
+	peer, data, err := parseBGP4MPHeader(record)
+	if err != nil {
+		return false, err
+	}
+	message, err := bgp.ParseMessage(data)
+	if err != nil {
+		return false, err
+	}
+	if message.Type != bgp.MessageTypeUpdate {
+		return false, nil
+	}
+	asn4 := record.Subtype == subtypeMessageAS4 || record.Subtype == subtypeMessageAS4Local
+	update, err := bgp.ParseUpdate(message.Body, asn4)
+	var treatAsWithdraw bgp.TreatAsWithdrawError
+	if err != nil && !errors.As(err, &treatAsWithdraw) {
+		return false, err
+	}
+
+	if len(update.Announced) == 0 && len(update.Withdrawn) == 0 {
+		return false, err
+	}
+
+	template := update.Route
+	template.SessionAttrs.SessionName = peer.String()
+	template.SessionAttrs.NeighborAddress = peer
+	template.SessionAttrs.ImportTime = record.Timestamp
+	decodeErr := source.UpdateRIB(r.peerRoutes(peer.String()), update.Withdrawn, update.Announced, func(nlri bgp.NLRI) string { return nlriKey(nlri.AFI, nlri.Data) }, func(nlri bgp.NLRI) (route.FlowspecRoute, error) {
+		return bgp.RouteFromNLRI(nlri.AFI, nlri.Data, template)
+	})
+	return true, errors.Join(err, decodeErr)
+}
+
+func (r *RIB) peerRoutes(peer string) map[string]route.FlowspecRoute {
+	routes, ok := r.routes[peer]
+	if !ok {
+		routes = make(map[string]route.FlowspecRoute)
+		r.routes[peer] = routes
+	}
+	return routes
+}
+
+func nlriKey(afi uint16, data []byte) string {
+	return fmt.Sprintf("%d/%x", afi, data)
+}
@@ -0,0 +1,86 @@
+package originate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"bird-flowspec-daemon/internal/source"
+)
+
+// addRequest is the body of requests originating a route
+type addRequest struct {
+	source.StaticRule
+	// TTL is the lifetime of the route as Go duration (e.g. "30m"), routes without TTL do not expire
+	TTL string `json:"ttl"`
+}
+
+// Handler returns the HTTP API of the originator:
+//
+//	GET /routes         lists the originated routes
+//	POST /routes        originates a route
+//	DELETE /routes/{id} withdraws a route
+func (o *Originator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /routes", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, o.Routes())
+	})
+	mux.HandleFunc("POST /routes", func(w http.ResponseWriter, r *http.Request) {
+		var request addRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+			return
+		}
+
+		var ttl time.Duration
+		if request.TTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(request.TTL); err != nil || ttl < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl %q", request.TTL))
+				return
+			}
+		}
+		if _, err := request.StaticRule.Route(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		originated, err := o.Add(r.Context(), request.StaticRule, ttl)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, originated)
+	})
+	mux.HandleFunc("DELETE /routes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		err := o.Withdraw(r.Context(), r.PathValue("id"))
+		switch {
+		case errors.Is(err, ErrNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusBadGateway, err)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Warn("failed to write API response", slog.String("error", err.Error()))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
@@ -0,0 +1,330 @@
+package originate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/source"
+)
+
+// header starts every managed include file
+const header = "# Managed by bird-flowspec-daemon, changes are overwritten\n"
+
+// metadataPrefix starts the comment line carrying the metadata of the following route
+const metadataPrefix = "# route: "
+
+// ErrNotFound is returned for unknown route IDs
+var ErrNotFound = errors.New("route not found")
+
+// Route is a flowspec route originated by the daemon
+type Route struct {
+	ID   string            `json:"id"`
+	Rule source.StaticRule `json:"rule"`
+	// Created is the time the route was originated or last updated
+	Created time.Time `json:"created"`
+	// Expires is the time the route is withdrawn automatically, zero if it does not expire
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// Config configures where originated routes are written to and how BIRD is reconfigured
+type Config struct {
+	// File4 and File6 are the include files of the BIRD static protocols of the flow4 and flow6 channels
+	File4 string
+	File6 string
+	// Configure reloads the BIRD configuration after the include files changed
+	Configure func(ctx context.Context) error
+}
+
+// Originator writes flowspec routes as BIRD static routes into managed include files and keeps track of them
+type Originator struct {
+	config Config
+
+	mu     sync.Mutex
+	routes map[string]Route
+}
+
+// New creates an originator and recovers the routes of existing include files. Missing include files are
+// created empty, as BIRD fails to load configurations including missing files.
+func New(config Config) (*Originator, error) {
+	o := &Originator{
+		config: config,
+		routes: make(map[string]Route),
+	}
+
+	for _, path := range []string{config.File4, config.File6} {
+		routes, err := readFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			if err := writeFile(path, nil); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range routes {
+			o.routes[r.ID] = r
+		}
+	}
+	metrics.OriginatedRoutes.Set(float64(len(o.routes)))
+
+	return o, nil
+}
+
+// Routes returns all originated routes ordered by ID
+func (o *Originator) Routes() []Route {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.sortedRoutes()
+}
+
+// Add originates a route for rule, which expires after ttl unless ttl is 0. A route with the same match
+// attributes is replaced and keeps its ID.
+func (o *Originator) Add(ctx context.Context, rule source.StaticRule, ttl time.Duration) (Route, error) {
+	flowSpecRoute, err := rule.Route()
+	if err != nil {
+		return Route{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	originated := Route{Rule: rule, Created: time.Now().UTC().Truncate(time.Second)}
+	if ttl > 0 {
+		originated.Expires = originated.Created.Add(ttl)
+	}
+	for id, existing := range o.routes {
+		if existingRoute, _ := existing.Rule.Route(); existingRoute.Net() == flowSpecRoute.Net() {
+			originated.ID = id
+		}
+	}
+	if originated.ID == "" {
+		originated.ID = newID()
+	}
+
+	previous, replaced := o.routes[originated.ID]
+	o.routes[originated.ID] = originated
+	if err := o.apply(ctx); err != nil {
+		if replaced {
+			o.routes[originated.ID] = previous
+		} else {
+			delete(o.routes, originated.ID)
+		}
+		return Route{}, err
+	}
+
+	slog.Info("originated flowspec route", slog.String("id", originated.ID), slog.String("net", flowSpecRoute.Net()))
+	return originated, nil
+}
+
+// Withdraw removes the route with the given ID
+func (o *Originator) Withdraw(ctx context.Context, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	withdrawn, ok := o.routes[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(o.routes, id)
+	if err := o.apply(ctx); err != nil {
+		o.routes[id] = withdrawn
+		return err
+	}
+
+	slog.Info("withdrew flowspec route", slog.String("id", id))
+	return nil
+}
+
+// Run withdraws expired routes until ctx is done
+func (o *Originator) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := o.expire(ctx, now); err != nil {
+				slog.Error("error withdrawing expired routes", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// expire withdraws all routes that expired before now
+func (o *Originator) expire(ctx context.Context, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	expired := make(map[string]Route)
+	for id, r := range o.routes {
+		if !r.Expires.IsZero() && !now.Before(r.Expires) {
+			expired[id] = r
+			delete(o.routes, id)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	if err := o.apply(ctx); err != nil {
+		for id, r := range expired {
+			o.routes[id] = r
+		}
+		return err
+	}
+	for id := range expired {
+		slog.Info("withdrew expired flowspec route", slog.String("id", id))
+	}
+	return nil
+}
+
+// apply writes the include files and reconfigures BIRD. The previous files are restored if BIRD rejects
+// the new configuration.
+func (o *Originator) apply(ctx context.Context) error {
+	var routes4, routes6 []Route
+	for _, r := range o.sortedRoutes() {
+		if flowSpecRoute, _ := r.Rule.Route(); flowSpecRoute.IsIPv6() {
+			routes6 = append(routes6, r)
+		} else {
+			routes4 = append(routes4, r)
+		}
+	}
+
+	previous := make(map[string][]byte)
+	for _, file := range []struct {
+		path   string
+		routes []Route
+	}{
+		{o.config.File4, routes4},
+		{o.config.File6, routes6},
+	} {
+		data, err := os.ReadFile(file.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		previous[file.path] = data
+		if err := writeFile(file.path, file.routes); err != nil {
+			return err
+		}
+	}
+
+	if err := o.config.Configure(ctx); err != nil {
+		for path, data := range previous {
+			if restoreErr := writeAtomic(path, data); restoreErr != nil {
+				slog.Error("failed to restore include file", slog.String("path", path), slog.String("error", restoreErr.Error()))
+			}
+		}
+		return err
+	}
+
+	metrics.OriginatedRoutes.Set(float64(len(o.routes)))
+	return nil
+}
+
+func (o *Originator) sortedRoutes() []Route {
+	routes := make([]Route, 0, len(o.routes))
+	for _, r := range o.routes {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+	return routes
+}
+
+// Render renders routes as BIRD static routes preceded by their metadata
+func Render(routes []Route) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(header)
+	for _, r := range routes {
+		flowSpecRoute, err := r.Rule.Route()
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %v", r.ID, err)
+		}
+		metadata, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+
+		rate := float32(flowSpecRoute.Argument)
+		community := route.ExtCommunity(uint64(flowSpecRoute.Action)<<48 | uint64(math.Float32bits(rate)))
+		fmt.Fprintf(&buffer, "%s%s\nroute %s {\n\tbgp_ext_community.add(%s);\n};\n", metadataPrefix, metadata, flowSpecRoute.Net(), community)
+	}
+	return buffer.Bytes(), nil
+}
+
+// readFile recovers the routes of a managed include file from their metadata
+func readFile(path string) ([]Route, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		metadata, found := strings.CutPrefix(scanner.Text(), metadataPrefix)
+		if !found {
+			continue
+		}
+		var r Route
+		if err := json.Unmarshal([]byte(metadata), &r); err != nil {
+			return nil, fmt.Errorf("invalid route metadata in %s: %v", path, err)
+		}
+		routes = append(routes, r)
+	}
+	return routes, scanner.Err()
+}
+
+func writeFile(path string, routes []Route) error {
+	data, err := Render(routes)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data)
+}
+
+// writeAtomic replaces the file at path, so BIRD never reads a partially written file
+func writeAtomic(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(0o644); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func newID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
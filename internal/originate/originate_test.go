@@ -0,0 +1,134 @@
+package originate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/source"
+)
+
+type fakeBird struct {
+	configured int
+	err        error
+}
+
+func (f *fakeBird) configure(context.Context) error {
+	f.configured++
+	return f.err
+}
+
+func newTestOriginator(t *testing.T) (*Originator, *fakeBird, Config) {
+	bird := &fakeBird{}
+	dir := t.TempDir()
+	config := Config{
+		File4:     filepath.Join(dir, "flowspec4.conf"),
+		File6:     filepath.Join(dir, "flowspec6.conf"),
+		Configure: bird.configure,
+	}
+	originator, err := New(config)
+	require.NoError(t, err)
+	return originator, bird, config
+}
+
+func TestOriginator(t *testing.T) {
+	originator, bird, config := newTestOriginator(t)
+	ctx := context.Background()
+
+	for _, path := range []string{config.File4, config.File6} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, header, string(data))
+	}
+
+	ntp, err := originator.Add(ctx, source.StaticRule{Destination: "192.0.2.1/32", Protocol: 17, SourcePort: 123, Action: "drop"}, 0)
+	require.NoError(t, err)
+	limit, err := originator.Add(ctx, source.StaticRule{Destination: "2001:db8::/32", Action: "rate-limit-bytes", Rate: 125000}, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, bird.configured)
+	assert.Equal(t, limit.Created.Add(time.Hour), limit.Expires)
+
+	data, err := os.ReadFile(config.File4)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\nroute flow4 { dst 192.0.2.1/32; proto 17; sport 123; } {\n\tbgp_ext_community.add((generic, 0x80060000, 0x0));\n};\n")
+	data, err = os.ReadFile(config.File6)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\nroute flow6 { dst 2001:db8::/32; } {\n\tbgp_ext_community.add((generic, 0x80060000, 0x47f42400));\n};\n")
+
+	// Routes with identical match attributes are replaced
+	replaced, err := originator.Add(ctx, source.StaticRule{Destination: "192.0.2.1/32", Protocol: 17, SourcePort: 123, Action: "rate-limit-packets", Rate: 10}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ntp.ID, replaced.ID)
+	assert.Len(t, originator.Routes(), 2)
+
+	// Routes are recovered from the include files
+	recovered, err := New(config)
+	require.NoError(t, err)
+	assert.Equal(t, originator.Routes(), recovered.Routes())
+
+	// Rejected configurations restore the previous include files
+	bird.err = errors.New("BIRD rejected the configuration")
+	_, err = originator.Add(ctx, source.StaticRule{Destination: "198.51.100.0/24", Action: "drop"}, 0)
+	assert.Error(t, err)
+	assert.Len(t, originator.Routes(), 2)
+	restored, err := os.ReadFile(config.File6)
+	require.NoError(t, err)
+	assert.Equal(t, data, restored)
+	bird.err = nil
+
+	require.NoError(t, originator.expire(ctx, limit.Expires))
+	assert.Len(t, originator.Routes(), 1)
+
+	require.NoError(t, originator.Withdraw(ctx, ntp.ID))
+	assert.Empty(t, originator.Routes())
+	assert.ErrorIs(t, originator.Withdraw(ctx, ntp.ID), ErrNotFound)
+}
+
+func TestHandler(t *testing.T) {
+	originator, _, _ := newTestOriginator(t)
+	server := httptest.NewServer(originator.Handler())
+	defer server.Close()
+
+	type testCase struct {
+		name   string
+		body   string
+		status int
+	}
+
+	testCases := []testCase{
+		{name: "drop with ttl", body: `{"destination": "192.0.2.1/32", "protocol": 17, "destination-port": 53, "action": "drop", "ttl": "10m"}`, status: http.StatusCreated},
+		{name: "invalid ttl", body: `{"destination": "192.0.2.1/32", "action": "drop", "ttl": "soon"}`, status: http.StatusBadRequest},
+		{name: "invalid rule", body: `{"destination": "192.0.2.1/32", "action": "redirect"}`, status: http.StatusBadRequest},
+		{name: "unknown field", body: `{"destination": "192.0.2.1/32", "action": "drop", "port": 53}`, status: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response, err := http.Post(server.URL+"/routes", "application/json", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.Equal(t, tc.status, response.StatusCode)
+		})
+	}
+
+	routes := originator.Routes()
+	require.Len(t, routes, 1)
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		request, err := http.NewRequest(http.MethodDelete, server.URL+"/routes/"+routes[0].ID, nil)
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, status, response.StatusCode)
+	}
+}
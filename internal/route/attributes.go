@@ -0,0 +1,250 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	tuplePattern  = regexp.MustCompile(`\(([^)]*)\)`)
+	asPathPattern = regexp.MustCompile(`\(\{|\}\)|[{}()]|\d+`)
+)
+
+// parseBGPAttrs parses the BGP attributes of a route from its attribute lines
+func (d Dialect) parseBGPAttrs(attributes map[string]string) (bgpAttrs, error) {
+	var outputBGPAttrs = bgpAttrs{}
+
+	outputBGPAttrs.Origin = attributes[d.attributes[attributeOrigin]]
+
+	asPath, err := parseASPath(attributes[d.attributes[attributeASPath]])
+	if err != nil {
+		return bgpAttrs{}, fmt.Errorf("unable to parse AS path: %v", err)
+	}
+	outputBGPAttrs.ASPath = asPath
+
+	if value, ok := attributes[d.attributes[attributeLocalPref]]; ok {
+		localPref, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return bgpAttrs{}, errors.New("unable to parse local preference")
+		}
+		outputBGPAttrs.LocalPref = uint32(localPref)
+	}
+
+	if value, ok := attributes[d.attributes[attributeMED]]; ok {
+		med, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return bgpAttrs{}, errors.New("unable to parse MED")
+		}
+		outputBGPAttrs.MED = uint32(med)
+	}
+
+	for _, tuple := range parseTuples(attributes[d.attributes[attributeCommunity]]) {
+		values, err := parseUintTuple(tuple, 16, 2)
+		if err != nil {
+			return bgpAttrs{}, fmt.Errorf("unable to parse community: %v", err)
+		}
+		outputBGPAttrs.Communities = append(outputBGPAttrs.Communities, Community{ASN: uint16(values[0]), Value: uint16(values[1])})
+	}
+
+	for _, tuple := range parseTuples(attributes[d.attributes[attributeLargeCommunity]]) {
+		values, err := parseUintTuple(tuple, 32, 3)
+		if err != nil {
+			return bgpAttrs{}, fmt.Errorf("unable to parse large community: %v", err)
+		}
+		outputBGPAttrs.LargeCommunities = append(outputBGPAttrs.LargeCommunities, LargeCommunity{
+			GlobalAdmin: uint32(values[0]),
+			LocalData1:  uint32(values[1]),
+			LocalData2:  uint32(values[2]),
+		})
+	}
+
+	for _, tuple := range parseTuples(attributes[d.attributes[attributeExtCommunity]]) {
+		community, err := parseExtCommunity(tuple)
+		if err != nil {
+			slog.Debug("skipping extended community", slog.String("community", tuple), slog.String("error", err.Error()))
+			continue
+		}
+		outputBGPAttrs.ExtCommunities = append(outputBGPAttrs.ExtCommunities, community)
+	}
+
+	if value, ok := attributes[d.attributes[attributeOriginatorID]]; ok {
+		outputBGPAttrs.OriginatorID = net.ParseIP(value)
+		if outputBGPAttrs.OriginatorID == nil {
+			return bgpAttrs{}, errors.New("unable to parse originator ID")
+		}
+	}
+
+	for _, clusterID := range strings.Fields(attributes[d.attributes[attributeClusterList]]) {
+		ip := net.ParseIP(clusterID)
+		if ip == nil {
+			return bgpAttrs{}, errors.New("unable to parse cluster list")
+		}
+		outputBGPAttrs.ClusterList = append(outputBGPAttrs.ClusterList, ip)
+	}
+
+	return outputBGPAttrs, nil // nil error
+}
+
+// parseASPath parses an AS path as printed by BIRD, e.g. "65002 65001 {65003 65004}". AS sets are enclosed in
+// braces, confederation sequences in parentheses and confederation sets in both.
+func parseASPath(input string) (ASPath, error) {
+	var path ASPath
+	inSegment := false
+	for _, token := range asPathPattern.FindAllString(input, -1) {
+		segmentType, opening, closing := ASSequence, false, false
+		for t, delimiters := range asPathDelimiters {
+			if token == delimiters[0] {
+				segmentType, opening = t, true
+			}
+			if token == delimiters[1] {
+				segmentType, closing = t, true
+			}
+		}
+
+		switch {
+		case opening:
+			if inSegment {
+				return nil, errors.New("nested AS path segment")
+			}
+			path = append(path, ASPathSegment{Type: segmentType})
+			inSegment = true
+		case closing:
+			if !inSegment || path[len(path)-1].Type != segmentType {
+				return nil, fmt.Errorf("unexpected %q", token)
+			}
+			inSegment = false
+		default:
+			asn, err := strconv.ParseUint(token, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			if !inSegment && (len(path) == 0 || path[len(path)-1].Type != ASSequence) {
+				path = append(path, ASPathSegment{Type: ASSequence})
+			}
+			path[len(path)-1].ASNs = append(path[len(path)-1].ASNs, uint32(asn))
+		}
+	}
+	if inSegment {
+		return nil, errors.New("unterminated AS path segment")
+	}
+	return path, nil
+}
+
+// parseTuples returns the contents of all parenthesized tuples, e.g. "(65535,666) (65000,1)"
+func parseTuples(input string) []string {
+	var tuples []string
+	for _, match := range tuplePattern.FindAllStringSubmatch(input, -1) {
+		tuples = append(tuples, match[1])
+	}
+	return tuples
+}
+
+// parseUintTuple parses a comma separated tuple of decimal numbers
+func parseUintTuple(input string, bitSize int, length int) ([]uint64, error) {
+	parts := strings.Split(input, ",")
+	if len(parts) != length {
+		return nil, fmt.Errorf("expected %d values, got %d", length, len(parts))
+	}
+
+	values := make([]uint64, 0, length)
+	for _, part := range parts {
+		value, err := strconv.ParseUint(strings.TrimSpace(part), 10, bitSize)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// parseExtCommunity parses an extended community as printed by BIRD, e.g. "generic, 0x80060000, 0x0" or "rt, 65000, 100".
+// Types BIRD has no name for are printed as e.g. "unknown 0x8, 65000, 100" and kept with their raw type.
+func parseExtCommunity(input string) (ExtCommunity, error) {
+	parts := strings.Split(input, ",")
+	if len(parts) != 3 {
+		return 0, errors.New("invalid extended community")
+	}
+	kind := strings.TrimSpace(parts[0])
+	admin := strings.TrimSpace(parts[1])
+	value := strings.TrimSpace(parts[2])
+
+	switch {
+	case kind == "generic":
+		high, err := strconv.ParseUint(admin, 0, 32)
+		if err != nil {
+			return 0, err
+		}
+		low, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			return 0, err
+		}
+		return ExtCommunity(high<<32 | low), nil
+	case kind == "rt", kind == "ro":
+		var extType uint64 = 0x02
+		if kind == "ro" {
+			extType = 0x03
+		}
+		// The layout follows from the administrator, as BIRD prints the same name for all of them
+		if ip := net.ParseIP(admin).To4(); ip != nil {
+			extType |= 0x01 << 8
+		} else if asn, err := strconv.ParseUint(admin, 10, 32); err == nil && asn > 0xffff {
+			extType |= 0x02 << 8
+		}
+		return specificExtCommunity(extType, admin, value)
+	case strings.HasPrefix(kind, "unknown "):
+		extType, err := strconv.ParseUint(strings.TrimPrefix(kind, "unknown "), 0, 16)
+		if err != nil {
+			return 0, err
+		}
+		return specificExtCommunity(extType, admin, value)
+	default:
+		return 0, fmt.Errorf("unsupported extended community type %q", kind)
+	}
+}
+
+// specificExtCommunity encodes an AS or IPv4 address specific extended community, the layout is selected by the
+// type regardless of the transitive bit (RFC 4360, RFC 5668)
+func specificExtCommunity(extType uint64, admin, value string) (ExtCommunity, error) {
+	switch extType >> 8 &^ 0x40 {
+	case 0x00:
+		// Two-octet AS specific
+		asn, err := strconv.ParseUint(admin, 10, 16)
+		if err != nil {
+			return 0, err
+		}
+		localAdmin, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return ExtCommunity(extType<<48 | asn<<32 | localAdmin), nil
+	case 0x01:
+		// IPv4 address specific
+		ip := net.ParseIP(admin).To4()
+		if ip == nil {
+			return 0, fmt.Errorf("invalid IPv4 address %q", admin)
+		}
+		localAdmin, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return 0, err
+		}
+		return ExtCommunity(extType<<48 | uint64(ip[0])<<40 | uint64(ip[1])<<32 | uint64(ip[2])<<24 | uint64(ip[3])<<16 | localAdmin), nil
+	case 0x02:
+		// Four-octet AS specific
+		asn, err := strconv.ParseUint(admin, 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		localAdmin, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return 0, err
+		}
+		return ExtCommunity(extType<<48 | asn<<16 | localAdmin), nil
+	default:
+		return 0, fmt.Errorf("unsupported extended community type %#x", extType)
+	}
+}
@@ -0,0 +1,142 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseASPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     ASPath
+		originAS uint32
+		wantErr  bool
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name:     "Sequence",
+			input:    "65002 65001",
+			want:     ASPath{{Type: ASSequence, ASNs: []uint32{65002, 65001}}},
+			originAS: 65001,
+		},
+		{
+			name:  "Ending with a set",
+			input: "65002 {65003 65004}",
+			want: ASPath{
+				{Type: ASSequence, ASNs: []uint32{65002}},
+				{Type: ASSet, ASNs: []uint32{65003, 65004}},
+			},
+		},
+		{
+			name:  "Set followed by a sequence",
+			input: "(65100 65101) ({65102}) 65002 {65003} 65004",
+			want: ASPath{
+				{Type: ASConfedSequence, ASNs: []uint32{65100, 65101}},
+				{Type: ASConfedSet, ASNs: []uint32{65102}},
+				{Type: ASSequence, ASNs: []uint32{65002}},
+				{Type: ASSet, ASNs: []uint32{65003}},
+				{Type: ASSequence, ASNs: []uint32{65004}},
+			},
+			originAS: 65004,
+		},
+		{
+			name:  "Confederation only",
+			input: "(65100 65101)",
+			want:  ASPath{{Type: ASConfedSequence, ASNs: []uint32{65100, 65101}}},
+		},
+		{
+			name:    "Unterminated set",
+			input:   "65002 {65003",
+			wantErr: true,
+		},
+		{
+			name:    "Mismatched delimiters",
+			input:   "{65003)",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := parseASPath(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, path)
+			assert.Equal(t, tt.input, path.String())
+			assert.Equal(t, tt.originAS, FlowspecRoute{BGPAttrs: bgpAttrs{ASPath: path}}.OriginAS())
+		})
+	}
+}
+
+func TestParseExtCommunity(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ExtCommunity
+		wantErr bool
+	}{
+		{
+			name:  "Generic",
+			input: "generic, 0x80060000, 0x0",
+			want:  0x8006000000000000,
+		},
+		{
+			name:  "Two-octet AS route target",
+			input: "rt, 65002, 100",
+			want:  0x0002fdea00000064,
+		},
+		{
+			name:  "IPv4 address route origin",
+			input: "ro, 192.0.2.1, 100",
+			want:  0x0103c00002010064,
+		},
+		{
+			name:  "Four-octet AS route target",
+			input: "rt, 200000, 100",
+			want:  0x020200030d400064,
+		},
+		{
+			name:  "Unknown two-octet AS specific",
+			input: "unknown 0x8, 65002, 100",
+			want:  0x0008fdea00000064,
+		},
+		{
+			name:  "Unknown non-transitive IPv4 address specific",
+			input: "unknown 0x4104, 192.0.2.1, 100",
+			want:  0x4104c00002010064,
+		},
+		{
+			name:  "Unknown four-octet AS specific",
+			input: "unknown 0x205, 200000, 100",
+			want:  0x020500030d400064,
+		},
+		{
+			name:    "Unknown type with invalid administrator",
+			input:   "unknown 0x104, 65002, 100",
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported kind",
+			input:   "mac, 00:00:5e:00:53:01, 1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			community, err := parseExtCommunity(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, community)
+		})
+	}
+}
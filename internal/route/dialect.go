@@ -0,0 +1,128 @@
+package route
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of route attributes that differ between BIRD versions
+const (
+	attributeOrigin         = "origin"
+	attributeASPath         = "as_path"
+	attributeLocalPref      = "local_pref"
+	attributeMED            = "med"
+	attributeCommunity      = "community"
+	attributeLargeCommunity = "large_community"
+	attributeExtCommunity   = "ext_community"
+	attributeOriginatorID   = "originator_id"
+	attributeClusterList    = "cluster_list"
+)
+
+// Dialect describes the route output format of a BIRD major version
+type Dialect struct {
+	name       string
+	attributes map[string]string
+	timeFormat TimeFormat
+}
+
+var (
+	// DialectBird2 parses BIRD 2 output, e.g. "BGP.ext_community: (generic, 0x80060000, 0x0)"
+	DialectBird2 = Dialect{
+		name: "bird2",
+		attributes: map[string]string{
+			attributeOrigin:         "BGP.origin",
+			attributeASPath:         "BGP.as_path",
+			attributeLocalPref:      "BGP.local_pref",
+			attributeMED:            "BGP.med",
+			attributeCommunity:      "BGP.community",
+			attributeLargeCommunity: "BGP.large_community",
+			attributeExtCommunity:   "BGP.ext_community",
+			attributeOriginatorID:   "BGP.originator_id",
+			attributeClusterList:    "BGP.cluster_list",
+		},
+	}
+	// DialectBird3 parses BIRD 3 output, e.g. "bgp_ext_community: (generic, 0x80060000, 0x0)"
+	DialectBird3 = Dialect{
+		name: "bird3",
+		attributes: map[string]string{
+			attributeOrigin:         "bgp_origin",
+			attributeASPath:         "bgp_path",
+			attributeLocalPref:      "bgp_local_pref",
+			attributeMED:            "bgp_med",
+			attributeCommunity:      "bgp_community",
+			attributeLargeCommunity: "bgp_large_community",
+			attributeExtCommunity:   "bgp_ext_community",
+			attributeOriginatorID:   "bgp_originator_id",
+			attributeClusterList:    "bgp_cluster_list",
+		},
+	}
+)
+
+func (d Dialect) String() string {
+	return d.name
+}
+
+// WithTimeFormat returns a copy of the dialect that expects import times in the given format
+func (d Dialect) WithTimeFormat(timeFormat TimeFormat) Dialect {
+	d.timeFormat = timeFormat
+	return d
+}
+
+// DialectForVersion returns the parser dialect for a BIRD major version
+func DialectForVersion(major int) (Dialect, error) {
+	switch major {
+	case 2:
+		return DialectBird2, nil
+	case 3:
+		return DialectBird3, nil
+	default:
+		return Dialect{}, fmt.Errorf("unsupported BIRD major version %d (supported: 2, 3)", major)
+	}
+}
+
+// parseAttributeLines parses the "key: value" attribute lines following a route header
+func parseAttributeLines(lines []string) map[string]string {
+	attributes := make(map[string]string)
+	for _, line := range lines {
+		key, value, found := strings.Cut(strings.TrimSpace(stripReplyCode(line)), ":")
+		if !found {
+			continue
+		}
+		attributes[key] = strings.TrimSpace(value)
+	}
+
+	return attributes
+}
+
+// SplitResponse splits a BIRD CLI response into raw flowspec routes. Each raw route starts with the
+// address family ("4" or "6") following the "flow" keyword and contains the attribute lines of the route.
+func SplitResponse(response string) []string {
+	var rawRoutes []string
+	var current *strings.Builder
+	for _, line := range strings.Split(response, "\n") {
+		content := stripReplyCode(line)
+		if strings.HasPrefix(content, "flow4 ") || strings.HasPrefix(content, "flow6 ") {
+			if current != nil {
+				rawRoutes = append(rawRoutes, current.String())
+			}
+			current = &strings.Builder{}
+			current.WriteString(strings.TrimPrefix(content, "flow"))
+			continue
+		}
+		if current == nil || strings.HasPrefix(line, "0000") {
+			continue
+		}
+		// Lines of a new table or other non-indented content end the current route
+		if content != "" && content[0] != ' ' && content[0] != '\t' {
+			rawRoutes = append(rawRoutes, current.String())
+			current = nil
+			continue
+		}
+		current.WriteString("\n" + line)
+	}
+	if current != nil {
+		rawRoutes = append(rawRoutes, current.String())
+	}
+
+	return rawRoutes
+}
@@ -0,0 +1,121 @@
+package route
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialectFixtures(t *testing.T) {
+	flow4Drop := FlowspecRoute{
+		MatchAttrs: matchAttrs{
+			Destination:     func() net.IPNet { _, netw, _ := net.ParseCIDR("192.0.2.1/32"); return *netw }(),
+			Protocol:        17,
+			DestinationPort: 123,
+		},
+		SessionAttrs: sessionAttrs{
+			SessionName:     "flowspec_upstream1",
+			NeighborAddress: net.ParseIP("198.51.100.1"),
+			ImportTime:      time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local),
+		},
+		BGPAttrs: bgpAttrs{
+			Origin:           "IGP",
+			ASPath:           ASPath{{Type: ASSequence, ASNs: []uint32{65002, 65001}}},
+			LocalPref:        100,
+			MED:              10,
+			Communities:      []Community{{ASN: 65535, Value: 666}, {ASN: 65002, Value: 100}},
+			LargeCommunities: []LargeCommunity{{GlobalAdmin: 65002, LocalData1: 1, LocalData2: 2}},
+			ExtCommunities:   []ExtCommunity{0x8006000000000000, 0x0002fdea00000064},
+		},
+		Action:   ActionTrafficRateBytes,
+		Argument: 0,
+	}
+	flow6RateLimit := FlowspecRoute{
+		MatchAttrs: matchAttrs{
+			Source:          func() net.IPNet { _, netw, _ := net.ParseCIDR("2001:db8:1::/128"); return *netw }(),
+			Destination:     func() net.IPNet { _, netw, _ := net.ParseCIDR("2001:db8:2::/128"); return *netw }(),
+			Protocol:        17,
+			DestinationPort: 123,
+		},
+		SessionAttrs: sessionAttrs{
+			NeighborAddress: net.ParseIP("2001:2::3"),
+			SessionName:     "igp_router3",
+			ImportTime:      time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local),
+		},
+		BGPAttrs: bgpAttrs{
+			Origin:         "IGP",
+			LocalPref:      100,
+			ExtCommunities: []ExtCommunity{0x800600004ac80000},
+		},
+		Action:   ActionTrafficRateBytes,
+		Argument: 6553600,
+	}
+	flow6RateLimitBird3 := flow6RateLimit
+	flow6RateLimitBird3.SessionAttrs = sessionAttrs{
+		SessionName:     "igp_rr",
+		NeighborAddress: net.ParseIP("2001:2::2"),
+		ImportTime:      time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local),
+	}
+	flow6RateLimitBird3.BGPAttrs.OriginatorID = net.ParseIP("188.245.118.170")
+	flow6RateLimitBird3.BGPAttrs.ClusterList = []net.IP{net.ParseIP("162.55.169.45")}
+
+	for _, testCase := range []struct {
+		dialect  Dialect
+		expected map[string][]FlowspecRoute
+	}{
+		{
+			dialect: DialectBird2,
+			expected: map[string][]FlowspecRoute{
+				"flow4_drop.txt":       {flow4Drop},
+				"flow6_rate_limit.txt": {flow6RateLimit},
+			},
+		},
+		{
+			dialect: DialectBird3,
+			expected: map[string][]FlowspecRoute{
+				"flow4_drop.txt":       {flow4Drop},
+				"flow6_rate_limit.txt": {flow6RateLimitBird3},
+			},
+		},
+	} {
+		fixtures, err := filepath.Glob(filepath.Join("testdata", testCase.dialect.String(), "*.txt"))
+		require.NoError(t, err)
+		require.Len(t, fixtures, len(testCase.expected))
+
+		for _, fixture := range fixtures {
+			t.Run(testCase.dialect.String()+"/"+filepath.Base(fixture), func(t *testing.T) {
+				expected, ok := testCase.expected[filepath.Base(fixture)]
+				require.True(t, ok, "no expectation for fixture")
+
+				response, err := os.ReadFile(fixture)
+				require.NoError(t, err)
+
+				var routes []FlowspecRoute
+				for _, rawRoute := range SplitResponse(string(response)) {
+					flowSpecRoute, parseError := testCase.dialect.ParseFlowSpecRoute(rawRoute)
+					require.NoError(t, parseError)
+					routes = append(routes, flowSpecRoute)
+				}
+				assert.Equal(t, expected, routes)
+			})
+		}
+	}
+}
+
+func TestDialectForVersion(t *testing.T) {
+	for major, expected := range map[int]Dialect{2: DialectBird2, 3: DialectBird3} {
+		dialect, err := DialectForVersion(major)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.String(), dialect.String())
+	}
+
+	for _, major := range []int{1, 4} {
+		_, err := DialectForVersion(major)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,75 @@
+package route
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IsIPv6 reports whether the route is a flow6 route
+func (r FlowspecRoute) IsIPv6() bool {
+	for _, ip := range []net.IP{r.MatchAttrs.Destination.IP, r.MatchAttrs.Source.IP} {
+		if ip != nil {
+			return ip.To4() == nil
+		}
+	}
+	return false
+}
+
+// Net renders the match attributes of the route in BIRD flow syntax, e.g. "flow4 { dst 192.0.2.1/32; proto 17; }"
+func (r FlowspecRoute) Net() string {
+	var components []string
+	if r.MatchAttrs.Destination.IP != nil {
+		components = append(components, "dst "+r.MatchAttrs.Destination.String())
+	}
+	if r.MatchAttrs.Source.IP != nil {
+		components = append(components, "src "+r.MatchAttrs.Source.String())
+	}
+
+	family := "flow4"
+	protocolKeyword := "proto"
+	if r.IsIPv6() {
+		family = "flow6"
+		protocolKeyword = "next header"
+	}
+	if r.MatchAttrs.Protocol != 0 {
+		components = append(components, fmt.Sprintf("%s %d", protocolKeyword, r.MatchAttrs.Protocol))
+	}
+	if r.MatchAttrs.SourcePort != 0 {
+		components = append(components, fmt.Sprintf("sport %d", r.MatchAttrs.SourcePort))
+	}
+	if r.MatchAttrs.DestinationPort != 0 {
+		components = append(components, fmt.Sprintf("dport %d", r.MatchAttrs.DestinationPort))
+	}
+
+	if len(components) == 0 {
+		return family + " { }"
+	}
+	return fmt.Sprintf("%s { %s; }", family, strings.Join(components, "; "))
+}
+
+// Summary returns the diagnostic summary of a parsed route
+func (r FlowspecRoute) Summary() Summary {
+	summary := Summary{
+		Net:        r.Net(),
+		Protocol:   r.SessionAttrs.SessionName,
+		Attributes: []string{},
+		Source:     r.SessionAttrs.Source,
+	}
+
+	if r.BGPAttrs.Origin != "" {
+		summary.Attributes = append(summary.Attributes, "bgp_origin: "+r.BGPAttrs.Origin)
+	}
+	if len(r.BGPAttrs.ASPath) > 0 {
+		summary.Attributes = append(summary.Attributes, "bgp_path: "+r.BGPAttrs.ASPath.String())
+	}
+	if len(r.BGPAttrs.ExtCommunities) > 0 {
+		var communities []string
+		for _, community := range r.BGPAttrs.ExtCommunities {
+			communities = append(communities, community.String())
+		}
+		summary.Attributes = append(summary.Attributes, "bgp_ext_community: "+strings.Join(communities, " "))
+	}
+
+	return summary
+}
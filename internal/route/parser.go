@@ -10,11 +10,12 @@ import (
 	"strings"
 )
 
-func ParseFlowSpecRoute(input string) (FlowspecRoute, error) {
+// ParseFlowSpecRoute parses a raw route as returned by SplitResponse in the output format of the dialect
+func (d Dialect) ParseFlowSpecRoute(input string) (FlowspecRoute, error) {
 	parts := strings.Split(input, "\n")
 
 	header := "flow" + parts[0]
-	localSessionAttrs, err := parseSessionAttrs(inclusiveMatch(header, "[", "]"))
+	localSessionAttrs, err := d.parseSessionAttrs(inclusiveMatch(header, "[", "]"))
 	if err != nil {
 		return FlowspecRoute{}, fmt.Errorf("invalid flowspec route: (%s): %v\n", header, err)
 	}
@@ -24,7 +25,12 @@ func ParseFlowSpecRoute(input string) (FlowspecRoute, error) {
 		return FlowspecRoute{}, fmt.Errorf("invalid flowspec route: (%s): %v\n", header, err)
 	}
 
-	action, arg, err := parseFlowCommunity(inclusiveMatch(input, "ext_community: (", ")"))
+	localBGPAttrs, err := d.parseBGPAttrs(parseAttributeLines(parts[1:]))
+	if err != nil {
+		return FlowspecRoute{}, fmt.Errorf("invalid flowspec route: (%s): %v\n", header, err)
+	}
+
+	action, arg, err := ActionFromExtCommunities(localBGPAttrs.ExtCommunities)
 	if err != nil {
 		return FlowspecRoute{}, fmt.Errorf("invalid flowspec route: (%s): %v\n", header, err)
 	}
@@ -32,6 +38,7 @@ func ParseFlowSpecRoute(input string) (FlowspecRoute, error) {
 	route := FlowspecRoute{
 		MatchAttrs:   localMatchAttrs,
 		SessionAttrs: localSessionAttrs,
+		BGPAttrs:     localBGPAttrs,
 		Action:       action,
 		Argument:     arg,
 	}
@@ -48,43 +55,44 @@ func inclusiveMatch(input string, leftDelimiter string, rightDelimiter string) s
 	return strings.Split(leftSide[1], rightDelimiter)[0]
 }
 
-// parseCommunity parses a BGP community string into a flowspec action and attribute
-func parseFlowCommunity(input string) (int64, int64, error) {
-	parts := strings.Split(input, ", ")
-	if len(parts) != 3 {
-		return -1, -1, errors.New("invalid community string")
+// ActionFromExtCommunities returns the flowspec action and argument of the first traffic filtering
+// action extended community (RFC 8955 section 7)
+func ActionFromExtCommunities(communities []ExtCommunity) (int64, int64, error) {
+	for _, community := range communities {
+		action := int64(community.Type())
+		switch action {
+		case ActionTrafficRateBytes, ActionTrafficRatePackets:
+			// The rate is encoded as ieee754 float in the lower 4 bytes
+			return action, int64(parseIEEE754Float(community.Low())), nil // nil error
+		case ActionTrafficAction, ActionRedirect, ActionTrafficMarking:
+			return action, int64(community.Low()), nil // nil error
+		}
 	}
 
-	// Parse action as int
-	actionPart := strings.TrimSuffix(parts[1], "0000")
-	action, err := strconv.ParseInt(actionPart, 0, 64)
-	if err != nil {
-		return -1, -1, errors.New("invalid community string: " + err.Error())
-	}
+	return -1, -1, errors.New("no flowspec action community")
+}
 
-	// Validate action
-	if !(action == ActionTrafficRateBytes || action == ActionTrafficRatePackets || action == ActionTrafficAction || action == ActionRedirect || action == ActionTrafficMarking) {
-		return -1, -1, errors.New("invalid flowspec action")
-	}
+// parseIEEE754Float converts the bits of an ieee754 single precision float, e.g. the rate of a traffic-rate
+// extended community, into its value
+func parseIEEE754Float(bits uint32) float32 {
+	return math.Float32frombits(bits)
+}
 
-	switch action {
-	case ActionTrafficRateBytes, ActionTrafficRatePackets:
-		// Parse argument as ieee754 float
-		argPart := parts[2]
-		arg, err := parseIEEE754Float(argPart)
-		if err != nil {
-			return -1, -1, errors.New("invalid community string: " + err.Error())
-		}
-		return action, int64(arg), nil // nil error
-	default:
-		// Parse argument as int
-		argPart := strings.TrimSuffix(parts[2], "0000")
-		arg, err := strconv.ParseInt(argPart, 0, 64)
-		if err != nil {
-			return -1, -1, errors.New("invalid community string: " + err.Error())
+// InterfaceSetsFromExtCommunities returns the interface sets of the interface-set extended communities. The
+// lower 16 bits of the community hold the egress (O) and ingress (I) flags followed by the 14 bit group.
+func InterfaceSetsFromExtCommunities(communities []ExtCommunity) []InterfaceSet {
+	var interfaceSets []InterfaceSet
+	for _, community := range communities {
+		if community.Type() != ExtCommunityInterfaceSet {
+			continue
 		}
-		return action, arg, nil // nil error
+		interfaceSets = append(interfaceSets, InterfaceSet{
+			Group:   uint16(community & 0x3fff),
+			Ingress: community&0x4000 != 0,
+			Egress:  community&0x8000 != 0,
+		})
 	}
+	return interfaceSets
 }
 
 func parseMatchAttrs(input string) (matchAttrs, error) {
@@ -119,7 +127,7 @@ func parseMatchAttrs(input string) (matchAttrs, error) {
 					return matchAttrs{}, errors.New("unable to parse destination port")
 				}
 				outputMatchAttrs.DestinationPort = uint16(localDPort)
-			case "next_header":
+			case "proto", "next_header":
 				protocol, protocolParseError := strconv.ParseUint(value, 0, 8)
 				if protocolParseError != nil {
 					return matchAttrs{}, errors.New("unable to parse protocol")
@@ -134,20 +142,38 @@ func parseMatchAttrs(input string) (matchAttrs, error) {
 	return outputMatchAttrs, nil // nil error
 }
 
-// parseSessionAttrs parses the BIRD session attributes
-func parseSessionAttrs(input string) (sessionAttrs, error) {
+// parseSessionAttrs parses the BIRD session attributes, e.g. "upstream1 2025-01-13 12:00:00 from 192.0.2.1"
+func (d Dialect) parseSessionAttrs(input string) (sessionAttrs, error) {
 	var outputSessionAttrs = sessionAttrs{}
 
 	parts := strings.Split(input, " ")
-	if len(parts) != 4 {
+	if len(parts) < 2 {
 		return sessionAttrs{}, errors.New("invalid token length")
 	}
 
-	// Set string values
+	// Locally originated routes (e.g. from a static protocol) carry no neighbor
+	timeParts := parts[1:]
+	hasNeighbor := len(parts) >= 4 && parts[len(parts)-2] == "from"
+	if hasNeighbor {
+		timeParts = parts[1 : len(parts)-2]
+	}
+	if len(timeParts) < 1 || len(timeParts) > 2 {
+		return sessionAttrs{}, errors.New("invalid token length")
+	}
+
+	importTime, err := d.timeFormat.parse(strings.Join(timeParts, " "))
+	if err != nil {
+		return sessionAttrs{}, err
+	}
+
 	outputSessionAttrs.SessionName = parts[0]
-	outputSessionAttrs.ImportTime = parts[1]
+	outputSessionAttrs.ImportTime = importTime
 
-	ip := net.ParseIP(parts[3])
+	if !hasNeighbor {
+		return outputSessionAttrs, nil // nil error
+	}
+
+	ip := net.ParseIP(parts[len(parts)-1])
 	if ip == nil {
 		return sessionAttrs{}, errors.New("invalid neighbor IP address")
 	}
@@ -156,20 +182,3 @@ func parseSessionAttrs(input string) (sessionAttrs, error) {
 
 	return outputSessionAttrs, nil // nil error
 }
-
-func parseIEEE754Float(hexStr string) (float32, error) {
-	// Remove any "0x" or "0X" prefix from the string
-	hexStr = strings.TrimPrefix(hexStr, "0x")
-	hexStr = strings.TrimPrefix(hexStr, "0X")
-
-	// Parse the hex string into a uint32
-	bits, err := strconv.ParseUint(hexStr, 16, 32)
-	if err != nil {
-		return 0, fmt.Errorf("invalid hex string: %v", err)
-	}
-
-	// Convert the bits into a float32 using math.Float32frombits
-	floatValue := math.Float32frombits(uint32(bits))
-
-	return floatValue, nil
-}
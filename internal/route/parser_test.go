@@ -3,6 +3,7 @@ package route
 import (
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -10,19 +11,22 @@ import (
 func TestParseFlowSpecRoute(t *testing.T) {
 	for _, testCase := range []struct {
 		name        string
+		dialect     Dialect
 		in          string
 		expectedOut FlowspecRoute
 		expectedErr bool
 	}{
 		{
 			name:        "empty input",
+			dialect:     DialectBird2,
 			in:          "",
 			expectedOut: FlowspecRoute{},
 			expectedErr: true,
 		},
 		{
-			name: "bird2 sample route",
-			in:   "flow6 { dst 2001:db8:2::/128; src 2001:db8:1::/128; next header 17; dport 123; }  [igp_router3 2025-01-13 from 2001:2::3] * (100) [i]\n\tType: BGP univ\n\tBGP.origin: IGP\n\tBGP.as_path: \n\tBGP.local_pref: 100\n\tBGP.ext_community: (generic, 0x80060000, 0x4ac80000)",
+			name:    "bird2 sample route",
+			dialect: DialectBird2,
+			in:      "flow6 { dst 2001:db8:2::/128; src 2001:db8:1::/128; next header 17; dport 123; }  [igp_router3 2025-01-13 from 2001:2::3] * (100) [i]\n\tType: BGP univ\n\tBGP.origin: IGP\n\tBGP.as_path: \n\tBGP.local_pref: 100\n\tBGP.ext_community: (generic, 0x80060000, 0x4ac80000)",
 			expectedOut: FlowspecRoute{
 				MatchAttrs: matchAttrs{
 					Source:          func() net.IPNet { _, netw, _ := net.ParseCIDR("2001:db8:1::/128"); return *netw }(),
@@ -34,16 +38,22 @@ func TestParseFlowSpecRoute(t *testing.T) {
 				SessionAttrs: sessionAttrs{
 					SessionName:     "igp_router3",
 					NeighborAddress: net.ParseIP("2001:2::3"),
-					ImportTime:      "2025-01-13",
+					ImportTime:      time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local),
+				},
+				BGPAttrs: bgpAttrs{
+					Origin:         "IGP",
+					LocalPref:      100,
+					ExtCommunities: []ExtCommunity{0x800600004ac80000},
 				},
 				Action:   ActionTrafficRateBytes,
-				Argument: func() int64 { f, _ := parseIEEE754Float("0x4ac80000"); return int64(f) }(),
+				Argument: 6553600,
 			},
 			expectedErr: false,
 		},
 		{
-			name: "bird3 sample route",
-			in:   "flow6 { dst 2001:db8:2::/128; src 2001:db8:1::/128; next header 17; dport 123; } unknown [igp_rr 2025-01-13 from 2001:2::2] * (100) [i]\n\tpreference: 100\n\tfrom: 2001:2::2\n\tsource: BGP\n\tbgp_origin: IGP\n\tbgp_path: \n\tbgp_local_pref: 100\n\tbgp_originator_id: 188.245.118.170\n\tbgp_cluster_list: 162.55.169.45\n\tbgp_ext_community: (generic, 0x80060000, 0x4ac80000)\n\tInternal route handling values: 0L 7G 1S id 1",
+			name:    "bird3 sample route",
+			dialect: DialectBird3,
+			in:      "flow6 { dst 2001:db8:2::/128; src 2001:db8:1::/128; next header 17; dport 123; } unknown [igp_rr 2025-01-13 from 2001:2::2] * (100) [i]\n\tpreference: 100\n\tfrom: 2001:2::2\n\tsource: BGP\n\tbgp_origin: IGP\n\tbgp_path: \n\tbgp_local_pref: 100\n\tbgp_originator_id: 188.245.118.170\n\tbgp_cluster_list: 162.55.169.45\n\tbgp_ext_community: (generic, 0x80060000, 0x4ac80000)\n\tInternal route handling values: 0L 7G 1S id 1",
 			expectedOut: FlowspecRoute{
 				MatchAttrs: matchAttrs{
 					Source:          func() net.IPNet { _, netw, _ := net.ParseCIDR("2001:db8:1::/128"); return *netw }(),
@@ -55,16 +65,80 @@ func TestParseFlowSpecRoute(t *testing.T) {
 				SessionAttrs: sessionAttrs{
 					SessionName:     "igp_rr",
 					NeighborAddress: net.ParseIP("2001:2::2"),
-					ImportTime:      "2025-01-13",
+					ImportTime:      time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local),
+				},
+				BGPAttrs: bgpAttrs{
+					Origin:         "IGP",
+					LocalPref:      100,
+					OriginatorID:   net.ParseIP("188.245.118.170"),
+					ClusterList:    []net.IP{net.ParseIP("162.55.169.45")},
+					ExtCommunities: []ExtCommunity{0x800600004ac80000},
 				},
 				Action:   ActionTrafficRateBytes,
-				Argument: func() int64 { f, _ := parseIEEE754Float("0x4ac80000"); return int64(f) }(),
+				Argument: 6553600,
 			},
 			expectedErr: false,
 		},
+		{
+			name:    "bird2 static route",
+			dialect: DialectBird2,
+			in:      "flow4 { dst 192.0.2.0/24; next header 17; dport 53; }  [flowspec_static 2025-01-13] * (200)\n\tType: static univ\n\tBGP.ext_community: (generic, 0x80060000, 0x0)",
+			expectedOut: FlowspecRoute{
+				MatchAttrs: matchAttrs{
+					Destination:     func() net.IPNet { _, netw, _ := net.ParseCIDR("192.0.2.0/24"); return *netw }(),
+					Protocol:        17,
+					DestinationPort: 53,
+				},
+				SessionAttrs: sessionAttrs{
+					SessionName: "flowspec_static",
+					ImportTime:  time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local),
+				},
+				BGPAttrs: bgpAttrs{
+					ExtCommunities: []ExtCommunity{0x8006000000000000},
+				},
+				Action:   ActionTrafficRateBytes,
+				Argument: 0,
+			},
+			expectedErr: false,
+		},
+		{
+			name:    "bird2 route with iso long ms import time",
+			dialect: DialectBird2.WithTimeFormat(TimeFormatISOLongMs),
+			in:      "flow4 { dst 192.0.2.0/24; }  [upstream1 2025-01-13 08:15:00.125 from 198.51.100.1] * (100) [i]\n\tType: BGP univ\n\tBGP.ext_community: (generic, 0x80060000, 0x0)",
+			expectedOut: FlowspecRoute{
+				MatchAttrs: matchAttrs{
+					Destination: func() net.IPNet { _, netw, _ := net.ParseCIDR("192.0.2.0/24"); return *netw }(),
+				},
+				SessionAttrs: sessionAttrs{
+					SessionName:     "upstream1",
+					NeighborAddress: net.ParseIP("198.51.100.1"),
+					ImportTime:      time.Date(2025, 1, 13, 8, 15, 0, 125000000, time.Local),
+				},
+				BGPAttrs: bgpAttrs{
+					ExtCommunities: []ExtCommunity{0x8006000000000000},
+				},
+				Action:   ActionTrafficRateBytes,
+				Argument: 0,
+			},
+			expectedErr: false,
+		},
+		{
+			name:        "bird2 route with unexpected import time format",
+			dialect:     DialectBird2.WithTimeFormat(TimeFormatISOShort),
+			in:          "flow4 { dst 192.0.2.0/24; }  [upstream1 2025-01-13 from 198.51.100.1] * (100) [i]\n\tType: BGP univ\n\tBGP.ext_community: (generic, 0x80060000, 0x0)",
+			expectedOut: FlowspecRoute{},
+			expectedErr: true,
+		},
+		{
+			name:        "bird3 route with bird2 dialect",
+			dialect:     DialectBird2,
+			in:          "flow6 { dst 2001:db8:2::/128; } unknown [igp_rr 2025-01-13 from 2001:2::2] * (100) [i]\n\tpreference: 100\n\tbgp_ext_community: (generic, 0x80060000, 0x4ac80000)",
+			expectedOut: FlowspecRoute{},
+			expectedErr: true,
+		},
 	} {
 		t.Run(testCase.name, func(t *testing.T) {
-			out, parseError := ParseFlowSpecRoute(testCase.in)
+			out, parseError := testCase.dialect.ParseFlowSpecRoute(testCase.in)
 			assert.Equal(t, testCase.expectedOut, out)
 
 			if testCase.expectedErr {
@@ -76,55 +150,122 @@ func TestParseFlowSpecRoute(t *testing.T) {
 	}
 }
 
+func TestActionFromExtCommunities(t *testing.T) {
+	tests := []struct {
+		name         string
+		communities  []ExtCommunity
+		wantAction   int64
+		wantArgument int64
+		wantErr      bool
+	}{
+		{
+			name:         "Rate limit one byte",
+			communities:  []ExtCommunity{0x800600003f800000},
+			wantAction:   ActionTrafficRateBytes,
+			wantArgument: 1,
+		},
+		{
+			name:         "Rate limit big number",
+			communities:  []ExtCommunity{0x800600004ac80000},
+			wantAction:   ActionTrafficRateBytes,
+			wantArgument: 6553600,
+		},
+		{
+			name:         "Rate limit zero packets",
+			communities:  []ExtCommunity{0x800c000000000000},
+			wantAction:   ActionTrafficRatePackets,
+			wantArgument: 0,
+		},
+		{
+			name:         "First action after route target",
+			communities:  []ExtCommunity{0x0002fdea00000064, 0x800900000000002e},
+			wantAction:   ActionTrafficMarking,
+			wantArgument: 0x2e,
+		},
+		{
+			name:        "No action",
+			communities: []ExtCommunity{0x0002fdea00000064},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, argument, err := ActionFromExtCommunities(tt.communities)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ActionFromExtCommunities() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if action != tt.wantAction || argument != tt.wantArgument {
+				t.Errorf("ActionFromExtCommunities() got = %#x, %v, want %#x, %v", action, argument, tt.wantAction, tt.wantArgument)
+			}
+		})
+	}
+}
+
 func Test_parseIEEE754Float(t *testing.T) {
 	type args struct {
-		hexStr string
+		bits uint32
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    float32
-		wantErr bool
+		name string
+		args args
+		want float32
 	}{
 		{
-			name: "Without prefix",
+			name: "One",
 			args: args{
-				hexStr: "3f800000",
+				bits: 0x3f800000,
 			},
 			want: 1.0,
 		},
 		{
-			name: "With prefix",
+			name: "Fraction",
 			args: args{
-				hexStr: "0x3f800000",
+				bits: 0x3f000000,
 			},
-			want: 1.0,
+			want: 0.5,
 		},
 		{
 			name: "Big number",
 			args: args{
-				hexStr: "0x4ac80000",
+				bits: 0x4ac80000,
 			},
 			want: 6553600,
 		},
 		{
 			name: "Zero",
 			args: args{
-				hexStr: "0x00000000",
+				bits: 0x00000000,
 			},
 			want: 0,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseIEEE754Float(tt.args.hexStr)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseIEEE754Float() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.want {
+			if got := parseIEEE754Float(tt.args.bits); got != tt.want {
 				t.Errorf("parseIEEE754Float() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestInterfaceSetsFromExtCommunities(t *testing.T) {
+	communities := []ExtCommunity{
+		0x8006000000000000,
+		// AS 65001, ingress, group 7
+		0x07020000fde94007,
+		// AS 65001, egress, group 0x3fff
+		0x07020000fde9bfff,
+		// AS 65001, both directions, group 1
+		0x07020000fde9c001,
+	}
+	assert.Equal(t, []InterfaceSet{
+		{Group: 7, Ingress: true},
+		{Group: 0x3fff, Egress: true},
+		{Group: 1, Ingress: true, Egress: true},
+	}, InterfaceSetsFromExtCommunities(communities))
+	assert.Nil(t, InterfaceSetsFromExtCommunities(communities[:1]))
+}
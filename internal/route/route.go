@@ -1,7 +1,11 @@
 package route
 
 import (
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type matchAttrs struct {
@@ -10,21 +14,139 @@ type matchAttrs struct {
 	Protocol        uint64
 	SourcePort      uint16
 	DestinationPort uint16
+	// InputInterfaces and OutputInterfaces are the interfaces of the interface sets of the route, resolved by
+	// the daemon. Routes apply to all interfaces if empty.
+	InputInterfaces  []string
+	OutputInterfaces []string
 }
 
 type sessionAttrs struct {
 	SessionName     string
 	NeighborAddress net.IP
-	ImportTime      string
+	ImportTime      time.Time
+	// Source is the name of the daemon route source that provided the route
+	Source string
+	// Table is the BIRD table the route was queried from, empty for the default table and other sources
+	Table string
+}
+
+// Community is a standard BGP community (RFC 1997)
+type Community struct {
+	ASN   uint16
+	Value uint16
+}
+
+// LargeCommunity is a BGP large community (RFC 8092)
+type LargeCommunity struct {
+	GlobalAdmin uint32
+	LocalData1  uint32
+	LocalData2  uint32
+}
+
+// ExtCommunity is a BGP extended community (RFC 4360) in its 8 byte wire representation
+type ExtCommunity uint64
+
+// Type returns the type and sub-type of the extended community
+func (c ExtCommunity) Type() uint16 {
+	return uint16(c >> 48)
+}
+
+// High returns the upper 32 bits as printed by BIRD for generic extended communities
+func (c ExtCommunity) High() uint32 {
+	return uint32(c >> 32)
+}
+
+// Low returns the lower 32 bits as printed by BIRD for generic extended communities
+func (c ExtCommunity) Low() uint32 {
+	return uint32(c)
+}
+
+func (c ExtCommunity) String() string {
+	return fmt.Sprintf("(generic, 0x%x, 0x%x)", c.High(), c.Low())
+}
+
+// ASPathSegmentType is the type of an AS path segment (RFC 4271, RFC 5065)
+type ASPathSegmentType uint8
+
+const (
+	ASSet            ASPathSegmentType = 1
+	ASSequence       ASPathSegmentType = 2
+	ASConfedSequence ASPathSegmentType = 3
+	ASConfedSet      ASPathSegmentType = 4
+)
+
+// asPathDelimiters are the delimiters BIRD prints around the AS numbers of a segment type
+var asPathDelimiters = map[ASPathSegmentType][2]string{
+	ASSet:            {"{", "}"},
+	ASConfedSequence: {"(", ")"},
+	ASConfedSet:      {"({", "})"},
+}
+
+// ASPathSegment is an ordered sequence or an unordered set of AS numbers of an AS path
+type ASPathSegment struct {
+	Type ASPathSegmentType
+	ASNs []uint32
+}
+
+// ASPath is the AS path of a route as list of segments
+type ASPath []ASPathSegment
+
+// String returns the AS path as printed by BIRD, e.g. "65002 65001 {65003 65004}"
+func (p ASPath) String() string {
+	var parts []string
+	for _, segment := range p {
+		var asns []string
+		for _, asn := range segment.ASNs {
+			asns = append(asns, strconv.FormatUint(uint64(asn), 10))
+		}
+		delimiters := asPathDelimiters[segment.Type]
+		parts = append(parts, delimiters[0]+strings.Join(asns, " ")+delimiters[1])
+	}
+	return strings.Join(parts, " ")
+}
+
+type bgpAttrs struct {
+	Origin           string
+	ASPath           ASPath
+	LocalPref        uint32
+	MED              uint32
+	Communities      []Community
+	LargeCommunities []LargeCommunity
+	ExtCommunities   []ExtCommunity
+	OriginatorID     net.IP
+	ClusterList      []net.IP
 }
 
 type FlowspecRoute struct {
 	MatchAttrs   matchAttrs
 	SessionAttrs sessionAttrs
+	BGPAttrs     bgpAttrs
 	Action       int64
 	Argument     int64
 }
 
+// Age returns the time since the route was imported, or 0 if the import time is unknown
+func (r FlowspecRoute) Age(now time.Time) time.Duration {
+	if r.SessionAttrs.ImportTime.IsZero() {
+		return 0
+	}
+	return now.Sub(r.SessionAttrs.ImportTime)
+}
+
+// OriginAS returns the AS that originated the route, or 0 for routes originated in the local AS or
+// confederation and for routes whose AS path ends with an AS set, as aggregates have no single origin
+// (RFC 6811)
+func (r FlowspecRoute) OriginAS() uint32 {
+	if len(r.BGPAttrs.ASPath) == 0 {
+		return 0
+	}
+	last := r.BGPAttrs.ASPath[len(r.BGPAttrs.ASPath)-1]
+	if last.Type != ASSequence || len(last.ASNs) == 0 {
+		return 0
+	}
+	return last.ASNs[len(last.ASNs)-1]
+}
+
 // See rfc 8955
 // https://datatracker.ietf.org/doc/html/rfc8955#traffic_extended_communities
 const (
@@ -34,3 +156,14 @@ const (
 	ActionRedirect           = 0x8008
 	ActionTrafficMarking     = 0x8009
 )
+
+// ExtCommunityInterfaceSet is the type and sub-type of the interface-set extended community
+// https://datatracker.ietf.org/doc/html/draft-ietf-idr-flowspec-interfaceset
+const ExtCommunityInterfaceSet = 0x0702
+
+// InterfaceSet is a group of interfaces a flowspec route applies to, on ingress, egress or both
+type InterfaceSet struct {
+	Group   uint16
+	Ingress bool
+	Egress  bool
+}
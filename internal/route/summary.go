@@ -0,0 +1,55 @@
+package route
+
+import (
+	"strings"
+)
+
+// Summary is a loosely parsed route that is used for diagnostics of routes the daemon does not enforce
+type Summary struct {
+	Net        string   `json:"net"`
+	Protocol   string   `json:"protocol"`
+	Attributes []string `json:"attributes"`
+	Source     string   `json:"source,omitempty"`
+}
+
+// ParseSummary extracts the net, protocol and attribute lines of a route without validating them
+func ParseSummary(input string) Summary {
+	parts := strings.Split(input, "\n")
+
+	header := "flow" + parts[0]
+	summary := Summary{
+		Net:        strings.TrimSpace(strings.SplitAfter(header, "}")[0]),
+		Attributes: []string{},
+	}
+	if sessionFields := strings.Fields(inclusiveMatch(header, "[", "]")); len(sessionFields) > 0 {
+		summary.Protocol = sessionFields[0]
+	}
+
+	for _, line := range parts[1:] {
+		line = strings.TrimSpace(stripReplyCode(line))
+		if line == "" || strings.HasPrefix(line, "0000") {
+			continue
+		}
+		summary.Attributes = append(summary.Attributes, line)
+	}
+
+	return summary
+}
+
+// stripReplyCode removes the BIRD CLI reply code (e.g. "1008-") or continuation marker from a line
+func stripReplyCode(line string) string {
+	if len(line) >= 5 && (line[4] == '-' || line[4] == ' ') {
+		isCode := true
+		for _, char := range line[:4] {
+			if char < '0' || char > '9' {
+				isCode = false
+				break
+			}
+		}
+		if isCode {
+			return line[5:]
+		}
+	}
+
+	return strings.TrimPrefix(line, " ")
+}
@@ -0,0 +1,39 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSummary(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		in          string
+		expectedOut Summary
+	}{
+		{
+			name:        "empty input",
+			in:          "",
+			expectedOut: Summary{Net: "flow", Attributes: []string{}},
+		},
+		{
+			name: "bird cli output with reply codes",
+			in:   "4 { dst 192.0.2.1/32; } [upstream1 2025-01-13 from 198.51.100.1] * (100) [AS65001i]\n1008-\tType: BGP univ\n1012-\tBGP.origin: IGP\n \tBGP.as_path: 65001\n \tBGP.ext_community: (generic, 0x80060000, 0x0)\n0000 \n",
+			expectedOut: Summary{
+				Net:      "flow4 { dst 192.0.2.1/32; }",
+				Protocol: "upstream1",
+				Attributes: []string{
+					"Type: BGP univ",
+					"BGP.origin: IGP",
+					"BGP.as_path: 65001",
+					"BGP.ext_community: (generic, 0x80060000, 0x0)",
+				},
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedOut, ParseSummary(testCase.in))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeFormat is the BIRD `timeformat route` setting the import time of routes is printed in
+type TimeFormat string
+
+const (
+	// TimeFormatAuto accepts all formats below
+	TimeFormatAuto TimeFormat = "auto"
+	// TimeFormatDate is a date only, BIRD prints it for routes older than 20 hours by default
+	TimeFormatDate TimeFormat = "date"
+	// TimeFormatISOShort is "iso short" (%T), the time of day without date
+	TimeFormatISOShort TimeFormat = "iso-short"
+	// TimeFormatISOShortMs is "iso short ms" (%T.%3f)
+	TimeFormatISOShortMs TimeFormat = "iso-short-ms"
+	// TimeFormatISOLong is "iso long" (%F %T)
+	TimeFormatISOLong TimeFormat = "iso-long"
+	// TimeFormatISOLongMs is "iso long ms" (%F %T.%3f)
+	TimeFormatISOLongMs TimeFormat = "iso-long-ms"
+)
+
+var timeFormatLayouts = map[TimeFormat]string{
+	TimeFormatDate:       "2006-01-02",
+	TimeFormatISOShort:   "15:04:05",
+	TimeFormatISOShortMs: "15:04:05.000",
+	TimeFormatISOLong:    "2006-01-02 15:04:05",
+	TimeFormatISOLongMs:  "2006-01-02 15:04:05.000",
+}
+
+// TimeFormats lists all supported time formats
+var TimeFormats = []string{
+	string(TimeFormatAuto),
+	string(TimeFormatDate),
+	string(TimeFormatISOShort),
+	string(TimeFormatISOShortMs),
+	string(TimeFormatISOLong),
+	string(TimeFormatISOLongMs),
+}
+
+// HasTimeOfDay reports whether import times of the format carry the time of day. Date-only import times are
+// taken as midnight, so ages derived from them may be off by up to a day.
+func (f TimeFormat) HasTimeOfDay() bool {
+	return f != TimeFormatDate
+}
+
+// now is replaced in tests
+var now = time.Now
+
+// parse parses a BIRD timestamp in the local time zone. Timestamps without date refer to the last 24 hours.
+func (f TimeFormat) parse(value string) (time.Time, error) {
+	var layouts []string
+	switch f {
+	case TimeFormatAuto, "":
+		for _, format := range TimeFormats[1:] {
+			layouts = append(layouts, timeFormatLayouts[TimeFormat(format)])
+		}
+	default:
+		layout, ok := timeFormatLayouts[f]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unknown time format %q", f)
+		}
+		layouts = []string{layout}
+	}
+
+	for _, layout := range layouts {
+		parsed, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(layout, "2006") {
+			return parsed, nil // nil error
+		}
+
+		// Only the time of day is known, complete it with the current date
+		current := now()
+		parsed = time.Date(current.Year(), current.Month(), current.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), parsed.Nanosecond(), time.Local)
+		if parsed.After(current) {
+			parsed = parsed.AddDate(0, 0, -1)
+		}
+		return parsed, nil // nil error
+	}
+
+	return time.Time{}, errors.New("unable to parse import time " + value)
+}
@@ -0,0 +1,99 @@
+package route
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeFormatParse(t *testing.T) {
+	now = func() time.Time { return time.Date(2025, 1, 13, 12, 0, 0, 0, time.Local) }
+	defer func() { now = time.Now }()
+
+	for _, testCase := range []struct {
+		name        string
+		format      TimeFormat
+		in          string
+		expectedOut time.Time
+		expectedErr bool
+	}{
+		{
+			name:        "date",
+			format:      TimeFormatDate,
+			in:          "2025-01-10",
+			expectedOut: time.Date(2025, 1, 10, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name:        "iso short today",
+			format:      TimeFormatISOShort,
+			in:          "11:30:15",
+			expectedOut: time.Date(2025, 1, 13, 11, 30, 15, 0, time.Local),
+		},
+		{
+			name:        "iso short yesterday",
+			format:      TimeFormatISOShort,
+			in:          "13:30:15",
+			expectedOut: time.Date(2025, 1, 12, 13, 30, 15, 0, time.Local),
+		},
+		{
+			name:        "iso short ms",
+			format:      TimeFormatISOShortMs,
+			in:          "11:30:15.250",
+			expectedOut: time.Date(2025, 1, 13, 11, 30, 15, 250000000, time.Local),
+		},
+		{
+			name:        "iso long",
+			format:      TimeFormatISOLong,
+			in:          "2025-01-10 08:15:00",
+			expectedOut: time.Date(2025, 1, 10, 8, 15, 0, 0, time.Local),
+		},
+		{
+			name:        "iso long ms",
+			format:      TimeFormatISOLongMs,
+			in:          "2025-01-10 08:15:00.125",
+			expectedOut: time.Date(2025, 1, 10, 8, 15, 0, 125000000, time.Local),
+		},
+		{
+			name:        "auto detects iso long ms",
+			format:      TimeFormatAuto,
+			in:          "2025-01-10 08:15:00.125",
+			expectedOut: time.Date(2025, 1, 10, 8, 15, 0, 125000000, time.Local),
+		},
+		{
+			name:        "auto detects iso short",
+			format:      TimeFormatAuto,
+			in:          "11:30:15",
+			expectedOut: time.Date(2025, 1, 13, 11, 30, 15, 0, time.Local),
+		},
+		{
+			name:        "configured format mismatch",
+			format:      TimeFormatISOLong,
+			in:          "2025-01-10",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid time",
+			format:      TimeFormatAuto,
+			in:          "yesterday",
+			expectedErr: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			out, err := testCase.format.parse(testCase.in)
+			assert.Equal(t, testCase.expectedOut, out)
+			if testCase.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTimeFormatHasTimeOfDay(t *testing.T) {
+	assert.False(t, TimeFormatDate.HasTimeOfDay())
+	assert.True(t, TimeFormatISOShort.HasTimeOfDay())
+	assert.True(t, TimeFormatISOLong.HasTimeOfDay())
+	assert.True(t, TimeFormatAuto.HasTimeOfDay())
+}
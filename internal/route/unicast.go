@@ -0,0 +1,104 @@
+package route
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// unicastHeaderPattern matches the first line of a unicast route, routes following the best route of a net
+// omit the net
+var unicastHeaderPattern = regexp.MustCompile(`^\s*(\S+/\d+)?\s+(unicast|blackhole|unreachable|prohibited)\s+\[`)
+
+// UnicastRoute is a unicast route, e.g. a remotely triggered blackhole route
+type UnicastRoute struct {
+	Net          net.IPNet
+	SessionAttrs sessionAttrs
+	BGPAttrs     bgpAttrs
+}
+
+// HasCommunity reports whether the route carries a standard community
+func (r UnicastRoute) HasCommunity(community Community) bool {
+	for _, c := range r.BGPAttrs.Communities {
+		if c == community {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLargeCommunity reports whether the route carries a large community
+func (r UnicastRoute) HasLargeCommunity(community LargeCommunity) bool {
+	for _, c := range r.BGPAttrs.LargeCommunities {
+		if c == community {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitUnicastResponse splits a BIRD CLI response into raw unicast routes. Each raw route starts with
+// the net and contains the attribute lines of the route.
+func SplitUnicastResponse(response string) []string {
+	var rawRoutes []string
+	var current *strings.Builder
+	var lastNet string
+	for _, line := range strings.Split(response, "\n") {
+		content := stripReplyCode(line)
+		if match := unicastHeaderPattern.FindStringSubmatch(content); match != nil {
+			if current != nil {
+				rawRoutes = append(rawRoutes, current.String())
+			}
+			if match[1] != "" {
+				lastNet = match[1]
+			}
+			current = &strings.Builder{}
+			current.WriteString(lastNet + " " + strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(content), match[1])))
+			continue
+		}
+		if current == nil || strings.HasPrefix(line, "0000") {
+			continue
+		}
+		// Lines of a new table or other non-indented content end the current route
+		if content != "" && content[0] != ' ' && content[0] != '\t' {
+			rawRoutes = append(rawRoutes, current.String())
+			current = nil
+			continue
+		}
+		current.WriteString("\n" + line)
+	}
+	if current != nil {
+		rawRoutes = append(rawRoutes, current.String())
+	}
+
+	return rawRoutes
+}
+
+// ParseUnicastRoute parses a raw route as returned by SplitUnicastResponse in the output format of the dialect
+func (d Dialect) ParseUnicastRoute(input string) (UnicastRoute, error) {
+	parts := strings.Split(input, "\n")
+	header := parts[0]
+
+	prefix, _, _ := strings.Cut(header, " ")
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return UnicastRoute{}, fmt.Errorf("invalid unicast route: (%s): unable to parse prefix", header)
+	}
+
+	localSessionAttrs, err := d.parseSessionAttrs(inclusiveMatch(header, "[", "]"))
+	if err != nil {
+		return UnicastRoute{}, fmt.Errorf("invalid unicast route: (%s): %v", header, err)
+	}
+
+	localBGPAttrs, err := d.parseBGPAttrs(parseAttributeLines(parts[1:]))
+	if err != nil {
+		return UnicastRoute{}, fmt.Errorf("invalid unicast route: (%s): %v", header, err)
+	}
+
+	return UnicastRoute{
+		Net:          *network,
+		SessionAttrs: localSessionAttrs,
+		BGPAttrs:     localBGPAttrs,
+	}, nil
+}
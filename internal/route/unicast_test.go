@@ -0,0 +1,46 @@
+package route
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUnicastRoutes(t *testing.T) {
+	for _, testCase := range []struct {
+		dialect  Dialect
+		expected []string
+	}{
+		{dialect: DialectBird2, expected: []string{"192.0.2.1/32 upstream1", "203.0.113.0/24 upstream1", "2001:db8::1/128 upstream1"}},
+		{dialect: DialectBird3, expected: []string{"192.0.2.1/32 upstream1", "192.0.2.1/32 upstream2"}},
+	} {
+		t.Run(testCase.dialect.String(), func(t *testing.T) {
+			response, err := os.ReadFile(filepath.Join("testdata", "unicast", testCase.dialect.String()+".txt"))
+			require.NoError(t, err)
+
+			var routes []UnicastRoute
+			var summaries []string
+			for _, rawRoute := range SplitUnicastResponse(string(response)) {
+				unicastRoute, parseError := testCase.dialect.ParseUnicastRoute(rawRoute)
+				require.NoError(t, parseError)
+				routes = append(routes, unicastRoute)
+				summaries = append(summaries, unicastRoute.Net.String()+" "+unicastRoute.SessionAttrs.SessionName)
+			}
+			assert.Equal(t, testCase.expected, summaries)
+
+			assert.True(t, routes[0].HasCommunity(Community{ASN: 65535, Value: 666}))
+			assert.False(t, routes[0].HasCommunity(Community{ASN: 65001, Value: 100}))
+			assert.Equal(t, ASPath{{Type: ASSequence, ASNs: []uint32{65001}}}, routes[0].BGPAttrs.ASPath)
+			assert.Equal(t, "198.51.100.1", routes[0].SessionAttrs.NeighborAddress.String())
+		})
+	}
+
+	response, err := os.ReadFile(filepath.Join("testdata", "unicast", "bird2.txt"))
+	require.NoError(t, err)
+	unicastRoute, err := DialectBird2.ParseUnicastRoute(SplitUnicastResponse(string(response))[1])
+	require.NoError(t, err)
+	assert.True(t, unicastRoute.HasLargeCommunity(LargeCommunity{GlobalAdmin: 65000, LocalData1: 666, LocalData2: 2}))
+}
@@ -0,0 +1,35 @@
+package rulebuilder
+
+import (
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// AccountingExpressions returns the expressions of a rule counting the packets and bytes per destination
+// address of one address family in the dynamic set setName of the table
+func AccountingExpressions(table *nftables.Table, placement Placement, ipv6 bool, setName string) []expr.Any {
+	var offset, length uint32 = 16, 4 // Destination IPv4 address
+	if ipv6 {
+		offset, length = 24, 16 // Destination IPv6 address
+	}
+
+	// Only count packets of the address family of the set
+	return append(familyExpressions(table, placement, ipv6),
+		// Load the destination address into register 1
+		&expr.Payload{
+			OperationType: expr.PayloadLoad,
+			DestRegister:  1,
+			Base:          expr.PayloadBaseNetworkHeader,
+			Offset:        offset,
+			Len:           length,
+		},
+		// Add the address to the set or update its counter
+		&expr.Dynset{
+			SrcRegKey: 1,
+			SetName:   setName,
+			Operation: uint32(unix.NFT_DYNSET_OP_UPDATE),
+			Exprs:     []expr.Any{&expr.Counter{}},
+		},
+	)
+}
@@ -0,0 +1,470 @@
+package rulebuilder
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net"
+	"slices"
+	"sort"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// MatchSetPrefix starts the names of the sets created by Compile
+const MatchSetPrefix = "flowspec_match_"
+
+// minSetRoutes is the minimum number of routes of a match shape compiled into a set
+const minSetRoutes = 2
+
+// MatchSet is a set of the match attributes of drop routes sharing a match shape
+type MatchSet struct {
+	Set      *nftables.Set
+	Elements []nftables.SetElement
+	// Routes are the routes enforced by rules looking up the set
+	Routes []route.FlowspecRoute
+}
+
+// CompiledRule is a rule of a compiled rule set. Rules looking up a MatchSet enforce several routes.
+type CompiledRule struct {
+	Exprs  []expr.Any
+	Set    *MatchSet
+	Routes []route.FlowspecRoute
+}
+
+// RouteError is a route that could not be translated into a rule
+type RouteError struct {
+	Route route.FlowspecRoute
+	Err   error
+}
+
+func (e RouteError) Error() string {
+	return e.Err.Error()
+}
+
+// field is a match attribute that can be part of a set key
+type field struct {
+	prefix   bool
+	dataType func(ipv6 bool) nftables.SetDatatype
+	load     func(ipv6 bool, register uint32) expr.Any
+	// value returns the first and last value of the attribute of a route
+	value func(flowSpecRoute route.FlowspecRoute) (first, last []byte)
+}
+
+// fields are the match attributes in the order of the rule builder, a shape is a bit mask of them
+var fields = []field{
+	{
+		prefix:   true,
+		dataType: addressType,
+		load:     addressLoader(12, 8),
+		value:    func(r route.FlowspecRoute) ([]byte, []byte) { return prefixRange(r.MatchAttrs.Source) },
+	},
+	{
+		prefix:   true,
+		dataType: addressType,
+		load:     addressLoader(16, 24),
+		value:    func(r route.FlowspecRoute) ([]byte, []byte) { return prefixRange(r.MatchAttrs.Destination) },
+	},
+	{
+		dataType: func(bool) nftables.SetDatatype { return nftables.TypeInetProto },
+		load: func(_ bool, register uint32) expr.Any {
+			return &expr.Meta{Key: expr.MetaKeyL4PROTO, Register: register}
+		},
+		value: func(r route.FlowspecRoute) ([]byte, []byte) {
+			return []byte{byte(r.MatchAttrs.Protocol)}, []byte{byte(r.MatchAttrs.Protocol)}
+		},
+	},
+	{
+		dataType: func(bool) nftables.SetDatatype { return nftables.TypeInetService },
+		load:     portLoader(0),
+		value:    func(r route.FlowspecRoute) ([]byte, []byte) { return portValue(r.MatchAttrs.SourcePort) },
+	},
+	{
+		dataType: func(bool) nftables.SetDatatype { return nftables.TypeInetService },
+		load:     portLoader(2),
+		value:    func(r route.FlowspecRoute) ([]byte, []byte) { return portValue(r.MatchAttrs.DestinationPort) },
+	},
+}
+
+func addressType(ipv6 bool) nftables.SetDatatype {
+	if ipv6 {
+		return nftables.TypeIP6Addr
+	}
+	return nftables.TypeIPAddr
+}
+
+func addressLoader(offset4, offset6 uint32) func(ipv6 bool, register uint32) expr.Any {
+	return func(ipv6 bool, register uint32) expr.Any {
+		offset, length := offset4, uint32(4)
+		if ipv6 {
+			offset, length = offset6, 16
+		}
+		return &expr.Payload{
+			OperationType: expr.PayloadLoad,
+			DestRegister:  register,
+			Base:          expr.PayloadBaseNetworkHeader,
+			Offset:        offset,
+			Len:           length,
+		}
+	}
+}
+
+func portLoader(offset uint32) func(ipv6 bool, register uint32) expr.Any {
+	return func(_ bool, register uint32) expr.Any {
+		return &expr.Payload{
+			OperationType: expr.PayloadLoad,
+			DestRegister:  register,
+			Base:          expr.PayloadBaseTransportHeader,
+			Offset:        offset,
+			Len:           2,
+		}
+	}
+}
+
+func portValue(port uint16) ([]byte, []byte) {
+	value := binary.BigEndian.AppendUint16(nil, port)
+	return value, value
+}
+
+// prefixRange returns the first and last address of a prefix
+func prefixRange(prefix net.IPNet) ([]byte, []byte) {
+	first := prefix.IP.To4()
+	mask := prefix.Mask
+	if first == nil {
+		first = prefix.IP.To16()
+	}
+	if len(mask) != len(first) {
+		mask = mask[len(mask)-len(first):]
+	}
+	last := make([]byte, len(first))
+	for i := range first {
+		last[i] = first[i] | ^mask[i]
+	}
+	return first, last
+}
+
+// shapeOf returns the bit mask of the match attributes of a route
+func shapeOf(flowSpecRoute route.FlowspecRoute) int {
+	shape := 0
+	for i, present := range []bool{
+		flowSpecRoute.MatchAttrs.Source.IP != nil,
+		flowSpecRoute.MatchAttrs.Destination.IP != nil,
+		flowSpecRoute.MatchAttrs.Protocol != 0,
+		flowSpecRoute.MatchAttrs.SourcePort != 0,
+		flowSpecRoute.MatchAttrs.DestinationPort != 0,
+	} {
+		if present {
+			shape |= 1 << i
+		}
+	}
+	return shape
+}
+
+// compilable reports whether a route may be enforced by a set lookup. Rate limits need a limit per route and
+// routes without prefix are not bound to an address family, routes with interface sets look up their own sets.
+func compilable(flowSpecRoute route.FlowspecRoute) bool {
+	isDrop := (flowSpecRoute.Action == route.ActionTrafficRateBytes || flowSpecRoute.Action == route.ActionTrafficRatePackets) &&
+		flowSpecRoute.Argument == 0
+	hasInterfaces := len(flowSpecRoute.MatchAttrs.InputInterfaces) > 0 || len(flowSpecRoute.MatchAttrs.OutputInterfaces) > 0
+	return isDrop && !hasInterfaces && shapeOf(flowSpecRoute)&3 != 0
+}
+
+// shapeKey identifies the routes of a match shape and address family
+type shapeKey struct {
+	ipv6  bool
+	shape int
+}
+
+// element is the key range of a route in a set, with one range per field of the shape
+type element struct {
+	route       route.FlowspecRoute
+	first, last [][]byte
+}
+
+// prefixLength is the sum of the prefix lengths of the element, less specific elements have shorter lengths
+func (e element) prefixLength(shape int) int {
+	length := 0
+	for i, j := 0, 0; i < len(fields); i++ {
+		if shape&(1<<i) == 0 {
+			continue
+		}
+		if fields[i].prefix {
+			for k := range e.first[j] {
+				length += 8 - bits.OnesCount8(e.first[j][k]^e.last[j][k])
+			}
+		}
+		j++
+	}
+	return length
+}
+
+// exact returns the values of the attributes of the element that are not prefixes
+func (e element) exact(prefixFields []int) string {
+	var exact []byte
+	for j := range e.first {
+		if !slices.Contains(prefixFields, j) {
+			exact = append(exact, e.first[j]...)
+		}
+	}
+	return string(exact)
+}
+
+// covers reports whether all key ranges of e contain the ranges of other
+func (e element) covers(other element) bool {
+	for i := range e.first {
+		if bytes.Compare(e.first[i], other.first[i]) > 0 || bytes.Compare(e.last[i], other.last[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether all key ranges of e intersect with the ranges of other
+func (e element) overlaps(other element) bool {
+	for i := range e.first {
+		if bytes.Compare(e.first[i], other.last[i]) > 0 || bytes.Compare(other.first[i], e.last[i]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Compile translates routes into rules. Drop routes with prefixes that share a match shape, e.g. destination
+// prefix, protocol and destination port, are collapsed into a set looked up by a single rule. Other routes,
+// and routes overlapping elements of a set in a way a set can not represent, get a rule each. Set rules
+// take the position of the first route of their set. Routes that can not be translated are left out and
+// returned as errors, shapes that can not be compiled into a set fall back to a rule per route.
+func Compile(table *nftables.Table, flowSpecRoutes []route.FlowspecRoute, placement Placement, enableCounter bool) ([]CompiledRule, []RouteError) {
+	shapes := make(map[shapeKey][]element)
+	for _, flowSpecRoute := range flowSpecRoutes {
+		if !compilable(flowSpecRoute) {
+			continue
+		}
+		key := shapeKey{ipv6: flowSpecRoute.IsIPv6(), shape: shapeOf(flowSpecRoute)}
+		e := element{route: flowSpecRoute}
+		for i, f := range fields {
+			if key.shape&(1<<i) != 0 {
+				first, last := f.value(flowSpecRoute)
+				e.first = append(e.first, first)
+				e.last = append(e.last, last)
+			}
+		}
+		shapes[key] = append(shapes[key], e)
+	}
+
+	// sets maps routes to the rule of their set
+	sets := make(map[string]*CompiledRule)
+	for key, elements := range shapes {
+		compiled, err := compileSet(table, key, elements, placement, enableCounter)
+		if err != nil || compiled == nil {
+			continue
+		}
+		for _, flowSpecRoute := range compiled.Routes {
+			sets[flowSpecRoute.Net()] = compiled
+		}
+	}
+
+	var rules []CompiledRule
+	var routeErrors []RouteError
+	added := make(map[*CompiledRule]bool)
+	for _, flowSpecRoute := range flowSpecRoutes {
+		if compiled, ok := sets[flowSpecRoute.Net()]; ok && compilable(flowSpecRoute) {
+			if !added[compiled] {
+				rules = append(rules, *compiled)
+				added[compiled] = true
+			}
+			continue
+		}
+
+		expressions, err := BuildRuleExpressions(flowSpecRoute, placement, enableCounter)
+		if err != nil {
+			routeErrors = append(routeErrors, RouteError{Route: flowSpecRoute, Err: err})
+			continue
+		}
+		rules = append(rules, CompiledRule{Exprs: expressions, Routes: []route.FlowspecRoute{flowSpecRoute}})
+	}
+	return rules, routeErrors
+}
+
+// compileSet compiles the routes of a shape into a set and the rule looking it up, or returns nil if too few
+// routes can be represented by the set
+func compileSet(table *nftables.Table, key shapeKey, elements []element, placement Placement, enableCounter bool) (*CompiledRule, error) {
+	// Less specific elements go first, so more specific elements they cover are not added to the set
+	sort.SliceStable(elements, func(i, j int) bool {
+		return elements[i].prefixLength(key.shape) < elements[j].prefixLength(key.shape)
+	})
+
+	// Elements only overlap if their exact attributes, e.g. protocol and ports, are equal
+	var prefixFields []int
+	for i, j := 0, 0; i < len(fields); i++ {
+		if key.shape&(1<<i) == 0 {
+			continue
+		}
+		if fields[i].prefix {
+			prefixFields = append(prefixFields, j)
+		}
+		j++
+	}
+
+	var accepted []element
+	var routes []route.FlowspecRoute
+	acceptedByExact := make(map[string][]element)
+	acceptedPrefixes := make(map[string]bool)
+	for _, e := range elements {
+		exact := e.exact(prefixFields)
+		covered, overlapping := false, false
+		if len(prefixFields) == 1 {
+			// A single prefix only overlaps with the less specific prefixes containing it
+			covered = coveredPrefix(exact, e.first[prefixFields[0]], e.last[prefixFields[0]], acceptedPrefixes)
+		} else {
+			for _, other := range acceptedByExact[exact] {
+				if other.covers(e) {
+					covered = true
+					break
+				}
+				if other.overlaps(e) {
+					overlapping = true
+				}
+			}
+		}
+		if overlapping && !covered {
+			continue
+		}
+		routes = append(routes, e.route)
+		if !covered {
+			accepted = append(accepted, e)
+			acceptedByExact[exact] = append(acceptedByExact[exact], e)
+			if len(prefixFields) == 1 {
+				acceptedPrefixes[exact+string(e.first[prefixFields[0]])+string(e.last[prefixFields[0]])] = true
+			}
+		}
+	}
+	if len(routes) < minSetRoutes {
+		return nil, nil
+	}
+
+	var types []nftables.SetDatatype
+	for i, f := range fields {
+		if key.shape&(1<<i) != 0 {
+			types = append(types, f.dataType(key.ipv6))
+		}
+	}
+	set := &nftables.Set{Table: table, Interval: true, KeyType: types[0]}
+	var setElements []nftables.SetElement
+	if len(types) == 1 {
+		for _, e := range accepted {
+			setElements = append(setElements, nftables.SetElement{Key: e.first[0]})
+			// The end of an interval is the first address after it, unless the interval ends with the address space
+			if end := increment(e.last[0]); end != nil {
+				setElements = append(setElements, nftables.SetElement{Key: end, IntervalEnd: true})
+			}
+		}
+	} else {
+		concatenated, err := nftables.ConcatSetType(types...)
+		if err != nil {
+			return nil, err
+		}
+		set.KeyType = concatenated
+		set.Concatenation = true
+		for _, e := range accepted {
+			setElements = append(setElements, nftables.SetElement{Key: concatenate(e.first), KeyEnd: concatenate(e.last)})
+		}
+	}
+	sort.Slice(setElements, func(i, j int) bool {
+		if c := bytes.Compare(setElements[i].Key, setElements[j].Key); c != 0 {
+			return c < 0
+		}
+		return !setElements[i].IntervalEnd && setElements[j].IntervalEnd
+	})
+	set.Name = setName(key, setElements)
+
+	return &CompiledRule{
+		Exprs:  lookupExpressions(table, key, set.Name, placement, enableCounter),
+		Set:    &MatchSet{Set: set, Elements: setElements, Routes: routes},
+		Routes: routes,
+	}, nil
+}
+
+// coveredPrefix reports whether the prefix from first to last or one of its supernets is in prefixes, which
+// are keyed by the exact attributes and the range of the prefix
+func coveredPrefix(exact string, first, last []byte, prefixes map[string]bool) bool {
+	bits := len(first) * 8
+	for length := 0; length <= bits; length++ {
+		mask := net.CIDRMask(length, bits)
+		supernetFirst, supernetLast := prefixRange(net.IPNet{IP: net.IP(first).Mask(mask), Mask: mask})
+		if prefixes[exact+string(supernetFirst)+string(supernetLast)] {
+			return true
+		}
+		if bytes.Equal(supernetFirst, first) && bytes.Equal(supernetLast, last) {
+			break
+		}
+	}
+	return false
+}
+
+// increment returns value + 1, or nil if value is the highest value of its length
+func increment(value []byte) []byte {
+	result := bytes.Clone(value)
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i]++
+		if result[i] != 0 {
+			return result
+		}
+	}
+	return nil
+}
+
+// concatenate joins the values of a concatenated key, each padded to the register size of 4 bytes
+func concatenate(values [][]byte) []byte {
+	var key []byte
+	for _, value := range values {
+		key = append(key, value...)
+		if padding := len(value) % 4; padding != 0 {
+			key = append(key, make([]byte, 4-padding)...)
+		}
+	}
+	return key
+}
+
+// setName derives the name of a set from its content, so changed sets are replaced together with their rule
+func setName(key shapeKey, elements []nftables.SetElement) string {
+	hash := md5.New()
+	fmt.Fprintf(hash, "%t/%d", key.ipv6, key.shape)
+	for _, e := range elements {
+		fmt.Fprintf(hash, "/%x-%x-%t", e.Key, e.KeyEnd, e.IntervalEnd)
+	}
+	return MatchSetPrefix + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// lookupExpressions returns the expressions of a rule dropping packets whose match attributes are in a set
+func lookupExpressions(table *nftables.Table, key shapeKey, setName string, placement Placement, enableCounter bool) []expr.Any {
+	// Sets contain the addresses of one address family
+	expressions := familyExpressions(table, placement, key.ipv6)
+
+	// Load the attributes into consecutive 4 byte registers, starting at register 1
+	var offset uint32
+	for i, f := range fields {
+		if key.shape&(1<<i) == 0 {
+			continue
+		}
+		register := uint32(1)
+		if offset > 0 {
+			register = unix.NFT_REG32_00 + offset/4
+		}
+		expressions = append(expressions, f.load(key.ipv6, register))
+		offset += f.dataType(key.ipv6).Bytes
+		if offset%4 != 0 {
+			offset += 4 - offset%4
+		}
+	}
+
+	expressions = append(expressions, &expr.Lookup{SourceRegister: 1, SetName: setName})
+	return append(expressions, actionDropExpressions(enableCounter)...)
+}
@@ -0,0 +1,226 @@
+package rulebuilder
+
+import (
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// compileRoute returns a route matching the given prefixes, protocol and destination port, empty values
+// are not matched
+func compileRoute(source, destination string, protocol uint64, port uint16, argument int64) route.FlowspecRoute {
+	flowSpecRoute := route.FlowspecRoute{Action: route.ActionTrafficRateBytes, Argument: argument}
+	if source != "" {
+		_, prefix, _ := net.ParseCIDR(source)
+		flowSpecRoute.MatchAttrs.Source = *prefix
+	}
+	if destination != "" {
+		_, prefix, _ := net.ParseCIDR(destination)
+		flowSpecRoute.MatchAttrs.Destination = *prefix
+	}
+	flowSpecRoute.MatchAttrs.Protocol = protocol
+	flowSpecRoute.MatchAttrs.DestinationPort = port
+	return flowSpecRoute
+}
+
+var setNamePattern = regexp.MustCompile(`flowspec_match_[0-9a-f]{16}`)
+
+func TestCompile(t *testing.T) {
+	type testCase struct {
+		name     string
+		routes   []route.FlowspecRoute
+		expected []string
+		// elements are the keys, key ends and interval end flags of the set of the first rule
+		elements []nftables.SetElement
+		keyType  string
+	}
+
+	testCases := []testCase{
+		{
+			name: "destination prefixes",
+			routes: []route.FlowspecRoute{
+				compileRoute("", "192.0.2.1/32", 0, 0, 0),
+				compileRoute("", "198.51.100.0/24", 17, 0, 1000),
+				compileRoute("", "192.0.2.0/24", 0, 0, 0),
+				compileRoute("", "255.255.255.255/32", 0, 0, 0),
+			},
+			expected: []string{
+				"meta nfproto 2 ip daddr @flowspec_match drop",
+				"ip daddr 198.51.100.0/24 meta l4proto 17 limit rate over 1000 bytes/second drop",
+			},
+			keyType: "ipv4_addr",
+			elements: []nftables.SetElement{
+				{Key: []byte{192, 0, 2, 0}},
+				{Key: []byte{192, 0, 3, 0}, IntervalEnd: true},
+				{Key: []byte{255, 255, 255, 255}},
+			},
+		},
+		{
+			name: "single route",
+			routes: []route.FlowspecRoute{
+				compileRoute("", "192.0.2.1/32", 0, 0, 0),
+				compileRoute("", "2001:db8::1/128", 0, 0, 0),
+			},
+			expected: []string{
+				"ip daddr 192.0.2.1/32 drop",
+				"ip6 daddr 2001:db8::1/128 drop",
+			},
+		},
+		{
+			name: "concatenation",
+			routes: []route.FlowspecRoute{
+				compileRoute("", "2001:db8::/32", 0, 0, 0),
+				compileRoute("", "2001:db8::1/128", 17, 123, 0),
+				compileRoute("", "2001:db8:1::/48", 17, 53, 0),
+			},
+			expected: []string{
+				"ip6 daddr 2001:db8::/32 drop",
+				"meta nfproto 10 ip6 daddr . meta l4proto . th dport @flowspec_match drop",
+			},
+			keyType: "ipv6_addr . inet_proto . inet_service",
+			elements: []nftables.SetElement{
+				{
+					Key:    []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 17, 0, 0, 0, 0, 123, 0, 0},
+					KeyEnd: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 17, 0, 0, 0, 0, 123, 0, 0},
+				},
+				{
+					Key:    []byte{0x20, 0x01, 0x0d, 0xb8, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 17, 0, 0, 0, 0, 53, 0, 0},
+					KeyEnd: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 17, 0, 0, 0, 0, 53, 0, 0},
+				},
+			},
+		},
+		{
+			name: "overlapping source and destination",
+			routes: []route.FlowspecRoute{
+				compileRoute("10.0.0.0/8", "192.0.2.0/24", 0, 0, 0),
+				compileRoute("10.1.0.0/16", "192.0.0.0/16", 0, 0, 0),
+				compileRoute("10.1.0.0/16", "192.0.2.1/32", 0, 0, 0),
+				compileRoute("172.16.0.0/12", "192.0.2.0/24", 0, 0, 0),
+			},
+			expected: []string{
+				"meta nfproto 2 ip saddr . ip daddr @flowspec_match drop",
+				"ip saddr 10.1.0.0/16 ip daddr 192.0.0.0/16 drop",
+			},
+			keyType: "ipv4_addr . ipv4_addr",
+			elements: []nftables.SetElement{
+				{Key: []byte{10, 0, 0, 0, 192, 0, 2, 0}, KeyEnd: []byte{10, 255, 255, 255, 192, 0, 2, 255}},
+				{Key: []byte{172, 16, 0, 0, 192, 0, 2, 0}, KeyEnd: []byte{172, 31, 255, 255, 192, 0, 2, 255}},
+			},
+		},
+	}
+
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, rejected := Compile(table, tc.routes, PlacementFilter, false)
+			require.Empty(t, rejected)
+
+			var described []string
+			for _, rule := range rules {
+				described = append(described, setNamePattern.ReplaceAllString(Describe(rule.Exprs), "flowspec_match"))
+			}
+			assert.Equal(t, tc.expected, described)
+
+			var set *MatchSet
+			for _, rule := range rules {
+				if rule.Set != nil {
+					set = rule.Set
+				}
+			}
+			if tc.elements == nil {
+				assert.Nil(t, set)
+				return
+			}
+			require.NotNil(t, set)
+			assert.Equal(t, tc.keyType, set.Set.KeyType.Name)
+			assert.Equal(t, tc.elements, set.Elements)
+			assert.True(t, set.Set.Interval)
+			assert.Equal(t, table, set.Set.Table)
+		})
+	}
+}
+
+func TestCompileRegisters(t *testing.T) {
+	rules, rejected := Compile(nil, []route.FlowspecRoute{
+		compileRoute("198.51.100.0/24", "192.0.2.0/24", 6, 22, 0),
+		compileRoute("198.51.100.0/24", "192.0.2.1/32", 6, 80, 0),
+	}, PlacementFilter, false)
+	require.Empty(t, rejected)
+	require.Len(t, rules, 1)
+
+	var registers []uint32
+	for _, e := range rules[0].Exprs {
+		switch load := e.(type) {
+		case *expr.Payload:
+			registers = append(registers, load.DestRegister)
+		case *expr.Meta:
+			registers = append(registers, load.Register)
+		}
+	}
+	// nfproto, source, destination, protocol and destination port, in 4 byte registers after the 16 byte
+	// register 1
+	assert.Equal(t, []uint32{1, 1, 9, 10, 11}, registers)
+}
+
+func TestCompileStableSetName(t *testing.T) {
+	routes := []route.FlowspecRoute{
+		compileRoute("", "192.0.2.1/32", 0, 0, 0),
+		compileRoute("", "192.0.2.2/32", 0, 0, 0),
+	}
+	first, rejected := Compile(nil, routes, PlacementFilter, false)
+	require.Empty(t, rejected)
+	second, rejected := Compile(nil, []route.FlowspecRoute{routes[1], routes[0]}, PlacementFilter, false)
+	require.Empty(t, rejected)
+	assert.Equal(t, first[0].Set.Set.Name, second[0].Set.Set.Name)
+	assert.Equal(t, first[0].Exprs, second[0].Exprs)
+
+	third, rejected := Compile(nil, routes[:1], PlacementFilter, false)
+	require.Empty(t, rejected)
+	assert.Nil(t, third[0].Set)
+}
+
+func TestCompileLinkLayer(t *testing.T) {
+	for _, placement := range []Placement{PlacementNetdev, PlacementBridge} {
+		rules, rejected := Compile(nil, []route.FlowspecRoute{
+			compileRoute("", "192.0.2.1/32", 0, 0, 0),
+			compileRoute("", "192.0.2.2/32", 0, 0, 0),
+		}, placement, false)
+		require.Empty(t, rejected)
+		require.Len(t, rules, 1)
+		assert.Equal(t, "meta protocol ip ip daddr @flowspec_match drop", setNamePattern.ReplaceAllString(Describe(rules[0].Exprs), "flowspec_match"))
+	}
+}
+
+func TestCompileFamilyTable(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyIPv4, Name: "filter"}
+	rules, rejected := Compile(table, []route.FlowspecRoute{
+		compileRoute("", "192.0.2.1/32", 0, 0, 0),
+		compileRoute("", "192.0.2.2/32", 0, 0, 0),
+	}, PlacementFilter, false)
+	require.Empty(t, rejected)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "ip daddr @flowspec_match drop", setNamePattern.ReplaceAllString(Describe(rules[0].Exprs), "flowspec_match"))
+}
+
+func TestCompileRouteError(t *testing.T) {
+	unsupported := compileRoute("", "192.0.2.3/32", 0, 0, 0)
+	unsupported.Action = 0
+	rules, rejected := Compile(nil, []route.FlowspecRoute{
+		compileRoute("", "192.0.2.1/32", 0, 0, 0),
+		unsupported,
+		compileRoute("", "192.0.2.2/32", 0, 0, 0),
+	}, PlacementFilter, false)
+	require.Len(t, rules, 1)
+	assert.Len(t, rules[0].Routes, 2)
+	assert.Equal(t, rules[0].Routes, rules[0].Set.Routes)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, unsupported, rejected[0].Route)
+	assert.EqualError(t, rejected[0], "unsupported action type")
+}
@@ -0,0 +1,151 @@
+package rulebuilder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/google/nftables/expr"
+)
+
+// payloadNames are the nft names of the payload fields loaded by the rule builder
+var payloadNames = map[expr.PayloadBase]map[[2]uint32]string{
+	expr.PayloadBaseNetworkHeader: {
+		{12, 4}:  "ip saddr",
+		{16, 4}:  "ip daddr",
+		{8, 16}:  "ip6 saddr",
+		{24, 16}: "ip6 daddr",
+	},
+	expr.PayloadBaseTransportHeader: {
+		{0, 2}: "th sport",
+		{2, 2}: "th dport",
+	},
+}
+
+var payloadBaseNames = map[expr.PayloadBase]string{
+	expr.PayloadBaseLLHeader:        "ll",
+	expr.PayloadBaseNetworkHeader:   "nh",
+	expr.PayloadBaseTransportHeader: "th",
+}
+
+var metaNames = map[expr.MetaKey]string{
+	expr.MetaKeyL4PROTO:  "meta l4proto",
+	expr.MetaKeyNFPROTO:  "meta nfproto",
+	expr.MetaKeyPROTOCOL: "meta protocol",
+	expr.MetaKeyIIFNAME:  "iifname",
+	expr.MetaKeyOIFNAME:  "oifname",
+}
+
+// etherTypeNames are the nft names of the link layer protocols matched in netdev chains
+var etherTypeNames = map[uint16]string{
+	etherTypeIPv4: "ip",
+	etherTypeIPv6: "ip6",
+}
+
+var verdictNames = map[expr.VerdictKind]string{
+	expr.VerdictDrop:   "drop",
+	expr.VerdictAccept: "accept",
+	expr.VerdictReturn: "return",
+	expr.VerdictJump:   "jump",
+	expr.VerdictGoto:   "goto",
+}
+
+// Describe renders rule expressions in a syntax close to "nft list ruleset", e.g. for dry runs.
+// Expressions the rule builder does not produce are rendered by their type.
+func Describe(expressions []expr.Any) string {
+	var parts []string
+	var field string
+	var mask []byte
+	// loaded are the fields loaded since the last comparison, concatenated by set lookups
+	var loaded []string
+
+	for _, expression := range expressions {
+		switch e := expression.(type) {
+		case *expr.Payload:
+			field, mask = payloadName(e), nil
+			loaded = append(loaded, field)
+		case *expr.Meta:
+			field, mask = metaNames[e.Key], nil
+			if field == "" {
+				field = fmt.Sprintf("meta %d", e.Key)
+			}
+			loaded = append(loaded, field)
+		case *expr.Bitwise:
+			mask = e.Mask
+		case *expr.Cmp:
+			operator := ""
+			if e.Op == expr.CmpOpNeq {
+				operator = "!= "
+			}
+			parts = append(parts, field+" "+operator+describeValue(field, e.Data, mask))
+			loaded = nil
+		case *expr.Lookup:
+			operator := ""
+			if e.Invert {
+				operator = "!= "
+			}
+			parts = append(parts, strings.Join(loaded, " . ")+" "+operator+"@"+e.SetName)
+			loaded = nil
+		case *expr.Limit:
+			unit := "/second"
+			if e.Type == expr.LimitTypePktBytes {
+				unit = " bytes/second"
+			}
+			parts = append(parts, fmt.Sprintf("limit rate over %d%s", e.Rate, unit))
+		case *expr.Objref:
+			parts = append(parts, fmt.Sprintf("counter name %q", e.Name))
+		case *expr.Counter:
+			parts = append(parts, "counter")
+		case *expr.Dynset:
+			parts = append(parts, fmt.Sprintf("update @%s { %s%s }", e.SetName, field, describeExpressions(e.Exprs)))
+			loaded = nil
+		case *expr.Verdict:
+			verdict := verdictNames[e.Kind]
+			if e.Chain != "" {
+				verdict += " " + e.Chain
+			}
+			parts = append(parts, verdict)
+		default:
+			parts = append(parts, fmt.Sprintf("%T", expression))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// describeExpressions renders the expressions attached to set elements, e.g. " counter"
+func describeExpressions(expressions []expr.Any) string {
+	if len(expressions) == 0 {
+		return ""
+	}
+	return " " + Describe(expressions)
+}
+
+func payloadName(payload *expr.Payload) string {
+	if name, ok := payloadNames[payload.Base][[2]uint32{payload.Offset, payload.Len}]; ok {
+		return name
+	}
+	return fmt.Sprintf("@%s,%d,%d", payloadBaseNames[payload.Base], payload.Offset*8, payload.Len*8)
+}
+
+func describeValue(field string, data []byte, mask []byte) string {
+	switch {
+	case strings.HasPrefix(field, "ip ") || strings.HasPrefix(field, "ip6 "):
+		if mask == nil {
+			return net.IP(data).String()
+		}
+		return (&net.IPNet{IP: data, Mask: mask}).String()
+	case field == "meta protocol" && len(data) == 2 && etherTypeNames[binary.BigEndian.Uint16(data)] != "":
+		return etherTypeNames[binary.BigEndian.Uint16(data)]
+	case field == "iifname" || field == "oifname":
+		return fmt.Sprintf("%q", strings.TrimRight(string(data), "\x00"))
+	case len(data) == 1:
+		return fmt.Sprintf("%d", data[0])
+	case len(data) == 2:
+		return fmt.Sprintf("%d", binary.BigEndian.Uint16(data))
+	default:
+		return "0x" + new(big.Int).SetBytes(data).Text(16)
+	}
+}
@@ -0,0 +1,117 @@
+package rulebuilder
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func TestDescribe(t *testing.T) {
+	type testCase struct {
+		name          string
+		source        string
+		destination   string
+		protocol      uint64
+		port          uint16
+		action        int64
+		argument      int64
+		placement     Placement
+		enableCounter bool
+		expected      string
+	}
+
+	testCases := []testCase{
+		{
+			name:        "drop",
+			destination: "192.0.2.1/32",
+			protocol:    17,
+			port:        123,
+			action:      route.ActionTrafficRateBytes,
+			expected:    "ip daddr 192.0.2.1/32 meta l4proto 17 th dport 123 drop",
+		},
+		{
+			name:          "rate limit",
+			source:        "2001:db8::/32",
+			action:        route.ActionTrafficRatePackets,
+			argument:      1000,
+			enableCounter: true,
+			expected:      `ip6 saddr 2001:db8::/32 counter name "flowspec_limit_matched" counter limit rate over 1000/second counter name "flowspec_dropped" counter drop`,
+		},
+		{
+			name:      "raw rate limit",
+			protocol:  17,
+			port:      53,
+			action:    route.ActionTrafficRateBytes,
+			argument:  125000,
+			placement: PlacementRaw,
+			expected:  "meta l4proto 17 th dport 53 limit rate over 125000 bytes/second drop",
+		},
+		{
+			name:        "raw drop",
+			destination: "192.0.2.1/32",
+			action:      route.ActionTrafficRateBytes,
+			placement:   PlacementRaw,
+			expected:    "ip daddr 192.0.2.1/32 drop",
+		},
+		{
+			name:        "netdev drop",
+			destination: "2001:db8::1/128",
+			action:      route.ActionTrafficRateBytes,
+			placement:   PlacementNetdev,
+			expected:    "meta protocol ip6 ip6 daddr 2001:db8::1/128 drop",
+		},
+		{
+			name:      "bridge drop",
+			source:    "198.51.100.0/24",
+			protocol:  6,
+			action:    route.ActionTrafficRatePackets,
+			placement: PlacementBridge,
+			expected:  "meta protocol ip ip saddr 198.51.100.0/24 meta l4proto 6 drop",
+		},
+		{
+			name:      "netdev without prefix",
+			protocol:  17,
+			action:    route.ActionTrafficRateBytes,
+			placement: PlacementNetdev,
+			expected:  "meta l4proto 17 drop",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flowSpecRoute := route.FlowspecRoute{Action: tc.action, Argument: tc.argument}
+			if tc.source != "" {
+				_, source, _ := net.ParseCIDR(tc.source)
+				flowSpecRoute.MatchAttrs.Source = *source
+			}
+			if tc.destination != "" {
+				_, destination, _ := net.ParseCIDR(tc.destination)
+				flowSpecRoute.MatchAttrs.Destination = *destination
+			}
+			flowSpecRoute.MatchAttrs.Protocol = tc.protocol
+			flowSpecRoute.MatchAttrs.DestinationPort = tc.port
+
+			expressions, err := BuildRuleExpressions(flowSpecRoute, tc.placement, tc.enableCounter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, Describe(expressions))
+		})
+	}
+}
+
+func TestDescribeAccounting(t *testing.T) {
+	assert.Equal(t, "meta nfproto 2 update @flowspec_accounting4 { ip daddr counter }", Describe(AccountingExpressions(nil, PlacementFilter, false, "flowspec_accounting4")))
+	assert.Equal(t, "meta nfproto 10 update @flowspec_accounting6 { ip6 daddr counter }", Describe(AccountingExpressions(nil, PlacementFilter, true, "flowspec_accounting6")))
+	assert.Equal(t, "meta protocol ip update @flowspec_accounting4 { ip daddr counter }", Describe(AccountingExpressions(nil, PlacementNetdev, false, "flowspec_accounting4")))
+
+	table := &nftables.Table{Name: "filter", Family: nftables.TableFamilyIPv6}
+	assert.Equal(t, "update @flowspec_accounting6 { ip6 daddr counter }", Describe(AccountingExpressions(table, PlacementFilter, true, "flowspec_accounting6")))
+}
+
+func TestDescribeInterfaceJump(t *testing.T) {
+	assert.Equal(t, `iifname "vrf-blue" jump flowspec_vrf_vrf-blue`, Describe(InterfaceJumpExpressions("vrf-blue", "flowspec_vrf_vrf-blue")))
+}
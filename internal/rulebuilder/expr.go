@@ -31,7 +31,8 @@ func actionDropExpressions(enableCounter bool) []expr.Any {
 	return expressions
 }
 
-func BuildRuleExpressions(flowSpecRoute route.FlowspecRoute, enableCounter bool) ([]expr.Any, error) {
+// BuildRuleExpressions returns the expressions of a rule enforcing a route in a chain of the placement
+func BuildRuleExpressions(flowSpecRoute route.FlowspecRoute, placement Placement, enableCounter bool) ([]expr.Any, error) {
 	var expressions []expr.Any
 
 	addPrefixMatcher := func(ipnet *net.IPNet, isSource bool) {
@@ -120,6 +121,15 @@ func BuildRuleExpressions(flowSpecRoute route.FlowspecRoute, enableCounter bool)
 		})
 	}
 
+	// Match the interfaces of the interface sets of the route first
+	expressions = append(expressions, interfaceExpressions(flowSpecRoute)...)
+
+	// Netdev and bridge chains see packets of other protocols at the offsets of the addresses
+	hasPrefix := flowSpecRoute.MatchAttrs.Source.IP != nil || flowSpecRoute.MatchAttrs.Destination.IP != nil
+	if placement.linkLayer() && hasPrefix {
+		expressions = append(expressions, familyExpressions(nil, placement, flowSpecRoute.IsIPv6())...)
+	}
+
 	// Add source and destination address matchers
 	if flowSpecRoute.MatchAttrs.Source.IP != nil {
 		addPrefixMatcher(&flowSpecRoute.MatchAttrs.Source, true)
@@ -0,0 +1,70 @@
+package rulebuilder
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// interfaceName returns the name of an interface as loaded by "meta iifname" and "meta oifname"
+func interfaceName(name string) []byte {
+	data := make([]byte, unix.IFNAMSIZ)
+	copy(data, name)
+	return data
+}
+
+// InterfaceSet returns the match set of interface names. Like the sets of Compile, it is named after its
+// content.
+func InterfaceSet(table *nftables.Table, names []string) *MatchSet {
+	names = slices.Compact(slices.Sorted(slices.Values(names)))
+	hash := md5.Sum([]byte("ifname/" + strings.Join(names, "/")))
+	set := &nftables.Set{Table: table, Name: MatchSetPrefix + hex.EncodeToString(hash[:])[:16], KeyType: nftables.TypeIFName}
+
+	var elements []nftables.SetElement
+	for _, name := range names {
+		elements = append(elements, nftables.SetElement{Key: interfaceName(name)})
+	}
+	return &MatchSet{Set: set, Elements: elements}
+}
+
+// InterfaceSets returns the match sets of the input and output interfaces of a route
+func InterfaceSets(table *nftables.Table, flowSpecRoute route.FlowspecRoute) []*MatchSet {
+	var sets []*MatchSet
+	for _, names := range [][]string{flowSpecRoute.MatchAttrs.InputInterfaces, flowSpecRoute.MatchAttrs.OutputInterfaces} {
+		if len(names) > 0 {
+			set := InterfaceSet(table, names)
+			set.Routes = []route.FlowspecRoute{flowSpecRoute}
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+// interfaceExpressions returns the expressions matching packets received on an input interface and sent on an
+// output interface of a route
+func interfaceExpressions(flowSpecRoute route.FlowspecRoute) []expr.Any {
+	var expressions []expr.Any
+	for _, match := range []struct {
+		key   expr.MetaKey
+		names []string
+	}{
+		{expr.MetaKeyIIFNAME, flowSpecRoute.MatchAttrs.InputInterfaces},
+		{expr.MetaKeyOIFNAME, flowSpecRoute.MatchAttrs.OutputInterfaces},
+	} {
+		if len(match.names) == 0 {
+			continue
+		}
+		expressions = append(expressions,
+			&expr.Meta{Key: match.key, Register: 1},
+			&expr.Lookup{SourceRegister: 1, SetName: InterfaceSet(nil, match.names).Set.Name},
+		)
+	}
+	return expressions
+}
@@ -0,0 +1,43 @@
+package rulebuilder
+
+import (
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func TestInterfaceSet(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	set := InterfaceSet(table, []string{"eth1", "eth0", "eth1"})
+	assert.Regexp(t, setNamePattern, set.Set.Name)
+	assert.Equal(t, nftables.TypeIFName, set.Set.KeyType)
+	assert.Equal(t, []nftables.SetElement{
+		{Key: []byte("eth0\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+		{Key: []byte("eth1\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+	}, set.Elements)
+
+	// Sets are named after the interfaces, not their order
+	assert.Equal(t, set.Set.Name, InterfaceSet(table, []string{"eth0", "eth1"}).Set.Name)
+	assert.NotEqual(t, set.Set.Name, InterfaceSet(table, []string{"eth0"}).Set.Name)
+}
+
+func TestInterfaceExpressions(t *testing.T) {
+	flowSpecRoute := compileRoute("", "192.0.2.1/32", 0, 0, 0)
+	flowSpecRoute.MatchAttrs.InputInterfaces = []string{"eth0", "eth1"}
+	flowSpecRoute.MatchAttrs.OutputInterfaces = []string{"eth2"}
+
+	expressions, err := BuildRuleExpressions(flowSpecRoute, PlacementFilter, false)
+	require.NoError(t, err)
+	sets := InterfaceSets(nil, flowSpecRoute)
+	require.Len(t, sets, 2)
+	assert.Equal(t, "iifname @"+sets[0].Set.Name+" oifname @"+sets[1].Set.Name+" ip daddr 192.0.2.1/32 drop", Describe(expressions))
+
+	// Routes with interface sets keep a rule of their own
+	rules, rejected := Compile(nil, []route.FlowspecRoute{flowSpecRoute, compileRoute("", "192.0.2.2/32", 0, 0, 0)}, PlacementFilter, false)
+	require.Empty(t, rejected)
+	assert.Len(t, rules, 2)
+}
@@ -0,0 +1,63 @@
+package rulebuilder
+
+import (
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// Placement is the kind of chain the rules are evaluated in
+type Placement int
+
+const (
+	// PlacementFilter is a chain of an inet, ip or ip6 table
+	PlacementFilter Placement = iota
+	// PlacementRaw is a prerouting chain at raw priority, evaluated before connection tracking, so dropped
+	// packets never create connection tracking entries
+	PlacementRaw
+	// PlacementNetdev is an ingress chain of a netdev table, evaluated before any other hook
+	PlacementNetdev
+	// PlacementBridge is a chain of a bridge table, evaluated for the frames of bridge ports
+	PlacementBridge
+)
+
+// Ethernet protocol numbers of IPv4 and IPv6, matched in netdev and bridge chains
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+)
+
+// linkLayer reports whether chains of the placement see packets of all link layer protocols
+func (p Placement) linkLayer() bool {
+	return p == PlacementNetdev || p == PlacementBridge
+}
+
+// familyExpressions returns the expressions matching packets of one address family. In chains seeing packets of
+// all link layer protocols, the protocol of the packet is matched instead of the netfilter family. Unlike the
+// ethertype of the frame, the protocol is that of the IP header of frames with a single VLAN tag, which the
+// kernel removes from the frame on receive, so the network header is found in tagged frames as well.
+// Tables of the ip and ip6 family only see packets of their address family and need no expressions.
+func familyExpressions(table *nftables.Table, placement Placement, ipv6 bool) []expr.Any {
+	if table != nil && (table.Family == nftables.TableFamilyIPv4 || table.Family == nftables.TableFamilyIPv6) {
+		return nil
+	}
+	if placement.linkLayer() {
+		protocol := []byte{etherTypeIPv4 >> 8, etherTypeIPv4 & 0xff}
+		if ipv6 {
+			protocol = []byte{etherTypeIPv6 >> 8, etherTypeIPv6 & 0xff}
+		}
+		return []expr.Any{
+			&expr.Meta{Key: expr.MetaKeyPROTOCOL, Register: 1},
+			&expr.Cmp{Register: 1, Data: protocol, Op: expr.CmpOpEq},
+		}
+	}
+
+	family := byte(unix.NFPROTO_IPV4)
+	if ipv6 {
+		family = unix.NFPROTO_IPV6
+	}
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Register: 1, Data: []byte{family}, Op: expr.CmpOpEq},
+	}
+}
@@ -0,0 +1,15 @@
+package rulebuilder
+
+import (
+	"github.com/google/nftables/expr"
+)
+
+// InterfaceJumpExpressions returns the expressions of a rule jumping to chain for packets received on the
+// interface, e.g. a VRF device or one of its members
+func InterfaceJumpExpressions(iifname string, chain string) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{Register: 1, Data: interfaceName(iifname), Op: expr.CmpOpEq},
+		&expr.Verdict{Kind: expr.VerdictJump, Chain: chain},
+	}
+}
@@ -0,0 +1,182 @@
+package rulesum
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// userdataComment is the NFTNL_UDATA_RULE_COMMENT type of rule user data, which nft displays as comment
+const userdataComment = 0
+
+// identityPrefix marks the comments of rules managed by the daemon
+const identityPrefix = "flowspec:"
+
+// Identity returns the identity of the rule enforcing routes, derived from their match attributes. The rule of
+// a route keeps its identity when the action of the route changes.
+func Identity(flowSpecRoutes ...route.FlowspecRoute) string {
+	hash := md5.New()
+	for _, flowSpecRoute := range flowSpecRoutes {
+		fmt.Fprintln(hash, flowSpecRoute.Net())
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Checksum returns the checksum of the expressions of a rule
+func Checksum(rule *nftables.Rule) string {
+	hash := md5.New()
+	for _, e := range rule.Exprs {
+		data, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(hash, "%T", e)
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Tag stores the identity and the checksum of the expressions of a rule as comment in its user data. Rules
+// without identity, e.g. jumps, are identified by the checksum of their expressions.
+func Tag(rule *nftables.Rule, identity string) {
+	checksum := Checksum(rule)
+	if identity == "" {
+		identity = checksum
+	}
+	comment := append([]byte(identityPrefix+identity+":"+checksum), 0)
+	rule.UserData = append([]byte{userdataComment, byte(len(comment))}, comment...)
+}
+
+// TaggedIdentity returns the identity stored in the user data of a rule, or "" if it has none
+func TaggedIdentity(rule *nftables.Rule) string {
+	identity, _ := tag(rule)
+	return identity
+}
+
+// tag returns the identity and the checksum stored in the user data of a rule
+func tag(rule *nftables.Rule) (string, string) {
+	data := rule.UserData
+	for len(data) >= 2 && len(data) >= 2+int(data[1]) {
+		value := data[2 : 2+int(data[1])]
+		if data[0] == userdataComment {
+			comment, ok := strings.CutPrefix(string(bytes.TrimRight(value, "\x00")), identityPrefix)
+			if identity, checksum, found := strings.Cut(comment, ":"); ok && found && identity != "" {
+				return identity, checksum
+			}
+		}
+		data = data[2+int(data[1]):]
+	}
+	return "", ""
+}
+
+// Insertion is a rule to add to a chain
+type Insertion struct {
+	Rule *nftables.Rule
+	// Before is the handle of the existing rule the rule is inserted before, 0 appends the rule to the chain
+	Before uint64
+}
+
+// Replacement is a rule replacing an existing rule of the same identity with different expressions in place
+type Replacement struct {
+	Existing *nftables.Rule
+	Rule     *nftables.Rule
+}
+
+// Update changes the existing rules of a chain into the desired rules
+type Update struct {
+	Delete  []*nftables.Rule
+	Insert  []Insertion
+	Replace []Replacement
+}
+
+// Empty reports whether the existing rules already match the desired rules
+func (u Update) Empty() bool {
+	return len(u.Delete) == 0 && len(u.Insert) == 0 && len(u.Replace) == 0
+}
+
+// Diff tags the desired rules not tagged yet and returns the update changing the existing rules into the
+// desired rules. Existing rules are kept if they occur in the same order in the desired rules and replaced if
+// their expressions changed, rules without identity are deleted.
+func Diff(existing, desired []*nftables.Rule) Update {
+	positions := make(map[string][]int)
+	for i, rule := range desired {
+		if TaggedIdentity(rule) == "" {
+			Tag(rule, "")
+		}
+		identity := TaggedIdentity(rule)
+		positions[identity] = append(positions[identity], i)
+	}
+
+	var update Update
+	// kept maps the positions of the desired rules to the handles of the existing rules kept for them
+	kept := make(map[int]uint64)
+	last := -1
+	for _, rule := range existing {
+		identity, checksum := tag(rule)
+		candidates := positions[identity]
+		for len(candidates) > 0 && candidates[0] <= last {
+			candidates = candidates[1:]
+		}
+		if identity == "" || len(candidates) == 0 {
+			update.Delete = append(update.Delete, rule)
+			continue
+		}
+		last = candidates[0]
+		kept[last] = rule.Handle
+		if _, desiredChecksum := tag(desired[last]); desiredChecksum != checksum {
+			update.Replace = append(update.Replace, Replacement{Existing: rule, Rule: desired[last]})
+		}
+		positions[identity] = candidates[1:]
+	}
+
+	var before uint64
+	var insertions []Insertion
+	for i := len(desired) - 1; i >= 0; i-- {
+		if handle, ok := kept[i]; ok {
+			before = handle
+			continue
+		}
+		insertions = append(insertions, Insertion{Rule: desired[i], Before: before})
+	}
+	for i := len(insertions) - 1; i >= 0; i-- {
+		update.Insert = append(update.Insert, insertions[i])
+	}
+	return update
+}
+
+// CopyCounters copies the values of the counters of the existing rules to the counters of the tagged rules
+// with the same identity
+func CopyCounters(existing, rules []*nftables.Rule) {
+	counters := make(map[string][]*expr.Counter)
+	for _, rule := range existing {
+		if identity := TaggedIdentity(rule); identity != "" {
+			counters[identity] = ruleCounters(rule)
+		}
+	}
+	for _, rule := range rules {
+		existingCounters := counters[TaggedIdentity(rule)]
+		for i, counter := range ruleCounters(rule) {
+			if i < len(existingCounters) {
+				counter.Bytes, counter.Packets = existingCounters[i].Bytes, existingCounters[i].Packets
+			}
+		}
+	}
+}
+
+func ruleCounters(rule *nftables.Rule) []*expr.Counter {
+	var counters []*expr.Counter
+	for _, e := range rule.Exprs {
+		if counter, ok := e.(*expr.Counter); ok {
+			counters = append(counters, counter)
+		}
+	}
+	return counters
+}
@@ -0,0 +1,182 @@
+//go:build linux
+
+package rulesum_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/stretchr/testify/assert"
+
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/rulesum"
+)
+
+// protocolRule returns a rule dropping the traffic of an IP protocol
+func protocolRule(protocol byte) *nftables.Rule {
+	return &nftables.Rule{
+		Exprs: []expr.Any{
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Register: 1, Data: []byte{protocol}, Op: expr.CmpOpEq},
+			&expr.Verdict{Kind: expr.VerdictDrop},
+		},
+	}
+}
+
+// installedRules returns the rules of the protocols as installed in a chain, with handles starting at 1
+func installedRules(protocols ...byte) []*nftables.Rule {
+	var rules []*nftables.Rule
+	for i, protocol := range protocols {
+		rule := protocolRule(protocol)
+		rulesum.Tag(rule, "")
+		rule.Handle = uint64(i + 1)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func TestTaggedIdentity(t *testing.T) {
+	rule := protocolRule(6)
+	assert.Equal(t, "", rulesum.TaggedIdentity(rule))
+
+	rulesum.Tag(rule, "")
+	assert.Equal(t, rulesum.Checksum(rule), rulesum.TaggedIdentity(rule))
+	assert.NotEqual(t, rulesum.Checksum(protocolRule(17)), rulesum.TaggedIdentity(rule))
+
+	// Comments of other rules are no identities
+	rule.UserData = []byte{0, 5, 'd', 'r', 'o', 'p', 0}
+	assert.Equal(t, "", rulesum.TaggedIdentity(rule))
+}
+
+func TestIdentity(t *testing.T) {
+	var drop, rateLimit, other route.FlowspecRoute
+	_, destination, _ := net.ParseCIDR("192.0.2.1/32")
+	drop.MatchAttrs.Destination = *destination
+	drop.MatchAttrs.Protocol = 17
+	rateLimit = drop
+	rateLimit.Action, rateLimit.Argument = route.ActionTrafficRateBytes, 1000
+	other = drop
+	other.MatchAttrs.Protocol = 6
+
+	assert.Equal(t, rulesum.Identity(drop), rulesum.Identity(rateLimit))
+	assert.NotEqual(t, rulesum.Identity(drop), rulesum.Identity(other))
+	assert.NotEqual(t, rulesum.Identity(drop), rulesum.Identity(drop, other))
+
+	rule := protocolRule(17)
+	rulesum.Tag(rule, rulesum.Identity(drop))
+	assert.Equal(t, rulesum.Identity(drop), rulesum.TaggedIdentity(rule))
+}
+
+func TestDiff(t *testing.T) {
+	type testCase struct {
+		name     string
+		existing []*nftables.Rule
+		desired  []byte
+		deleted  []uint64
+		// inserted maps the protocols of inserted rules to the handles they are inserted before
+		inserted [][2]uint64
+	}
+
+	untagged := protocolRule(1)
+	untagged.Handle = 9
+
+	testCases := []testCase{
+		{name: "unchanged", existing: installedRules(6, 17), desired: []byte{6, 17}},
+		{name: "empty chain", desired: []byte{6, 17}, inserted: [][2]uint64{{6, 0}, {17, 0}}},
+		{name: "append", existing: installedRules(6, 17), desired: []byte{6, 17, 1}, inserted: [][2]uint64{{1, 0}}},
+		{name: "insert", existing: installedRules(6, 17), desired: []byte{1, 58, 6, 17}, inserted: [][2]uint64{{1, 1}, {58, 1}}},
+		{name: "insert between", existing: installedRules(6, 17), desired: []byte{6, 1, 17}, inserted: [][2]uint64{{1, 2}}},
+		{name: "delete", existing: installedRules(6, 1, 17), desired: []byte{6, 17}, deleted: []uint64{2}},
+		{name: "replace", existing: installedRules(6, 1, 17), desired: []byte{6, 58, 17}, deleted: []uint64{2}, inserted: [][2]uint64{{58, 3}}},
+		{name: "reorder", existing: installedRules(6, 17), desired: []byte{17, 6}, deleted: []uint64{2}, inserted: [][2]uint64{{17, 1}}},
+		{name: "duplicates", existing: installedRules(6, 6), desired: []byte{6, 17, 6, 6}, inserted: [][2]uint64{{17, 2}, {6, 0}}},
+		{name: "untagged", existing: []*nftables.Rule{untagged}, desired: []byte{1}, deleted: []uint64{9}, inserted: [][2]uint64{{1, 0}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var desired []*nftables.Rule
+			for _, protocol := range tc.desired {
+				desired = append(desired, protocolRule(protocol))
+			}
+
+			update := rulesum.Diff(tc.existing, desired)
+
+			var deleted []uint64
+			for _, rule := range update.Delete {
+				deleted = append(deleted, rule.Handle)
+			}
+			var inserted [][2]uint64
+			for _, insertion := range update.Insert {
+				protocol := insertion.Rule.Exprs[1].(*expr.Cmp).Data[0]
+				inserted = append(inserted, [2]uint64{uint64(protocol), insertion.Before})
+				assert.Equal(t, rulesum.Checksum(insertion.Rule), rulesum.TaggedIdentity(insertion.Rule))
+			}
+			assert.Equal(t, tc.deleted, deleted)
+			assert.Equal(t, tc.inserted, inserted)
+			assert.Equal(t, len(tc.deleted) == 0 && len(tc.inserted) == 0, update.Empty())
+		})
+	}
+}
+
+func TestDiffReplace(t *testing.T) {
+	countedRule := func(verdict expr.VerdictKind) *nftables.Rule {
+		return &nftables.Rule{
+			Exprs: []expr.Any{
+				&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+				&expr.Cmp{Register: 1, Data: []byte{17}, Op: expr.CmpOpEq},
+				&expr.Counter{},
+				&expr.Verdict{Kind: verdict},
+			},
+		}
+	}
+
+	existing := countedRule(expr.VerdictDrop)
+	rulesum.Tag(existing, "route")
+	existing.Handle = 4
+	existing.Exprs[2].(*expr.Counter).Packets = 7
+
+	// The action of the route changed, the rule keeps its identity
+	desired := countedRule(expr.VerdictAccept)
+	rulesum.Tag(desired, "route")
+	update := rulesum.Diff([]*nftables.Rule{existing}, []*nftables.Rule{desired})
+	assert.Empty(t, update.Delete)
+	assert.Empty(t, update.Insert)
+	assert.Equal(t, []rulesum.Replacement{{Existing: existing, Rule: desired}}, update.Replace)
+	assert.False(t, update.Empty())
+
+	rulesum.CopyCounters([]*nftables.Rule{existing}, []*nftables.Rule{desired})
+	assert.Equal(t, &expr.Counter{Packets: 7}, desired.Exprs[2])
+
+	// Unchanged rules are not replaced
+	unchanged := countedRule(expr.VerdictDrop)
+	rulesum.Tag(unchanged, "route")
+	assert.True(t, rulesum.Diff([]*nftables.Rule{existing}, []*nftables.Rule{unchanged}).Empty())
+}
+
+func TestCopyCounters(t *testing.T) {
+	countedRule := func(protocol byte) *nftables.Rule {
+		rule := protocolRule(protocol)
+		rule.Exprs = append(rule.Exprs[:2:2], &expr.Counter{}, rule.Exprs[2])
+		return rule
+	}
+
+	existing := []*nftables.Rule{countedRule(6), countedRule(17)}
+	for i, rule := range existing {
+		rulesum.Tag(rule, "")
+		rule.Exprs[2].(*expr.Counter).Packets = uint64(i + 1)
+		rule.Exprs[2].(*expr.Counter).Bytes = uint64(100 * (i + 1))
+	}
+
+	rules := []*nftables.Rule{countedRule(17), countedRule(1), countedRule(6)}
+	for _, rule := range rules {
+		rulesum.Tag(rule, "")
+	}
+	rulesum.CopyCounters(existing, rules)
+
+	assert.Equal(t, &expr.Counter{Packets: 2, Bytes: 200}, rules[0].Exprs[2])
+	assert.Equal(t, &expr.Counter{}, rules[1].Exprs[2])
+	assert.Equal(t, &expr.Counter{Packets: 1, Bytes: 100}, rules[2].Exprs[2])
+}
@@ -0,0 +1,213 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"bird-flowspec-daemon/internal/bird"
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+)
+
+// BirdConfig configures the BIRD CLI source
+type BirdConfig struct {
+	Client   bird.Client
+	Query    bird.Query
+	Interval time.Duration
+	// QueryFiltered additionally queries the routes rejected by BIRD import filters for diagnostics
+	QueryFiltered bool
+	TimeFormat    route.TimeFormat
+}
+
+// BirdCLI polls the flowspec routes of BIRD via its CLI socket
+type BirdCLI struct {
+	name   string
+	config BirdConfig
+
+	mu       sync.RWMutex
+	routes   []route.FlowspecRoute
+	rejected []Rejection
+	filtered []route.Summary
+	updates  chan struct{}
+}
+
+// NewBirdCLI creates a BIRD CLI source, the BIRD version is detected when it starts running
+func NewBirdCLI(name string, config BirdConfig) *BirdCLI {
+	return &BirdCLI{
+		name:    name,
+		config:  config,
+		updates: make(chan struct{}, 1),
+	}
+}
+
+func (b *BirdCLI) Name() string {
+	return b.name
+}
+
+func (b *BirdCLI) Updates() <-chan struct{} {
+	return b.updates
+}
+
+// Routes returns the routes of the last successful query
+func (b *BirdCLI) Routes() []route.FlowspecRoute {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.routes
+}
+
+// Rejected returns the routes of the last query that could not be parsed
+func (b *BirdCLI) Rejected() []Rejection {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.rejected
+}
+
+// Filtered returns the routes rejected by BIRD import filters if QueryFiltered is enabled
+func (b *BirdCLI) Filtered() []route.Summary {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.filtered
+}
+
+// Run detects the BIRD version and queries the routes once per interval. Query errors keep the previous routes.
+func (b *BirdCLI) Run(ctx context.Context) error {
+	return pollBird(ctx, b.name, b.config.Client, b.config.Interval, b.config.TimeFormat, b.poll)
+}
+
+// pollBird detects the dialect of the BIRD daemon and calls poll once per interval until ctx is done
+func pollBird(ctx context.Context, name string, client bird.Client, interval time.Duration, timeFormat route.TimeFormat, poll func(ctx context.Context, dialect route.Dialect) error) error {
+	detectCtx, detectCancel := context.WithTimeout(ctx, interval)
+	dialect, err := detectDialect(detectCtx, client)
+	detectCancel()
+	if err != nil {
+		return fmt.Errorf("unable to determine BIRD version: %v", err)
+	}
+	dialect = dialect.WithTimeFormat(timeFormat)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pollCtx, pollCancel := context.WithTimeout(ctx, interval)
+		err := poll(pollCtx, dialect)
+		pollCancel()
+		if err != nil && ctx.Err() == nil {
+			slog.Error("error running bird command", slog.String("source", name), slog.String("error", err.Error()))
+			metrics.SourceErrorsTotal.With(prometheus.Labels{"source": name}).Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// detectDialect reads the version of the running BIRD daemon and returns the matching parser dialect
+func detectDialect(ctx context.Context, client bird.Client) (route.Dialect, error) {
+	response, err := client.Command(ctx, "show status")
+	if err != nil {
+		return route.Dialect{}, err
+	}
+
+	version, err := bird.ParseVersion(response)
+	if err != nil {
+		return route.Dialect{}, err
+	}
+
+	dialect, err := route.DialectForVersion(version.Major)
+	if err != nil {
+		return route.Dialect{}, fmt.Errorf("BIRD %s: %v", version, err)
+	}
+	slog.Info("detected BIRD version", slog.String("version", version.String()), slog.String("dialect", dialect.String()))
+
+	return dialect, nil
+}
+
+// queryBird runs the given commands and returns the raw routes of all responses as split by split
+func queryBird(ctx context.Context, client bird.Client, commands []string, split func(string) []string) ([]string, error) {
+	var rawRoutes []string
+	for _, command := range commands {
+		response, err := client.Command(ctx, command)
+		if err != nil {
+			return nil, err
+		}
+		rawRoutes = append(rawRoutes, split(response)...)
+	}
+	return rawRoutes, nil
+}
+
+// queryBirdTables runs the commands of the tables and returns the raw routes of all responses as split by split,
+// along with the table of each route. Routes of commands without a table, e.g. of the default tables, have an
+// empty table.
+func queryBirdTables(ctx context.Context, client bird.Client, tables []string, commands []string, split func(string) []string) ([]string, []string, error) {
+	var rawRoutes, rawRouteTables []string
+	for i, command := range commands {
+		commandRoutes, err := queryBird(ctx, client, []string{command}, split)
+		if err != nil {
+			return nil, nil, err
+		}
+		table := ""
+		if len(tables) == len(commands) {
+			table = tables[i]
+		}
+		rawRoutes = append(rawRoutes, commandRoutes...)
+		for range commandRoutes {
+			rawRouteTables = append(rawRouteTables, table)
+		}
+	}
+	return rawRoutes, rawRouteTables, nil
+}
+
+// poll queries and parses the flowspec routes. Routes that can not be parsed are kept as rejected.
+func (b *BirdCLI) poll(ctx context.Context, dialect route.Dialect) error {
+	rawRoutes, rawRouteTables, err := queryBirdTables(ctx, b.config.Client, b.config.Query.Tables, b.config.Query.Commands(), route.SplitResponse)
+	if err != nil {
+		return err
+	}
+
+	var filtered []route.Summary
+	if b.config.QueryFiltered {
+		rawFilteredRoutes, filteredErr := queryBird(ctx, b.config.Client, b.config.Query.FilteredCommands(), route.SplitResponse)
+		if filteredErr != nil {
+			slog.Warn("error querying filtered routes", slog.String("error", filteredErr.Error()))
+		} else {
+			filtered = make([]route.Summary, 0, len(rawFilteredRoutes))
+			for _, rawFilteredRoute := range rawFilteredRoutes {
+				filtered = append(filtered, route.ParseSummary(rawFilteredRoute))
+			}
+		}
+	}
+
+	var routes []route.FlowspecRoute
+	var rejected []Rejection
+	for i, rawRoute := range rawRoutes {
+		flowSpecRoute, parseErr := dialect.ParseFlowSpecRoute(rawRoute)
+		if parseErr != nil {
+			slog.Warn("error parsing flowspec route", slog.String("error", parseErr.Error()))
+			rejected = append(rejected, Rejection{Summary: route.ParseSummary(rawRoute), Reason: parseErr.Error()})
+			continue
+		}
+		flowSpecRoute.SessionAttrs.Table = rawRouteTables[i]
+		routes = append(routes, flowSpecRoute)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	changed := !reflect.DeepEqual(routes, b.routes) || !reflect.DeepEqual(rejected, b.rejected)
+	b.routes = routes
+	b.rejected = rejected
+	if filtered != nil || !b.config.QueryFiltered {
+		b.filtered = filtered
+	}
+	if changed {
+		Notify(b.updates)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func TestQueryBirdTables(t *testing.T) {
+	client := fakeBird(t, blackholeResponse)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rawRoutes, tables, err := queryBirdTables(ctx, client, []string{"vrf_blue", "vrf_red"}, []string{"show route table vrf_blue", "show route table vrf_red"}, route.SplitUnicastResponse)
+	require.NoError(t, err)
+	assert.Len(t, rawRoutes, 6)
+	assert.Equal(t, []string{"vrf_blue", "vrf_blue", "vrf_blue", "vrf_red", "vrf_red", "vrf_red"}, tables)
+
+	// Commands of the default tables
+	rawRoutes, tables, err = queryBirdTables(ctx, client, nil, []string{"show route"}, route.SplitUnicastResponse)
+	require.NoError(t, err)
+	assert.Len(t, rawRoutes, 3)
+	assert.Equal(t, []string{"", "", ""}, tables)
+}
@@ -0,0 +1,157 @@
+package source
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"bird-flowspec-daemon/internal/bird"
+	"bird-flowspec-daemon/internal/route"
+)
+
+// BlackholeConfig configures the remotely triggered blackhole (RTBH) source
+type BlackholeConfig struct {
+	Client bird.Client
+	// Tables to query, the BIRD default tables are used if empty
+	Tables []string
+	// DestinationCommunities mark routes of which traffic to the destination is dropped, e.g. BLACKHOLE (65535:666)
+	DestinationCommunities []bird.Community
+	// SourceCommunities mark routes of which traffic from the source is dropped (RFC 5635)
+	SourceCommunities []bird.Community
+	Interval          time.Duration
+	TimeFormat        route.TimeFormat
+}
+
+// Query returns the BIRD query for unicast routes carrying any of the configured communities
+func (c BlackholeConfig) Query() bird.BlackholeQuery {
+	return bird.BlackholeQuery{
+		Tables:      c.Tables,
+		Communities: append(append([]bird.Community{}, c.DestinationCommunities...), c.SourceCommunities...),
+	}
+}
+
+// Blackhole polls unicast routes tagged with blackhole communities via the BIRD CLI and provides them as
+// flowspec routes dropping traffic to or from the prefix of the route
+type Blackhole struct {
+	name   string
+	config BlackholeConfig
+
+	mu       sync.RWMutex
+	routes   []route.FlowspecRoute
+	rejected []Rejection
+	updates  chan struct{}
+}
+
+// NewBlackhole creates a RTBH source, the BIRD version is detected when it starts running
+func NewBlackhole(name string, config BlackholeConfig) *Blackhole {
+	return &Blackhole{
+		name:    name,
+		config:  config,
+		updates: make(chan struct{}, 1),
+	}
+}
+
+func (b *Blackhole) Name() string {
+	return b.name
+}
+
+func (b *Blackhole) Updates() <-chan struct{} {
+	return b.updates
+}
+
+// Routes returns the drop routes of the last successful query
+func (b *Blackhole) Routes() []route.FlowspecRoute {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.routes
+}
+
+// Rejected returns the routes of the last query that could not be parsed
+func (b *Blackhole) Rejected() []Rejection {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.rejected
+}
+
+// Run detects the BIRD version and queries the routes once per interval. Query errors keep the previous routes.
+func (b *Blackhole) Run(ctx context.Context) error {
+	return pollBird(ctx, b.name, b.config.Client, b.config.Interval, b.config.TimeFormat, b.poll)
+}
+
+func (b *Blackhole) poll(ctx context.Context, dialect route.Dialect) error {
+	query := b.config.Query()
+	rawRoutes, rawRouteTables, err := queryBirdTables(ctx, b.config.Client, query.Tables, query.Commands(), route.SplitUnicastResponse)
+	if err != nil {
+		return err
+	}
+
+	var routes []route.FlowspecRoute
+	var rejected []Rejection
+	for i, rawRoute := range rawRoutes {
+		unicastRoute, parseErr := dialect.ParseUnicastRoute(rawRoute)
+		if parseErr != nil {
+			slog.Warn("error parsing blackhole route", slog.String("error", parseErr.Error()))
+			net, _, _ := strings.Cut(rawRoute, " ")
+			rejected = append(rejected, Rejection{Summary: route.Summary{Net: net, Attributes: []string{}}, Reason: parseErr.Error()})
+			continue
+		}
+		for _, dropRoute := range b.dropRoutes(unicastRoute) {
+			dropRoute.SessionAttrs.Table = rawRouteTables[i]
+			routes = append(routes, dropRoute)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !reflect.DeepEqual(routes, b.routes) || !reflect.DeepEqual(rejected, b.rejected) {
+		Notify(b.updates)
+	}
+	b.routes = routes
+	b.rejected = rejected
+	return nil
+}
+
+// dropRoutes converts a blackhole route into flowspec routes dropping traffic to the destination and from the
+// source, depending on the communities of the route
+func (b *Blackhole) dropRoutes(unicastRoute route.UnicastRoute) []route.FlowspecRoute {
+	var routes []route.FlowspecRoute
+	for _, target := range []struct {
+		communities []bird.Community
+		source      bool
+	}{
+		{b.config.DestinationCommunities, false},
+		{b.config.SourceCommunities, true},
+	} {
+		if !hasAnyCommunity(unicastRoute, target.communities) {
+			continue
+		}
+
+		var flowSpecRoute route.FlowspecRoute
+		if target.source {
+			flowSpecRoute.MatchAttrs.Source = unicastRoute.Net
+		} else {
+			flowSpecRoute.MatchAttrs.Destination = unicastRoute.Net
+		}
+		flowSpecRoute.SessionAttrs = unicastRoute.SessionAttrs
+		flowSpecRoute.BGPAttrs = unicastRoute.BGPAttrs
+		flowSpecRoute.Action = route.ActionTrafficRateBytes
+		routes = append(routes, flowSpecRoute)
+	}
+	return routes
+}
+
+func hasAnyCommunity(unicastRoute route.UnicastRoute, communities []bird.Community) bool {
+	for _, community := range communities {
+		if community.IsLarge() {
+			if unicastRoute.HasLargeCommunity(route.LargeCommunity{GlobalAdmin: community[0], LocalData1: community[1], LocalData2: community[2]}) {
+				return true
+			}
+		} else if unicastRoute.HasCommunity(route.Community{ASN: uint16(community[0]), Value: uint16(community[1])}) {
+			return true
+		}
+	}
+	return false
+}
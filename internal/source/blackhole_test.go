@@ -0,0 +1,91 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/bird"
+	"bird-flowspec-daemon/internal/route"
+)
+
+const blackholeResponse = `1007-Table master4:
+ 192.0.2.1/32         unicast [upstream1 2025-01-13 from 198.51.100.1] * (100) [AS65001i]
+ 	via 198.51.100.1 on eth0
+1008-	Type: BGP univ
+1012-	BGP.origin: IGP
+ 	BGP.as_path: 65001
+ 	BGP.community: (65535,666)
+ 203.0.113.0/24       unicast [upstream1 2025-01-13 from 198.51.100.1] * (100) [AS65001i]
+1008-	Type: BGP univ
+1012-	BGP.origin: IGP
+ 	BGP.as_path: 65001
+ 	BGP.community: (65535,666)
+ 	BGP.large_community: (65000, 666, 2)
+ 198.51.100.0/24      unicast [upstream1 yesterday from 198.51.100.1] * (100) [AS65001i]
+1012-	BGP.as_path: 65001
+0000 
+`
+
+// fakeBird serves a BIRD CLI socket answering every command with response
+func fakeBird(t *testing.T, response string) bird.Client {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+					conn.Write([]byte(response))
+				}
+			}()
+		}
+	}()
+	return bird.Client{SocketPath: path}
+}
+
+func TestBlackhole(t *testing.T) {
+	blackhole := NewBlackhole("rtbh", BlackholeConfig{
+		Client:                 fakeBird(t, blackholeResponse),
+		DestinationCommunities: []bird.Community{{65535, 666}},
+		SourceCommunities:      []bird.Community{{65000, 666, 2}},
+		Interval:               time.Minute,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, blackhole.poll(ctx, route.DialectBird2.WithTimeFormat(route.TimeFormatAuto)))
+	<-blackhole.Updates()
+
+	var nets []string
+	for _, flowSpecRoute := range blackhole.Routes() {
+		nets = append(nets, flowSpecRoute.Net())
+		assert.Equal(t, int64(route.ActionTrafficRateBytes), flowSpecRoute.Action)
+		assert.Equal(t, int64(0), flowSpecRoute.Argument)
+		assert.Equal(t, "upstream1", flowSpecRoute.SessionAttrs.SessionName)
+	}
+	assert.Equal(t, []string{
+		"flow4 { dst 192.0.2.1/32; }",
+		"flow4 { dst 203.0.113.0/24; }",
+		"flow4 { src 203.0.113.0/24; }",
+	}, nets)
+
+	rejected := blackhole.Rejected()
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "198.51.100.0/24", rejected[0].Net)
+
+	assert.Len(t, blackhole.config.Query().Communities, 2)
+}
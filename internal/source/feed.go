@@ -0,0 +1,41 @@
+package source
+
+import (
+	"context"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// feed is implemented by the route receivers of the BMP, BGP and ExaBGP packages
+type feed interface {
+	Routes() []route.FlowspecRoute
+	Updates() <-chan struct{}
+}
+
+// Feed adapts a route receiver pushing routes to a RouteSource
+type Feed struct {
+	name string
+	feed feed
+	run  func(ctx context.Context) error
+}
+
+// NewFeed creates a source of the routes of f, which receives routes while run is running
+func NewFeed(name string, f feed, run func(ctx context.Context) error) *Feed {
+	return &Feed{name: name, feed: f, run: run}
+}
+
+func (f *Feed) Name() string {
+	return f.name
+}
+
+func (f *Feed) Run(ctx context.Context) error {
+	return f.run(ctx)
+}
+
+func (f *Feed) Routes() []route.FlowspecRoute {
+	return f.feed.Routes()
+}
+
+func (f *Feed) Updates() <-chan struct{} {
+	return f.feed.Updates()
+}
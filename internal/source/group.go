@@ -0,0 +1,197 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"bird-flowspec-daemon/internal/flowspec"
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+)
+
+// Policy decides which routes are kept if several sources provide routes with identical match attributes
+type Policy string
+
+const (
+	// PolicyAll keeps the routes of all sources
+	PolicyAll Policy = "all"
+	// PolicyFirst keeps the route of the source configured first
+	PolicyFirst Policy = "first"
+	// PolicyStrictest keeps the route with the most restrictive action, drop before the lowest rate limit
+	PolicyStrictest Policy = "strictest"
+)
+
+// Policies contains the names of all merge policies
+var Policies = []string{string(PolicyAll), string(PolicyFirst), string(PolicyStrictest)}
+
+// Order decides the order of the merged routes
+type Order string
+
+const (
+	// OrderSources keeps the routes in the order of the sources
+	OrderSources Order = "sources"
+	// OrderRFC sorts the routes by flowspec precedence (RFC 8955 section 5.1)
+	OrderRFC Order = "rfc"
+)
+
+// Orders contains the names of all route orders
+var Orders = []string{string(OrderSources), string(OrderRFC)}
+
+// Group runs several route sources at once and merges their routes
+type Group struct {
+	sources []RouteSource
+	policy  Policy
+	order   Order
+	updates chan struct{}
+}
+
+// NewGroup creates a group of sources, their order decides the precedence for the merge policy
+func NewGroup(policy Policy, order Order, sources ...RouteSource) *Group {
+	return &Group{
+		sources: sources,
+		policy:  policy,
+		order:   order,
+		updates: make(chan struct{}, 1),
+	}
+}
+
+// Sources returns the sources of the group in their configured order
+func (g *Group) Sources() []RouteSource {
+	return g.sources
+}
+
+// Updates signals changes of the routes of any source
+func (g *Group) Updates() <-chan struct{} {
+	return g.updates
+}
+
+// Run runs all sources until ctx is done. The first source error stops the other sources and is returned.
+func (g *Group) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(g.sources))
+	for _, routeSource := range g.sources {
+		go func(routeSource RouteSource) {
+			if err := routeSource.Run(ctx); err != nil {
+				metrics.SourceErrorsTotal.With(prometheus.Labels{"source": routeSource.Name()}).Inc()
+				errs <- fmt.Errorf("route source %s: %v", routeSource.Name(), err)
+			}
+		}(routeSource)
+		go func(updates <-chan struct{}) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-updates:
+					Notify(g.updates)
+				}
+			}
+		}(routeSource.Updates())
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// Routes returns the merged routes of all sources with their provenance set to the source name
+func (g *Group) Routes() []route.FlowspecRoute {
+	snapshots := make([][]route.FlowspecRoute, 0, len(g.sources))
+	for _, routeSource := range g.sources {
+		routes := routeSource.Routes()
+		snapshot := make([]route.FlowspecRoute, 0, len(routes))
+		for _, flowSpecRoute := range routes {
+			flowSpecRoute.SessionAttrs.Source = routeSource.Name()
+			snapshot = append(snapshot, flowSpecRoute)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	merged := Merge(g.policy, snapshots)
+	if g.order == OrderRFC {
+		Sort(merged)
+	}
+
+	kept := make(map[string]int)
+	for _, flowSpecRoute := range merged {
+		kept[flowSpecRoute.SessionAttrs.Source]++
+	}
+	for i, routeSource := range g.sources {
+		labels := prometheus.Labels{"source": routeSource.Name()}
+		metrics.SourceRoutes.With(labels).Set(float64(len(snapshots[i])))
+		metrics.SourceRoutesShadowed.With(labels).Set(float64(len(snapshots[i]) - kept[routeSource.Name()]))
+	}
+
+	return merged
+}
+
+// Rejected returns the rejected routes of all sources implementing Rejecter
+func (g *Group) Rejected() []Rejection {
+	var rejected []Rejection
+	for _, routeSource := range g.sources {
+		if rejecter, ok := routeSource.(Rejecter); ok {
+			for _, rejection := range rejecter.Rejected() {
+				rejection.Source = routeSource.Name()
+				rejected = append(rejected, rejection)
+			}
+		}
+	}
+	return rejected
+}
+
+// Merge combines the routes of several sources in their order according to policy
+func Merge(policy Policy, snapshots [][]route.FlowspecRoute) []route.FlowspecRoute {
+	var merged []route.FlowspecRoute
+	index := make(map[string]int)
+	for _, routes := range snapshots {
+		for _, flowSpecRoute := range routes {
+			if policy == PolicyAll {
+				merged = append(merged, flowSpecRoute)
+				continue
+			}
+
+			key := flowSpecRoute.Net()
+			i, ok := index[key]
+			switch {
+			case !ok:
+				index[key] = len(merged)
+				merged = append(merged, flowSpecRoute)
+			case policy == PolicyStrictest && stricter(flowSpecRoute, merged[i]):
+				merged[i] = flowSpecRoute
+			}
+		}
+	}
+	return merged
+}
+
+// Sort sorts routes by flowspec precedence (RFC 8955 section 5.1), routes of equal precedence keep their order
+func Sort(routes []route.FlowspecRoute) {
+	nlris := make(map[string]flowspec.NLRI, len(routes))
+	for _, flowSpecRoute := range routes {
+		nlris[flowSpecRoute.Net()] = flowspec.FromRoute(flowSpecRoute)
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return flowspec.Compare(nlris[routes[i].Net()], nlris[routes[j].Net()]) < 0
+	})
+}
+
+// stricter reports whether the action of a restricts traffic more than the action of b
+func stricter(a, b route.FlowspecRoute) bool {
+	if a.Action != route.ActionTrafficRateBytes && a.Action != route.ActionTrafficRatePackets {
+		return false
+	}
+	if b.Action != route.ActionTrafficRateBytes && b.Action != route.ActionTrafficRatePackets {
+		return true
+	}
+	if a.Argument == 0 || b.Argument == 0 {
+		return a.Argument == 0 && b.Argument != 0
+	}
+	return a.Action == b.Action && a.Argument < b.Argument
+}
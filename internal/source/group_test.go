@@ -0,0 +1,112 @@
+package source
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func testRoute(destination string, action, argument int64) route.FlowspecRoute {
+	var flowSpecRoute route.FlowspecRoute
+	_, network, _ := net.ParseCIDR(destination)
+	flowSpecRoute.MatchAttrs.Destination = *network
+	flowSpecRoute.Action = action
+	flowSpecRoute.Argument = argument
+	return flowSpecRoute
+}
+
+func TestMerge(t *testing.T) {
+	type testCase struct {
+		name     string
+		policy   Policy
+		expected []route.FlowspecRoute
+	}
+
+	limit := testRoute("192.0.2.1/32", route.ActionTrafficRateBytes, 1000)
+	drop := testRoute("192.0.2.1/32", route.ActionTrafficRateBytes, 0)
+	other := testRoute("198.51.100.0/24", route.ActionTrafficRatePackets, 100)
+	snapshots := [][]route.FlowspecRoute{{limit, other}, {drop}}
+
+	testCases := []testCase{
+		{name: "all", policy: PolicyAll, expected: []route.FlowspecRoute{limit, other, drop}},
+		{name: "first", policy: PolicyFirst, expected: []route.FlowspecRoute{limit, other}},
+		{name: "strictest", policy: PolicyStrictest, expected: []route.FlowspecRoute{drop, other}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Merge(tc.policy, snapshots))
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	routes := []route.FlowspecRoute{
+		testRoute("2001:db8::/32", route.ActionTrafficRateBytes, 0),
+		testRoute("192.0.2.0/24", route.ActionTrafficRateBytes, 0),
+		testRoute("192.0.2.0/25", route.ActionTrafficRateBytes, 0),
+		testRoute("192.0.2.0/24", route.ActionTrafficRateBytes, 100),
+	}
+	routes[1].MatchAttrs.Protocol = 17
+
+	Sort(routes)
+
+	var nets []string
+	for _, flowSpecRoute := range routes {
+		nets = append(nets, flowSpecRoute.Net())
+	}
+	assert.Equal(t, []string{
+		"flow4 { dst 192.0.2.0/25; }",
+		"flow4 { dst 192.0.2.0/24; proto 17; }",
+		"flow4 { dst 192.0.2.0/24; }",
+		"flow6 { dst 2001:db8::/32; }",
+	}, nets)
+}
+
+func TestStricter(t *testing.T) {
+	bytes := testRoute("192.0.2.1/32", route.ActionTrafficRateBytes, 1000)
+	lowerBytes := testRoute("192.0.2.1/32", route.ActionTrafficRateBytes, 10)
+	packets := testRoute("192.0.2.1/32", route.ActionTrafficRatePackets, 10)
+	drop := testRoute("192.0.2.1/32", route.ActionTrafficRatePackets, 0)
+	redirect := testRoute("192.0.2.1/32", route.ActionRedirect, 1)
+
+	assert.True(t, stricter(lowerBytes, bytes))
+	assert.False(t, stricter(bytes, lowerBytes))
+	assert.False(t, stricter(packets, bytes))
+	assert.True(t, stricter(drop, bytes))
+	assert.False(t, stricter(bytes, drop))
+	assert.True(t, stricter(bytes, redirect))
+	assert.False(t, stricter(redirect, bytes))
+}
+
+func TestGroup(t *testing.T) {
+	first := NewStatic("first", writeRules(t, `[{"destination": "192.0.2.1/32", "action": "drop"}]`), time.Hour)
+	second := NewStatic("second", writeRules(t, `[{"destination": "192.0.2.1/32", "action": "rate-limit-bytes", "rate": 100}]`), time.Hour)
+	group := NewGroup(PolicyFirst, OrderSources, first, second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- group.Run(ctx)
+	}()
+	for len(first.Routes()) == 0 || len(second.Routes()) == 0 {
+		<-group.Updates()
+	}
+
+	routes := group.Routes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, "first", routes[0].SessionAttrs.Source)
+	assert.Equal(t, int64(0), routes[0].Argument)
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	failing := NewGroup(PolicyAll, OrderSources, NewStatic("missing", "/nonexistent/rules.json", time.Hour))
+	assert.ErrorContains(t, failing.Run(context.Background()), "route source missing")
+}
@@ -0,0 +1,36 @@
+package source
+
+import (
+	"errors"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// UpdateRIB applies the withdrawals and announcements of an update to the routes of a peer, indexed by the key
+// of their NLRI. An announcement that fails to decode still replaces the previous route of its key, which must
+// not be enforced any longer. The decode errors are returned.
+func UpdateRIB[N any](routes map[string]route.FlowspecRoute, withdrawn, announced []N, key func(N) string, decode func(N) (route.FlowspecRoute, error)) error {
+	for _, nlri := range withdrawn {
+		delete(routes, key(nlri))
+	}
+
+	var decodeErrors []error
+	for _, nlri := range announced {
+		flowSpecRoute, err := decode(nlri)
+		if err != nil {
+			delete(routes, key(nlri))
+			decodeErrors = append(decodeErrors, err)
+			continue
+		}
+		routes[key(nlri)] = flowSpecRoute
+	}
+	return errors.Join(decodeErrors...)
+}
+
+// Notify signals an update without blocking, pending signals are coalesced
+func Notify(updates chan struct{}) {
+	select {
+	case updates <- struct{}{}:
+	default:
+	}
+}
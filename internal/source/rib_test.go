@@ -0,0 +1,32 @@
+package source
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func TestUpdateRIB(t *testing.T) {
+	routes := map[string]route.FlowspecRoute{
+		"192.0.2.1/32":    testRoute("192.0.2.1/32", route.ActionTrafficRateBytes, 0),
+		"192.0.2.2/32":    testRoute("192.0.2.2/32", route.ActionTrafficRateBytes, 0),
+		"198.51.100.0/24": testRoute("198.51.100.0/24", route.ActionTrafficRateBytes, 0),
+	}
+	decode := func(destination string) (route.FlowspecRoute, error) {
+		if destination == "198.51.100.0/24" {
+			return route.FlowspecRoute{}, errors.New("unsupported component")
+		}
+		return testRoute(destination, route.ActionTrafficRateBytes, 1000), nil
+	}
+	key := func(destination string) string { return destination }
+
+	err := UpdateRIB(routes, []string{"192.0.2.1/32"}, []string{"192.0.2.2/32", "203.0.113.0/24", "198.51.100.0/24"}, key, decode)
+	assert.EqualError(t, err, "unsupported component")
+	assert.Equal(t, map[string]route.FlowspecRoute{
+		"192.0.2.2/32":   testRoute("192.0.2.2/32", route.ActionTrafficRateBytes, 1000),
+		"203.0.113.0/24": testRoute("203.0.113.0/24", route.ActionTrafficRateBytes, 1000),
+	}, routes)
+}
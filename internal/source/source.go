@@ -0,0 +1,30 @@
+package source
+
+import (
+	"context"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+// RouteSource provides flowspec routes to the daemon, either polled or pushed
+type RouteSource interface {
+	// Name identifies the source in logs, metrics and route provenance
+	Name() string
+	// Run provides routes until ctx is done, an error ends the source
+	Run(ctx context.Context) error
+	// Routes returns a snapshot of the current routes
+	Routes() []route.FlowspecRoute
+	// Updates signals changes of the routes, pending signals are coalesced
+	Updates() <-chan struct{}
+}
+
+// Rejecter is implemented by sources that receive routes they are unable to provide
+type Rejecter interface {
+	Rejected() []Rejection
+}
+
+// Rejection is a flowspec route the daemon does not turn into an nftables rule
+type Rejection struct {
+	route.Summary
+	Reason string `json:"reason"`
+}
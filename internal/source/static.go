@@ -0,0 +1,196 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+
+	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/route"
+)
+
+// actions maps the action names of static rules to flowspec traffic actions
+var actions = map[string]int64{
+	"drop":               route.ActionTrafficRateBytes,
+	"rate-limit-bytes":   route.ActionTrafficRateBytes,
+	"rate-limit-packets": route.ActionTrafficRatePackets,
+}
+
+// StaticRule is a locally defined flowspec rule
+type StaticRule struct {
+	Name            string `json:"name,omitempty" yaml:"name"`
+	Destination     string `json:"destination,omitempty" yaml:"destination"`
+	Source          string `json:"source,omitempty" yaml:"source"`
+	Protocol        uint64 `json:"protocol,omitempty" yaml:"protocol"`
+	SourcePort      uint16 `json:"source-port,omitempty" yaml:"source-port"`
+	DestinationPort uint16 `json:"destination-port,omitempty" yaml:"destination-port"`
+	// Action is one of drop, rate-limit-bytes or rate-limit-packets
+	Action string `json:"action" yaml:"action"`
+	// Rate is the limit per second of the rate limit actions
+	Rate int64 `json:"rate,omitempty" yaml:"rate"`
+}
+
+// Route converts the rule into a flowspec route
+func (r StaticRule) Route() (route.FlowspecRoute, error) {
+	var flowSpecRoute route.FlowspecRoute
+	for _, prefix := range []struct {
+		value  string
+		target *net.IPNet
+	}{
+		{r.Destination, &flowSpecRoute.MatchAttrs.Destination},
+		{r.Source, &flowSpecRoute.MatchAttrs.Source},
+	} {
+		if prefix.value == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(prefix.value)
+		if err != nil {
+			return route.FlowspecRoute{}, fmt.Errorf("invalid prefix %q", prefix.value)
+		}
+		*prefix.target = *network
+	}
+	if flowSpecRoute.MatchAttrs.Destination.IP != nil && flowSpecRoute.MatchAttrs.Source.IP != nil &&
+		(flowSpecRoute.MatchAttrs.Destination.IP.To4() == nil) != (flowSpecRoute.MatchAttrs.Source.IP.To4() == nil) {
+		return route.FlowspecRoute{}, fmt.Errorf("source and destination are of different address families")
+	}
+	flowSpecRoute.MatchAttrs.Protocol = r.Protocol
+	flowSpecRoute.MatchAttrs.SourcePort = r.SourcePort
+	flowSpecRoute.MatchAttrs.DestinationPort = r.DestinationPort
+
+	action, ok := actions[r.Action]
+	if !ok {
+		return route.FlowspecRoute{}, fmt.Errorf("unknown action %q", r.Action)
+	}
+	flowSpecRoute.Action = action
+	switch {
+	case r.Action == "drop":
+	case r.Rate <= 0:
+		return route.FlowspecRoute{}, fmt.Errorf("action %s requires a positive rate", r.Action)
+	default:
+		flowSpecRoute.Argument = r.Rate
+	}
+
+	return flowSpecRoute, nil
+}
+
+// Static provides the flowspec rules of a YAML or JSON file
+type Static struct {
+	name     string
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	data    []byte
+	routes  []route.FlowspecRoute
+	updates chan struct{}
+}
+
+// NewStatic creates a source of the rules in the file at path, which is checked for changes once per interval
+func NewStatic(name, path string, interval time.Duration) *Static {
+	return &Static{
+		name:     name,
+		path:     path,
+		interval: interval,
+		updates:  make(chan struct{}, 1),
+	}
+}
+
+func (s *Static) Name() string {
+	return s.name
+}
+
+func (s *Static) Updates() <-chan struct{} {
+	return s.updates
+}
+
+func (s *Static) Routes() []route.FlowspecRoute {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.routes
+}
+
+// Run loads the rules file and reloads it on changes. An invalid file ends the source when it is loaded
+// the first time and keeps the previous rules afterwards.
+func (s *Static) Run(ctx context.Context) error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := s.reload(); err != nil {
+			slog.Error("error reloading static rules", slog.String("source", s.name), slog.String("error", err.Error()))
+			metrics.SourceErrorsTotal.With(prometheus.Labels{"source": s.name}).Inc()
+		}
+	}
+}
+
+// reload loads the rules if the content of the file changed
+func (s *Static) reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	unchanged := s.data != nil && bytes.Equal(data, s.data)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	routes, err := s.parse(data)
+	if err != nil {
+		return fmt.Errorf("invalid rules file %s: %v", s.path, err)
+	}
+	slog.Info("loaded static rules", slog.String("source", s.name), slog.String("path", s.path), slog.Int("rules", len(routes)))
+
+	s.mu.Lock()
+	s.data = data
+	s.routes = routes
+	s.mu.Unlock()
+	Notify(s.updates)
+	return nil
+}
+
+// parse converts all rules of a YAML or JSON document
+func (s *Static) parse(data []byte) ([]route.FlowspecRoute, error) {
+	var rules []StaticRule
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	routes := make([]route.FlowspecRoute, 0, len(rules))
+	for i, rule := range rules {
+		flowSpecRoute, err := rule.Route()
+		if err != nil {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("invalid rule %s: %v", name, err)
+		}
+		flowSpecRoute.SessionAttrs.SessionName = s.name
+		routes = append(routes, flowSpecRoute)
+	}
+	return routes, nil
+}
@@ -0,0 +1,104 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func writeRules(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestStaticRuleRoute(t *testing.T) {
+	type testCase struct {
+		name     string
+		rule     StaticRule
+		expected string
+		action   int64
+		argument int64
+		err      string
+	}
+
+	testCases := []testCase{
+		{
+			name:     "drop",
+			rule:     StaticRule{Destination: "192.0.2.1/32", Protocol: 17, DestinationPort: 123, Action: "drop"},
+			expected: "flow4 { dst 192.0.2.1/32; proto 17; dport 123; }",
+			action:   route.ActionTrafficRateBytes,
+		},
+		{
+			name:     "packet rate limit",
+			rule:     StaticRule{Source: "2001:db8::/32", Protocol: 58, Action: "rate-limit-packets", Rate: 100},
+			expected: "flow6 { src 2001:db8::/32; next header 58; }",
+			action:   route.ActionTrafficRatePackets,
+			argument: 100,
+		},
+		{name: "invalid prefix", rule: StaticRule{Destination: "192.0.2.1", Action: "drop"}, err: `invalid prefix "192.0.2.1"`},
+		{name: "mixed families", rule: StaticRule{Destination: "192.0.2.1/32", Source: "2001:db8::/32", Action: "drop"}, err: "source and destination are of different address families"},
+		{name: "unknown action", rule: StaticRule{Destination: "192.0.2.1/32", Action: "redirect"}, err: `unknown action "redirect"`},
+		{name: "missing rate", rule: StaticRule{Destination: "192.0.2.1/32", Action: "rate-limit-bytes"}, err: "action rate-limit-bytes requires a positive rate"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flowSpecRoute, err := tc.rule.Route()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, flowSpecRoute.Net())
+			assert.Equal(t, tc.action, flowSpecRoute.Action)
+			assert.Equal(t, tc.argument, flowSpecRoute.Argument)
+		})
+	}
+}
+
+func TestStaticReload(t *testing.T) {
+	path := writeRules(t, `
+- name: ntp
+  destination: 192.0.2.1/32
+  protocol: 17
+  source-port: 123
+  action: drop
+`)
+	static := NewStatic("static", path, time.Hour)
+	require.NoError(t, static.reload())
+	<-static.Updates()
+	routes := static.Routes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, "flow4 { dst 192.0.2.1/32; proto 17; sport 123; }", routes[0].Net())
+	assert.Equal(t, "static", routes[0].SessionAttrs.SessionName)
+
+	// Unchanged files are not parsed again
+	require.NoError(t, static.reload())
+	assert.Empty(t, static.Updates())
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"destination": "2001:db8::/32", "action": "rate-limit-bytes", "rate": 1000}]`), 0o644))
+	require.NoError(t, static.reload())
+	<-static.Updates()
+	routes = static.Routes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, int64(1000), routes[0].Argument)
+
+	// Invalid files keep the previous rules
+	require.NoError(t, os.WriteFile(path, []byte(`[{"destination": "2001:db8::/32", "action": "drop"}, {"name": "broken", "action": "drop", "destination": "x"}]`), 0o644))
+	assert.EqualError(t, static.reload(), `invalid rules file `+path+`: invalid rule broken: invalid prefix "x"`)
+	assert.Equal(t, routes, static.Routes())
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"destination": "2001:db8::/32", "action": "drop", "port": 53}]`), 0o644))
+	assert.ErrorContains(t, static.reload(), "field port not found")
+
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	require.NoError(t, static.reload())
+	assert.Empty(t, static.Routes())
+}
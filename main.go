@@ -3,14 +3,15 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -22,86 +23,267 @@ import (
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"bird-flowspec-daemon/internal/bgp"
+	"bird-flowspec-daemon/internal/bird"
+	"bird-flowspec-daemon/internal/bmp"
+	"bird-flowspec-daemon/internal/detector"
+	"bird-flowspec-daemon/internal/exabgp"
 	"bird-flowspec-daemon/internal/metrics"
+	"bird-flowspec-daemon/internal/originate"
 	"bird-flowspec-daemon/internal/route"
 	"bird-flowspec-daemon/internal/rulebuilder"
 	"bird-flowspec-daemon/internal/rulesum"
+	"bird-flowspec-daemon/internal/source"
 )
 
-func birdCommand(ctx context.Context, command string) (string, error) {
-	defer func(start time.Time) {
-		metrics.BirdSocketQueryDurationSeconds.Observe(time.Since(start).Seconds())
-	}(time.Now())
-	slog.Debug("Reading BIRD rules", slog.String("command", command))
-	defer func() {
-		slog.Debug("Finished reading BIRD rules", slog.String("command", command))
-	}()
-
-	// Connect to the Bird socket
-	conn, err := net.Dial("unix", config.birdSocketPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to connect to bird socket: %v", err)
-	}
-	defer conn.Close()
-
-	// Create a channel to handle the scanner
-	done := make(chan struct{})
-	var response strings.Builder
-	errChan := make(chan error, 1)
-
-	// Send the command to retrieve all routes
-	_, err = conn.Write([]byte(fmt.Sprintf("%s\n", command)))
-	if err != nil {
-		return "", fmt.Errorf("failed to write to bird socket: %v", err)
-	}
-
-	go func() {
-		scanner := bufio.NewScanner(conn)
-		for scanner.Scan() {
-			line := scanner.Text()
-			response.WriteString(line + "\n")
-			if strings.HasPrefix(line, "0000 ") {
-				break
-			}
-		}
-		if err := scanner.Err(); err != nil {
-			errChan <- fmt.Errorf("error reading from bird socket: %v", err)
-		} else {
-			close(done)
-		}
-	}()
-
-	// Wait for either the context to be done or the reading to complete
-	select {
-	case <-ctx.Done():
-		return "", fmt.Errorf("operation canceled: %v", ctx.Err())
-	case err := <-errChan:
-		return "", err
-	case <-done:
-		return response.String(), nil
-	}
-}
-
 type configuration struct {
-	birdSocketPath       string
-	debug                bool
-	metricsListenAddress string
-	interval             time.Duration
-	enableCounter        bool
+	birdSocketPath         string
+	debug                  bool
+	metricsListenAddress   string
+	interval               time.Duration
+	enableCounter          bool
+	birdQuery              bird.Query
+	birdQueryFiltered      bool
+	birdTimeFormat         string
+	routeMaxAge            time.Duration
+	bmpListenAddress       string
+	bmpPostPolicy          bool
+	bgpNeighbor            string
+	bgpLocalAS             uint32
+	bgpRouterID            net.IP
+	bgpHoldTime            time.Duration
+	bgpRestartTime         time.Duration
+	mrtReplayPath          string
+	mrtSpeed               float64
+	mrtDryRun              bool
+	exabgp                 bool
+	sources                []string
+	mergePolicy            string
+	staticRulesPath        string
+	ruleOrder              string
+	ruleCompile            bool
+	nftTable               string
+	nftFamily              string
+	nftChain               string
+	nftHook                string
+	nftPriority            int
+	nftJumpFrom            string
+	nftJumpPosition        string
+	nftPlacement           string
+	nftDevices             []string
+	nftSplitFamilies       bool
+	ruleSessionChains      bool
+	ruleDisabledSessions   []string
+	vrfs                   map[string]string
+	vrfMatch               string
+	interfaceGroupNames    map[string]string
+	interfaceGroups        map[uint16][]string
+	ruleUpdate             string
+	ruleCopyCounters       bool
+	rtbh                   bool
+	rtbhCommunities        []string
+	rtbhSourceCommunities  []string
+	rtbhTables             []string
+	blackhole              source.BlackholeConfig
+	originateListenAddress string
+	originateFile4         string
+	originateFile6         string
+	detectorEnabled        bool
+	detectorOriginate      bool
+	detectorMaxDestination uint32
+	detector               detector.Config
 }
 
 var config = configuration{}
 
-func init() {
+// parseConfiguration parses and validates the flags into config and sets up logging
+func parseConfiguration() {
 	app := kingpin.New("bird-flowspec-daemon", "A BIRD flowspec daemon")
 	app.Flag("debug", "Enable debug mode").Short('d').BoolVar(&config.debug)
-	app.Flag("bird-socket", "Path to BIRD socket").Envar("BIRD_SOCKET_PATH").Default("/run/bird/bird.ctl").ExistingFileVar(&config.birdSocketPath)
+	app.Flag("bird-socket", "Path to BIRD socket").Envar("BIRD_SOCKET_PATH").Default("/run/bird/bird.ctl").StringVar(&config.birdSocketPath)
 	app.Flag("metrics.listen-address", "Address to listen on for metrics").Default("127.0.0.1:9302").StringVar(&config.metricsListenAddress)
 	app.Flag("interval", "Interval to check for new routes").Envar("CHECK_INTERVAL").Default("10s").DurationVar(&config.interval)
 	app.Flag("enable-counter", "Enable counter in nftables rules").Envar("ENABLE_COUNTER").Default("false").BoolVar(&config.enableCounter)
+	app.Flag("nftables.table", "nftables table of the flowspec chain, created if missing").Envar("NFTABLES_TABLE").Default("filter").StringVar(&config.nftTable)
+	app.Flag("nftables.family", "Family of the nftables table, ip and ip6 tables only enforce routes of their address family, bridge tables filter bridged frames").Envar("NFTABLES_FAMILY").Default("inet").EnumVar(&config.nftFamily, "inet", "ip", "ip6", "bridge")
+	app.Flag("nftables.chain", "nftables chain the flowspec rules are managed in, created if missing").Envar("NFTABLES_CHAIN").Default("flowspec").StringVar(&config.nftChain)
+	app.Flag("nftables.hook", "Create the flowspec chain as base chain of this hook (prerouting, input, forward or output) instead of a regular chain").Envar("NFTABLES_HOOK").EnumVar(&config.nftHook, "prerouting", "input", "forward", "output")
+	app.Flag("nftables.priority", "Priority of the flowspec base chain of --nftables.hook or the ingress chains in netdev placement").Envar("NFTABLES_PRIORITY").Default("0").IntVar(&config.nftPriority)
+	app.Flag("nftables.jump-from", "Chain of the same table to add a jump to the flowspec chain to, if it does not jump there yet").Envar("NFTABLES_JUMP_FROM").StringVar(&config.nftJumpFrom)
+	app.Flag("nftables.jump-position", "Position of the added jump in the chain of --nftables.jump-from").Envar("NFTABLES_JUMP_POSITION").Default(jumpPositionFirst).EnumVar(&config.nftJumpPosition, jumpPositionFirst, jumpPositionLast)
+	app.Flag("nftables.placement", "Where packets are dropped: 'filter' in the flowspec chain as configured, 'raw' in a prerouting chain before connection tracking, 'netdev' in ingress chains of the interfaces of --nftables.device").Envar("NFTABLES_PLACEMENT").Default("filter").EnumVar(&config.nftPlacement, "filter", "raw", "netdev")
+	app.Flag("nftables.device", "Interface to drop packets on in netdev placement, may be repeated").Envar("NFTABLES_DEVICES").StringsVar(&config.nftDevices)
+	app.Flag("nftables.split-families", "Enforce flow4 routes in an ip table and flow6 routes in an ip6 table of the name of --nftables.table, each updated independently").Envar("NFTABLES_SPLIT_FAMILIES").Default("false").BoolVar(&config.nftSplitFamilies)
+	app.Flag("bird.table", "BIRD table to query for flowspec routes, may be repeated (default: BIRD default table)").Envar("BIRD_TABLES").StringsVar(&config.birdQuery.Tables)
+	app.Flag("bird.source", "BIRD route source to include, may be repeated").Envar("BIRD_SOURCES").Default("RTS_BGP").StringsVar(&config.birdQuery.Sources)
+	app.Flag("bird.filter", "Additional BIRD filter expression routes have to match").Envar("BIRD_FILTER").StringVar(&config.birdQuery.Filter)
+	app.Flag("bird.query-filtered", "Query routes rejected by BIRD import filters for diagnostics (requires 'import keep filtered')").Envar("BIRD_QUERY_FILTERED").Default("false").BoolVar(&config.birdQueryFiltered)
+	app.Flag("bird.timeformat", "BIRD 'timeformat route' setting used to parse import times").Envar("BIRD_TIMEFORMAT").Default(string(route.TimeFormatAuto)).EnumVar(&config.birdTimeFormat, route.TimeFormats...)
+	app.Flag("route.max-age", "Ignore routes imported longer ago than this duration (0 disables expiry)").Envar("ROUTE_MAX_AGE").Default("0s").DurationVar(&config.routeMaxAge)
+	app.Flag("bmp.listen-address", "Address to accept BMP sessions on, routes are received via BMP instead of the BIRD CLI if set").Envar("BMP_LISTEN_ADDRESS").StringVar(&config.bmpListenAddress)
+	app.Flag("bmp.post-policy", "Use the post-policy instead of the pre-policy BMP route view").Envar("BMP_POST_POLICY").Default("true").BoolVar(&config.bmpPostPolicy)
+	app.Flag("bgp.neighbor", "Address of the iBGP neighbor to receive flowspec routes from, routes are received via the built-in BGP speaker instead of the BIRD CLI if set").Envar("BGP_NEIGHBOR").StringVar(&config.bgpNeighbor)
+	app.Flag("bgp.local-as", "Local AS number of the BGP speaker, the neighbor has to use the same AS").Envar("BGP_LOCAL_AS").Uint32Var(&config.bgpLocalAS)
+	app.Flag("bgp.router-id", "Router ID of the BGP speaker").Envar("BGP_ROUTER_ID").IPVar(&config.bgpRouterID)
+	app.Flag("bgp.hold-time", "Hold time proposed to the BGP neighbor").Envar("BGP_HOLD_TIME").Default("90s").DurationVar(&config.bgpHoldTime)
+	app.Flag("bgp.restart-time", "Graceful restart time announced to the BGP neighbor").Envar("BGP_RESTART_TIME").Default("120s").DurationVar(&config.bgpRestartTime)
+	app.Flag("exabgp", "Run as ExaBGP API process (encoder json) and receive routes from stdin instead of the BIRD CLI").Envar("EXABGP").Default("false").BoolVar(&config.exabgp)
+	app.Flag("mrt.replay", "Replay the flowspec routes of a MRT file (TABLE_DUMP_V2/BGP4MP) instead of receiving routes, the daemon exits at the end of the file").Envar("MRT_REPLAY").StringVar(&config.mrtReplayPath)
+	app.Flag("mrt.speed", "Replay speed relative to the recorded time, 0 replays without delays").Envar("MRT_SPEED").Default("1").Float64Var(&config.mrtSpeed)
+	app.Flag("mrt.dry-run", "Print the rule sets of a MRT replay instead of applying them to nftables").Envar("MRT_DRY_RUN").Default("false").BoolVar(&config.mrtDryRun)
+	app.Flag("source", "Route source to run, may be repeated to run several sources at once (default: the sources configured by --bmp.listen-address, --bgp.neighbor, --exabgp, --rtbh and --static.rules, bird otherwise)").Envar("SOURCES").EnumsVar(&config.sources, "bird", "rtbh", "bmp", "bgp", "exabgp", "static")
+	app.Flag("source.merge-policy", "How routes with identical match attributes of several sources are merged").Envar("SOURCE_MERGE_POLICY").Default(string(source.PolicyAll)).EnumVar(&config.mergePolicy, source.Policies...)
+	app.Flag("static.rules", "Path to a YAML or JSON file with locally defined flowspec rules, reloaded on changes").Envar("STATIC_RULES").StringVar(&config.staticRulesPath)
+	app.Flag("rule.order", "Order of the rules: 'sources' keeps the order of the route sources, 'rfc' sorts all rules by flowspec precedence (RFC 8955 section 5.1)").Envar("RULE_ORDER").Default(string(source.OrderSources)).EnumVar(&config.ruleOrder, source.Orders...)
+	app.Flag("rule.compile", "Collapse drop routes of the same match shape into sets looked up by a single rule, e.g. for large rule sets").Envar("RULE_COMPILE").Default("false").BoolVar(&config.ruleCompile)
+	app.Flag("rule.update", "How rule changes are applied: 'incremental' deletes and inserts changed rules in the flowspec chain, 'swap' fills a new chain and retargets a jump from the flowspec chain to it").Envar("RULE_UPDATE").Default(ruleUpdateIncremental).EnumVar(&config.ruleUpdate, ruleUpdateIncremental, ruleUpdateSwap)
+	app.Flag("rule.copy-counters", "Copy the counters of unchanged rules to the new chain in swap mode").Envar("RULE_COPY_COUNTERS").Default("false").BoolVar(&config.ruleCopyCounters)
+	app.Flag("rule.session-chains", "Enforce the routes of every session in a chain of its own, jumped to from the flowspec chain").Envar("RULE_SESSION_CHAINS").Default("false").BoolVar(&config.ruleSessionChains)
+	app.Flag("rule.disabled-session", "Session whose chain is kept up to date but not jumped to, may be repeated").Envar("RULE_DISABLED_SESSIONS").StringsVar(&config.ruleDisabledSessions)
+	app.Flag("vrf", "Enforce the routes of a BIRD table or protocol only for the traffic of a VRF device, as table=device or protocol=device, may be repeated").Envar("VRFS").StringMapVar(&config.vrfs)
+	app.Flag("vrf.match", "Interfaces of which received packets are subject to the routes of a VRF: 'device' the VRF device, as in input and forward hooks, 'members' the interfaces enslaved to it").Envar("VRF_MATCH").Default(vrfMatchDevice).EnumVar(&config.vrfMatch, vrfMatchDevice, vrfMatchMembers)
+	app.Flag("interface-group", "Interfaces of a group of the interface-set extended community, as group=interface,interface, may be repeated").Envar("INTERFACE_GROUPS").StringMapVar(&config.interfaceGroupNames)
+	app.Flag("rtbh", "Additionally enforce remotely triggered blackhole (RTBH) routes of the BIRD CLI").Envar("RTBH").Default("false").BoolVar(&config.rtbh)
+	app.Flag("rtbh.community", "Community (ASN:value or large global:local1:local2) marking unicast routes of which traffic to the destination is dropped, may be repeated").Envar("RTBH_COMMUNITIES").Default("65535:666").StringsVar(&config.rtbhCommunities)
+	app.Flag("rtbh.source-community", "Community marking unicast routes of which traffic from the source is dropped (RFC 5635), may be repeated").Envar("RTBH_SOURCE_COMMUNITIES").StringsVar(&config.rtbhSourceCommunities)
+	app.Flag("rtbh.table", "BIRD table to query for RTBH routes, may be repeated (default: BIRD default tables)").Envar("RTBH_TABLES").StringsVar(&config.rtbhTables)
+	app.Flag("originate.listen-address", "Address to serve the API originating flowspec routes into BIRD on, disabled if empty").Envar("ORIGINATE_LISTEN_ADDRESS").StringVar(&config.originateListenAddress)
+	app.Flag("originate.file4", "Managed BIRD include file for originated flow4 routes").Envar("ORIGINATE_FILE4").Default("/etc/bird/flowspec-originated4.conf").StringVar(&config.originateFile4)
+	app.Flag("originate.file6", "Managed BIRD include file for originated flow6 routes").Envar("ORIGINATE_FILE6").Default("/etc/bird/flowspec-originated6.conf").StringVar(&config.originateFile6)
+	app.Flag("detector", "Detect destinations exceeding a packet or byte rate and mitigate their traffic automatically").Envar("DETECTOR").Default("false").BoolVar(&config.detectorEnabled)
+	app.Flag("detector.interval", "Interval to read the per destination traffic counters").Envar("DETECTOR_INTERVAL").Default("5s").DurationVar(&config.detector.Interval)
+	app.Flag("detector.packet-rate", "Packets per second to a destination triggering a mitigation (0 disables the threshold)").Envar("DETECTOR_PACKET_RATE").Default("0").Uint64Var(&config.detector.PacketRate)
+	app.Flag("detector.byte-rate", "Bytes per second to a destination triggering a mitigation (0 disables the threshold)").Envar("DETECTOR_BYTE_RATE").Default("0").Uint64Var(&config.detector.ByteRate)
+	app.Flag("detector.hold-down", "Time a mitigation stays active after the threshold was exceeded the last time").Envar("DETECTOR_HOLD_DOWN").Default("5m").DurationVar(&config.detector.HoldDown)
+	app.Flag("detector.action", "Action of mitigations (drop, rate-limit-bytes or rate-limit-packets)").Envar("DETECTOR_ACTION").Default("drop").StringVar(&config.detector.Action)
+	app.Flag("detector.rate", "Rate of rate limiting mitigations").Envar("DETECTOR_RATE").Default("0").Int64Var(&config.detector.Rate)
+	app.Flag("detector.max-destinations", "Maximum number of destinations counted per address family and table, traffic to further destinations is not counted").Envar("DETECTOR_MAX_DESTINATIONS").Default("65536").Uint32Var(&config.detectorMaxDestination)
+	app.Flag("detector.originate", "Originate mitigations into BIRD (see --originate.file4 and --originate.file6) instead of installing them locally").Envar("DETECTOR_ORIGINATE").Default("false").BoolVar(&config.detectorOriginate)
 	app.HelpFlag.Short('h')
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
+	if config.routeMaxAge > 0 && !route.TimeFormat(config.birdTimeFormat).HasTimeOfDay() {
+		app.Fatalf("--route.max-age requires a --bird.timeformat with time of day, date-only import times are off by up to a day")
+	}
+	if config.nftHook != "" && config.nftJumpFrom != "" {
+		app.Fatalf("--nftables.jump-from can not be combined with --nftables.hook, base chains can not be jumped to")
+	}
+	if config.nftJumpFrom == config.nftChain {
+		app.Fatalf("--nftables.jump-from must differ from --nftables.chain")
+	}
+	if config.nftPlacement != "filter" && (config.nftHook != "" || config.nftJumpFrom != "") {
+		app.Fatalf("--nftables.hook and --nftables.jump-from can only be used in filter placement")
+	}
+	if (config.nftPlacement == "netdev") != (len(config.nftDevices) > 0) {
+		app.Fatalf("--nftables.device is required in and only allowed in netdev placement")
+	}
+	if config.ruleSessionChains && config.ruleUpdate == ruleUpdateSwap {
+		app.Fatalf("--rule.session-chains can not be combined with --rule.update=swap")
+	}
+	if len(config.ruleDisabledSessions) > 0 && !config.ruleSessionChains {
+		app.Fatalf("--rule.disabled-session requires --rule.session-chains")
+	}
+	if len(config.vrfs) > 0 && config.ruleUpdate == ruleUpdateSwap {
+		app.Fatalf("--vrf can not be combined with --rule.update=swap")
+	}
+	if len(config.vrfs) > 0 && config.nftPlacement == "netdev" && config.vrfMatch != vrfMatchMembers {
+		app.Fatalf("--vrf in netdev placement requires --vrf.match=members, ingress chains never see VRF devices")
+	}
+	interfaceGroups, err := parseInterfaceGroups(config.interfaceGroupNames)
+	if err != nil {
+		app.Fatalf("invalid --interface-group: %v", err)
+	}
+	config.interfaceGroups = interfaceGroups
+	if config.nftSplitFamilies && (config.nftPlacement == "netdev" || config.nftFamily != "inet") {
+		app.Fatalf("--nftables.split-families can not be combined with netdev placement or --nftables.family")
+	}
+	if config.nftPlacement == "raw" && config.nftFamily == "bridge" {
+		app.Fatalf("raw placement can not be combined with bridge tables")
+	}
+	if config.nftPlacement == "netdev" && config.nftFamily != "inet" {
+		app.Fatalf("--nftables.family can not be combined with netdev placement, the table is of the netdev family")
+	}
+	if err := config.birdQuery.Validate(); err != nil {
+		app.Fatalf("invalid BIRD query: %v", err)
+	}
+	if config.mrtReplayPath != "" {
+		if len(config.sources) > 0 || config.bmpListenAddress != "" || config.bgpNeighbor != "" || config.exabgp || config.rtbh || config.staticRulesPath != "" || config.detectorEnabled {
+			app.Fatalf("--mrt.replay can not be combined with route sources")
+		}
+		if config.mrtSpeed < 0 {
+			app.Fatalf("--mrt.speed must not be negative")
+		}
+	}
+	if len(config.sources) == 0 && config.mrtReplayPath == "" {
+		config.sources = defaultSources()
+	}
+	enabled := make(map[string]bool)
+	for _, name := range config.sources {
+		if enabled[name] {
+			app.Fatalf("route source %s is configured more than once", name)
+		}
+		enabled[name] = true
+	}
+	if enabled["rtbh"] {
+		for _, communities := range []struct {
+			values []string
+			target *[]bird.Community
+		}{
+			{config.rtbhCommunities, &config.blackhole.DestinationCommunities},
+			{config.rtbhSourceCommunities, &config.blackhole.SourceCommunities},
+		} {
+			for _, value := range communities.values {
+				community, err := bird.ParseCommunity(value)
+				if err != nil {
+					app.Fatalf("invalid RTBH community: %v", err)
+				}
+				*communities.target = append(*communities.target, community)
+			}
+		}
+		config.blackhole.Tables = config.rtbhTables
+		if err := config.blackhole.Query().Validate(); err != nil {
+			app.Fatalf("invalid RTBH query: %v", err)
+		}
+	}
+	if enabled["bird"] || enabled["rtbh"] {
+		if _, err := os.Stat(config.birdSocketPath); err != nil {
+			app.Fatalf("BIRD socket: %v", err)
+		}
+	}
+	if enabled["bmp"] && config.bmpListenAddress == "" {
+		app.Fatalf("--bmp.listen-address is required for the bmp route source")
+	}
+	if enabled["bgp"] {
+		if config.bgpNeighbor == "" {
+			app.Fatalf("--bgp.neighbor is required for the bgp route source")
+		}
+		if _, _, err := net.SplitHostPort(config.bgpNeighbor); err != nil {
+			config.bgpNeighbor = net.JoinHostPort(config.bgpNeighbor, "179")
+		}
+		if config.bgpLocalAS == 0 || config.bgpRouterID.To4() == nil {
+			app.Fatalf("--bgp.local-as and an IPv4 --bgp.router-id are required for the BGP speaker")
+		}
+	}
+	if enabled["static"] && config.staticRulesPath == "" {
+		app.Fatalf("--static.rules is required for the static route source")
+	}
+	if config.detectorEnabled {
+		if err := config.detector.Validate(); err != nil {
+			app.Fatalf("invalid detector configuration: %v", err)
+		}
+		if config.detector.Interval <= 0 {
+			app.Fatalf("--detector.interval has to be positive")
+		}
+		if config.detectorMaxDestination == 0 {
+			app.Fatalf("--detector.max-destinations has to be positive")
+		}
+		if config.detectorOriginate {
+			if _, err := os.Stat(config.birdSocketPath); err != nil {
+				app.Fatalf("BIRD socket: %v", err)
+			}
+		}
+	}
+
 	logLevel := slog.LevelInfo
 	if config.debug {
 		logLevel = slog.LevelDebug
@@ -114,6 +296,7 @@ func init() {
 }
 
 func main() {
+	parseConfiguration()
 	slog.Info("Starting bird-flowspec-daemon", slog.String("configuration", fmt.Sprintf("%+v", config)))
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -125,11 +308,21 @@ func main() {
 		cancel()
 	}()
 
+	if config.mrtReplayPath != "" {
+		if err := replayMRT(ctx); err != nil {
+			slog.Error("MRT replay error", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
+	diag := &diagnostics{}
 	metricsServer := &http.Server{Addr: config.metricsListenAddress}
 	go func() {
 		prometheus.DefaultRegisterer.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 		http.Handle("/metrics", promhttp.Handler())
 		http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+		http.Handle("/diagnostics/rejected", diag)
 		slog.Info("serving metrics", slog.String("address", metricsServer.Addr))
 		slog.Error("failed to server metrics endpoint", slog.String("error", metricsServer.ListenAndServe().Error()))
 	}()
@@ -139,40 +332,45 @@ func main() {
 		metricsServer.Shutdown(context.Background())
 	}()
 
-	nft, nftablesConnectError := nftables.New()
-	if nftablesConnectError != nil {
-		slog.Error("nftables connection error", slog.String("error", nftablesConnectError.Error()))
-		panic(nftablesConnectError)
+	var originator *originate.Originator
+	if config.originateListenAddress != "" || (config.detectorEnabled && config.detectorOriginate) {
+		var err error
+		originator, err = newOriginator(ctx)
+		if err != nil {
+			slog.Error("error creating originator", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
 	}
-
-	table := nft.CreateTable(&nftables.Table{
-		Family: nftables.TableFamilyINet,
-		Name:   "filter",
-	})
-	if err := nft.Flush(); err != nil {
-		slog.Debug("nftables flush error: %v", slog.String("error", err.Error()))
+	if config.originateListenAddress != "" {
+		go func() {
+			if err := serveOriginateAPI(ctx, originator); err != nil {
+				slog.Error("origination API error", slog.String("error", err.Error()))
+				cancel()
+			}
+		}()
 	}
 
-	chain := nft.AddChain(&nftables.Chain{
-		Name:  "flowspec",
-		Table: table,
-	})
-	if err := nft.Flush(); err != nil {
-		panic(err)
-	}
+	nft, chains := setupNftables(ctx)
 
-	var lastChecksum [16]byte
+	enabledSources := routeSources()
+	if config.detectorEnabled {
+		var mitigations *originate.Originator
+		if config.detectorOriginate {
+			mitigations = originator
+		}
+		enabledSources = append(enabledSources, newDetector(nft, setupAccounting(nft, chains), mitigations))
+	}
 
 	routeIntervalTicker := time.NewTicker(config.interval)
 	defer routeIntervalTicker.Stop()
 
-	if config.enableCounter {
-		if installCounterError := metrics.InstallNamedCounters(table); installCounterError != nil {
-			slog.Error("error installing named counters", slog.String("error", installCounterError.Error()))
-			panic(installCounterError)
+	sources := source.NewGroup(source.Policy(config.mergePolicy), source.Order(config.ruleOrder), enabledSources...)
+	go func() {
+		if err := sources.Run(ctx); err != nil {
+			slog.Error("route source error", slog.String("error", err.Error()))
+			cancel()
 		}
-		go metrics.CounterMetricsWorker(ctx, table)
-	}
+	}()
 
 	for {
 		select {
@@ -180,92 +378,519 @@ func main() {
 			slog.Info("Shutting down")
 			return
 		case <-routeIntervalTicker.C:
-			timeoutCtx, cancel := context.WithTimeout(ctx, config.interval)
-			response, commandError := birdCommand(timeoutCtx, "show route where ((net.type = NET_FLOW4 || net.type = NET_FLOW6) && source = RTS_BGP) all")
-			if commandError != nil {
-				slog.Error("error running bird command", slog.String("error", commandError.Error()))
-				continue
-			}
+		case <-sources.Updates():
+		}
 
-			rawRoutes := strings.Split(response, "flow")
-			cancel()
+		for _, routeSource := range sources.Sources() {
+			if birdSource, ok := routeSource.(*source.BirdCLI); ok && config.birdQueryFiltered {
+				diag.setBirdFiltered(birdSource.Filtered())
+			}
+		}
 
-			var nftRules []*nftables.Rule
-
-			if config.enableCounter {
-				nftRules = append(nftRules, &nftables.Rule{
-					Table: table,
-					Chain: chain,
-					Exprs: []expr.Any{
-						&expr.Objref{
-							Type: int(nftables.ObjTypeCounter),
-							Name: metrics.CounterFlowSpecHandled,
-						},
-					},
-				})
+		ruleSets, buildRejected := buildRules(chains, sources.Routes(), time.Now())
+		rejected := append(sources.Rejected(), buildRejected...)
+		// The chains are updated independently, a failed update is retried with the next routes
+		for _, rules := range ruleSets {
+			if err := applyRules(rules); err != nil {
+				slog.Error("error updating nftables", slog.String("error", err.Error()))
+				rejected = append(rejected, setRejections(err)...)
 			}
+		}
+		diag.setDaemonRejected(rejected)
+	}
+}
 
-			for _, flowRoute := range rawRoutes {
-				// Ignore lines that aren't a valid IPv4/IPv6 flowspec route
-				if !(strings.HasPrefix(flowRoute, "4") || strings.HasPrefix(flowRoute, "6")) {
-					continue
-				}
+// setElementsPerMessage limits the size of the netlink messages adding set elements
+const setElementsPerMessage = 1000
 
-				flowSpecRoute, parseError := route.ParseFlowSpecRoute(flowRoute)
-				if parseError != nil {
-					slog.Warn("error parsing flowspec route", slog.String("error", parseError.Error()))
-					continue
-				}
+// addSet adds a match set to the current transaction, large sets are added in several messages
+func addSet(nft *nftables.Conn, set *rulebuilder.MatchSet) error {
+	elements := set.Elements
+	first := elements[:min(len(elements), setElementsPerMessage)]
+	if err := nft.AddSet(set.Set, first); err != nil {
+		return err
+	}
+	for elements = elements[len(first):]; len(elements) > 0; elements = elements[min(len(elements), setElementsPerMessage):] {
+		if err := nft.SetAddElements(set.Set, elements[:min(len(elements), setElementsPerMessage)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-				ruleExpressions, buildError := rulebuilder.BuildRuleExpressions(flowSpecRoute, config.enableCounter)
-				if buildError != nil {
-					slog.Warn("error building rule expressions", slog.String("error", buildError.Error()))
-					continue
-				}
+// defaultSources returns the route sources implied by the source specific flags, static rules go first
+func defaultSources() []string {
+	var sources []string
+	if config.bmpListenAddress != "" {
+		sources = append(sources, "bmp")
+	}
+	if config.bgpNeighbor != "" {
+		sources = append(sources, "bgp")
+	}
+	if config.exabgp {
+		sources = append(sources, "exabgp")
+	}
+	if len(sources) == 0 {
+		sources = append(sources, "bird")
+	}
+	if config.rtbh {
+		sources = append(sources, "rtbh")
+	}
+	if config.staticRulesPath != "" {
+		sources = append([]string{"static"}, sources...)
+	}
+	return sources
+}
 
-				rule := &nftables.Rule{
-					Table: table,
-					Chain: chain,
-					Exprs: ruleExpressions,
-				}
+// routeSources creates the configured route sources in their configured order
+func routeSources() []source.RouteSource {
+	var sources []source.RouteSource
+	for _, name := range config.sources {
+		switch name {
+		case "bird":
+			sources = append(sources, source.NewBirdCLI(name, source.BirdConfig{
+				Client:        bird.Client{SocketPath: config.birdSocketPath},
+				Query:         config.birdQuery,
+				Interval:      config.interval,
+				QueryFiltered: config.birdQueryFiltered,
+				TimeFormat:    route.TimeFormat(config.birdTimeFormat),
+			}))
+		case "rtbh":
+			blackholeConfig := config.blackhole
+			blackholeConfig.Client = bird.Client{SocketPath: config.birdSocketPath}
+			blackholeConfig.Interval = config.interval
+			blackholeConfig.TimeFormat = route.TimeFormat(config.birdTimeFormat)
+			sources = append(sources, source.NewBlackhole(name, blackholeConfig))
+		case "bmp":
+			bmpServer := bmp.NewServer(config.bmpPostPolicy)
+			sources = append(sources, source.NewFeed(name, bmpServer, func(ctx context.Context) error {
+				return bmpServer.ListenAndServe(ctx, config.bmpListenAddress)
+			}))
+		case "bgp":
+			session := bgp.NewSession(bgp.SessionConfig{
+				LocalAS:     config.bgpLocalAS,
+				RouterID:    config.bgpRouterID,
+				HoldTime:    config.bgpHoldTime,
+				RestartTime: config.bgpRestartTime,
+			})
+			sources = append(sources, source.NewFeed(name, session, func(ctx context.Context) error {
+				session.Run(ctx, config.bgpNeighbor, config.interval)
+				return nil
+			}))
+		case "exabgp":
+			process := exabgp.NewProcess()
+			sources = append(sources, source.NewFeed(name, process, func(ctx context.Context) error {
+				return process.Run(ctx, os.Stdin)
+			}))
+		case "static":
+			sources = append(sources, source.NewStatic(name, config.staticRulesPath, config.interval))
+		}
+	}
+	return sources
+}
 
-				//slog.Debug("Added rule", slog.String("rule", fmt.Sprintf("%#v", flowSpecRoute)))
-				nftRules = append(nftRules, rule)
-			}
+// setupNftables creates the flowspec tables and chains, the jumps to the chains if configured and installs the
+// named counters if enabled
+func setupNftables(ctx context.Context) (*nftables.Conn, []*nftables.Chain) {
+	nft, nftablesConnectError := nftables.New()
+	if nftablesConnectError != nil {
+		slog.Error("nftables connection error", slog.String("error", nftablesConnectError.Error()))
+		panic(nftablesConnectError)
+	}
+
+	var chains []*nftables.Chain
+	for _, table := range flowspecTables() {
+		table = nft.CreateTable(table)
+		if err := nft.Flush(); err != nil {
+			slog.Debug("nftables flush error: %v", slog.String("error", err.Error()))
+		}
 
-			// get the current number of rules in the nftables chain
-			existingRules, getRulesError := nft.GetRules(table, chain)
-			if getRulesError != nil {
-				slog.Error("error getting existing rules", slog.String("error", getRulesError.Error()))
+		chain := nft.AddChain(flowspecChain(table))
+		if err := nft.Flush(); err != nil {
+			panic(err)
+		}
+		if config.nftJumpFrom != "" {
+			from := &nftables.Chain{Name: config.nftJumpFrom, Table: table}
+			if err := ensureJump(nft, from, chain, config.nftJumpPosition); err != nil {
+				slog.Error("error adding jump to flowspec chain", slog.String("family", familyName(table)), slog.String("error", err.Error()))
+				panic(err)
 			}
-			if len(existingRules) != len(nftRules) {
-				slog.Info("number of rules in nftables chain does not match, reapplying all rules")
-				lastChecksum = [16]byte{}
+		}
+		for _, ingress := range ingressChains(table) {
+			nft.AddChain(ingress)
+			if err := nft.Flush(); err != nil {
+				slog.Error("error adding ingress chain", slog.String("device", ingress.Device), slog.String("error", err.Error()))
+				panic(err)
 			}
-
-			checksum := rulesum.CheckSum(nftRules)
-			if checksum == lastChecksum {
-				slog.Debug("Checksums match, skipping nftables update", slog.String("checksum", fmt.Sprintf("%x", checksum)))
-				continue
+			if err := ensureJump(nft, ingress, chain, jumpPositionFirst); err != nil {
+				slog.Error("error adding jump to flowspec chain", slog.String("error", err.Error()))
+				panic(err)
 			}
-			lastChecksum = checksum
+		}
 
-			slog.Info("updating nftables", slog.String("checksum", fmt.Sprintf("%x", checksum)))
-			if config.enableCounter {
-				metrics.FlowSpecRoutesTotal.Set(float64(len(nftRules) - 1))
-			} else {
-				metrics.FlowSpecRoutesTotal.Set(float64(len(nftRules)))
-			}
-			nft.FlushChain(chain)
-			for _, rule := range nftRules {
-				nft.AddRule(rule)
+		if config.enableCounter {
+			if installCounterError := metrics.InstallNamedCounters(table); installCounterError != nil {
+				slog.Error("error installing named counters", slog.String("family", familyName(table)), slog.String("error", installCounterError.Error()))
+				panic(installCounterError)
 			}
-			start := time.Now()
-			if err := nft.Flush(); err != nil {
-				panic(err)
+			go metrics.CounterMetricsWorker(ctx, table)
+		}
+		chains = append(chains, chain)
+	}
+
+	return nft, chains
+}
+
+// ruleSet is the rules of a flowspec chain and the match sets looked up by them
+type ruleSet struct {
+	chain *nftables.Chain
+	rules []*nftables.Rule
+	sets  []*rulebuilder.MatchSet
+	// subChains are the rules of the session and VRF chains jumped to by the rules
+	subChains []subChainRules
+}
+
+// buildRules translates routes into the rules of the flowspec chains and the sets looked up by them. Routes are
+// enforced in the first chain of a table seeing their address family. Route ages are calculated relative to now.
+func buildRules(chains []*nftables.Chain, flowSpecRoutes []route.FlowspecRoute, now time.Time) ([]ruleSet, []source.Rejection) {
+	var rejected []source.Rejection
+	enforced := make(map[*nftables.Chain][]route.FlowspecRoute)
+	expressions := make(map[*nftables.Chain][][]expr.Any)
+	var enforcedTotal int
+
+	maxAge := make(map[string]time.Duration)
+	for _, flowSpecRoute := range flowSpecRoutes {
+		age := flowSpecRoute.Age(now)
+		if age > maxAge[flowSpecRoute.SessionAttrs.SessionName] {
+			maxAge[flowSpecRoute.SessionAttrs.SessionName] = age
+		}
+		if config.routeMaxAge > 0 && age > config.routeMaxAge {
+			slog.Debug("ignoring expired flowspec route", slog.String("session", flowSpecRoute.SessionAttrs.SessionName), slog.String("age", age.String()))
+			rejected = append(rejected, source.Rejection{Summary: flowSpecRoute.Summary(), Reason: fmt.Sprintf("route expired (age %s)", age.Truncate(time.Second))})
+			continue
+		}
+
+		chain := routeChain(chains, flowSpecRoute)
+		if chain == nil {
+			rejected = append(rejected, source.Rejection{Summary: flowSpecRoute.Summary(), Reason: fmt.Sprintf("address family not enforced by the %s table %s", config.nftFamily, config.nftTable)})
+			continue
+		}
+
+		if err := resolveInterfaces(&flowSpecRoute); err != nil {
+			rejected = append(rejected, source.Rejection{Summary: flowSpecRoute.Summary(), Reason: err.Error()})
+			continue
+		}
+
+		ruleExpressions, buildError := rulebuilder.BuildRuleExpressions(flowSpecRoute, rulePlacement(), config.enableCounter)
+		if buildError != nil {
+			slog.Warn("error building rule expressions", slog.String("error", buildError.Error()))
+			rejected = append(rejected, source.Rejection{Summary: flowSpecRoute.Summary(), Reason: buildError.Error()})
+			continue
+		}
+
+		slog.Debug("Added rule",
+			slog.String("session", flowSpecRoute.SessionAttrs.SessionName),
+			slog.Any("origin_as", flowSpecRoute.OriginAS()),
+			slog.String("as_path", flowSpecRoute.BGPAttrs.ASPath.String()),
+		)
+		enforced[chain] = append(enforced[chain], flowSpecRoute)
+		expressions[chain] = append(expressions[chain], ruleExpressions)
+		enforcedTotal++
+	}
+
+	var ruleSets []ruleSet
+	metrics.FlowSpecSessionRules.Reset()
+	for _, chain := range chains {
+		chainRules, chainRejected := buildChainRules(chain, enforced[chain], expressions[chain])
+		ruleSets = append(ruleSets, chainRules)
+		rejected = append(rejected, chainRejected...)
+	}
+	metrics.FlowSpecRoutesTotal.Set(float64(enforcedTotal))
+
+	metrics.FlowSpecRouteMaxAgeSeconds.Reset()
+	for protocol, age := range maxAge {
+		metrics.FlowSpecRouteMaxAgeSeconds.With(prometheus.Labels{"protocol": protocol}).Set(age.Seconds())
+	}
+
+	return ruleSets, rejected
+}
+
+// buildChainRules translates the enforced routes of a flowspec chain and their rule expressions into the rules
+// of the chain and the sets looked up by them. Routes that can not be compiled are rejected.
+func buildChainRules(chain *nftables.Chain, flowSpecRoutes []route.FlowspecRoute, expressions [][]expr.Any) (ruleSet, []source.Rejection) {
+	rules := ruleSet{chain: chain}
+	var rejected []source.Rejection
+	table := chain.Table
+
+	if config.enableCounter {
+		rules.rules = append(rules.rules, &nftables.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: []expr.Any{
+				&expr.Objref{
+					Type: int(nftables.ObjTypeCounter),
+					Name: metrics.CounterFlowSpecHandled,
+				},
+			},
+		})
+	}
+	// Traffic is accounted before any route is enforced, so mitigations are held down as long as the traffic persists
+	if config.detectorEnabled {
+		rules.rules = append(rules.rules, accountingRules(table, chain)...)
+	}
+
+	// Routes of VRFs are only enforced for the traffic of their VRF, before the routes enforced for all traffic
+	vrfs, vrfGroups := groupRoutes(flowSpecRoutes, expressions, routeVRF)
+	global := &routeGroup{}
+	for _, device := range vrfs {
+		if device == "" {
+			global = vrfGroups[device]
+			continue
+		}
+		vrf := subChain(chain, vrfChainInfix, device)
+		routeRules, sets, routeRejected := buildRouteRules(vrf, vrfGroups[device].routes, vrfGroups[device].expressions)
+		rejected = append(rejected, routeRejected...)
+		rules.subChains = append(rules.subChains, subChainRules{chain: vrf, rules: routeRules})
+		rules.sets = append(rules.sets, sets...)
+		rules.rules = append(rules.rules, vrfJumps(chain, vrf, device)...)
+	}
+
+	if !config.ruleSessionChains {
+		routeRules, sets, routeRejected := buildRouteRules(chain, global.routes, global.expressions)
+		rules.rules = append(rules.rules, routeRules...)
+		rules.sets = append(rules.sets, sets...)
+		return rules, append(rejected, routeRejected...)
+	}
+
+	// Sessions are jumped to in the order of their first route
+	sessions, sessionGroups := groupRoutes(global.routes, global.expressions, func(flowSpecRoute route.FlowspecRoute) string {
+		return flowSpecRoute.SessionAttrs.SessionName
+	})
+	for _, session := range sessions {
+		sessionRules := subChainRules{chain: subChain(chain, sessionChainInfix, session), updates: metrics.FlowSpecSessionChainUpdatesTotal.WithLabelValues(session)}
+		routeRules, sets, routeRejected := buildRouteRules(sessionRules.chain, sessionGroups[session].routes, sessionGroups[session].expressions)
+		rejected = append(rejected, routeRejected...)
+		sessionRules.rules = routeRules
+		rules.subChains = append(rules.subChains, sessionRules)
+		rules.sets = append(rules.sets, sets...)
+		metrics.FlowSpecSessionRules.WithLabelValues(session).Add(float64(len(routeRules)))
+
+		if slices.Contains(config.ruleDisabledSessions, session) {
+			continue
+		}
+		rules.rules = append(rules.rules, jumpRule(chain, sessionRules.chain))
+	}
+	return rules, rejected
+}
+
+// routeGroup is the routes of a session or VRF and their rule expressions
+type routeGroup struct {
+	routes      []route.FlowspecRoute
+	expressions [][]expr.Any
+}
+
+// groupRoutes groups routes and their rule expressions by key and returns the keys in the order of the first
+// route of their group
+func groupRoutes(flowSpecRoutes []route.FlowspecRoute, expressions [][]expr.Any, key func(route.FlowspecRoute) string) ([]string, map[string]*routeGroup) {
+	var keys []string
+	groups := make(map[string]*routeGroup)
+	for i, flowSpecRoute := range flowSpecRoutes {
+		k := key(flowSpecRoute)
+		group, ok := groups[k]
+		if !ok {
+			group = &routeGroup{}
+			groups[k] = group
+			keys = append(keys, k)
+		}
+		group.routes = append(group.routes, flowSpecRoute)
+		group.expressions = append(group.expressions, expressions[i])
+	}
+	return keys, groups
+}
+
+// buildRouteRules translates routes and their rule expressions into the rules of a chain enforcing them and the
+// sets looked up by the rules. Routes that can not be compiled are rejected.
+func buildRouteRules(chain *nftables.Chain, flowSpecRoutes []route.FlowspecRoute, expressions [][]expr.Any) ([]*nftables.Rule, []*rulebuilder.MatchSet, []source.Rejection) {
+	var rules []*nftables.Rule
+	if !config.ruleCompile {
+		for i, ruleExpressions := range expressions {
+			rule := &nftables.Rule{
+				Table: chain.Table,
+				Chain: chain,
+				Exprs: ruleExpressions,
 			}
-			slog.Info("nftables updated", slog.String("duration", time.Since(start).String()))
-			metrics.NftablesFlushDurationSeconds.Observe(time.Since(start).Seconds())
+			rulesum.Tag(rule, rulesum.Identity(flowSpecRoutes[i]))
+			rules = append(rules, rule)
+		}
+		return rules, interfaceSets(chain.Table, flowSpecRoutes, nil), nil
+	}
+
+	compiled, routeErrors := rulebuilder.Compile(chain.Table, flowSpecRoutes, rulePlacement(), config.enableCounter)
+	var rejected []source.Rejection
+	for _, routeError := range routeErrors {
+		slog.Warn("error compiling rule", slog.String("error", routeError.Error()))
+		rejected = append(rejected, source.Rejection{Summary: routeError.Route.Summary(), Reason: routeError.Error()})
+	}
+	var compiledRoutes []route.FlowspecRoute
+	var sets []*rulebuilder.MatchSet
+	for _, compiledRule := range compiled {
+		rule := &nftables.Rule{
+			Table: chain.Table,
+			Chain: chain,
+			Exprs: compiledRule.Exprs,
 		}
+		rulesum.Tag(rule, rulesum.Identity(compiledRule.Routes...))
+		rules = append(rules, rule)
+		compiledRoutes = append(compiledRoutes, compiledRule.Routes...)
+		if compiledRule.Set != nil {
+			sets = append(sets, compiledRule.Set)
+		}
+	}
+	return rules, interfaceSets(chain.Table, compiledRoutes, sets), rejected
+}
+
+// applyRules updates the rules of a flowspec chain and the match sets of its table in a single transaction. Each
+// update uses a connection of its own, so the messages of an update aborted by a set that can not be added are
+// discarded with it and the installed rules and sets are kept.
+func applyRules(rules ruleSet) error {
+	nft, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	chain := rules.chain
+	addedSets, unusedSets, err := updateSets(nft, chain.Table, rules.sets)
+	if err != nil {
+		return fmt.Errorf("%s table %s: %w", familyName(chain.Table), chain.Table.Name, err)
+	}
+
+	subChainsChanged, unusedChains := updateSubChains(nft, chain, rules.subChains)
+
+	var changed bool
+	if config.ruleUpdate == ruleUpdateSwap {
+		changed = swapRules(nft, chain, rules.rules)
+	} else {
+		changed = updateRules(nft, chain, rules.rules)
+	}
+	// Sub-chains are deleted after the jumps to them
+	for _, unusedChain := range unusedChains {
+		slog.Info("deleting chain", slog.String("chain", unusedChain.Name))
+		nft.FlushChain(unusedChain)
+		nft.DelChain(unusedChain)
+	}
+	if !changed && !subChainsChanged && len(unusedChains) == 0 && addedSets == 0 && len(unusedSets) == 0 {
+		slog.Debug("rules unchanged, skipping nftables update", slog.String("family", familyName(chain.Table)))
+		return nil
+	}
+
+	// Sets are deleted after the rules looking them up
+	for _, set := range unusedSets {
+		nft.DelSet(set)
+	}
+	start := time.Now()
+	if err := nft.Flush(); err != nil {
+		return fmt.Errorf("%s table %s: %v", familyName(chain.Table), chain.Table.Name, err)
+	}
+	slog.Info("nftables updated", slog.String("family", familyName(chain.Table)), slog.Int("added_sets", addedSets), slog.Int("deleted_sets", len(unusedSets)), slog.String("duration", time.Since(start).String()))
+	metrics.NftablesFlushDurationSeconds.Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// setError is a match set that could not be added to a transaction, the routes enforced by it are rejected
+type setError struct {
+	set *rulebuilder.MatchSet
+	err error
+}
+
+func (e *setError) Error() string {
+	return fmt.Sprintf("set %s: %v", e.set.Set.Name, e.err)
+}
+
+// setRejections returns the rejections of the routes of the set that failed an update
+func setRejections(err error) []source.Rejection {
+	var failed *setError
+	if !errors.As(err, &failed) {
+		return nil
+	}
+	var rejected []source.Rejection
+	for _, flowSpecRoute := range failed.set.Routes {
+		rejected = append(rejected, source.Rejection{Summary: flowSpecRoute.Summary(), Reason: failed.Error()})
+	}
+	return rejected
+}
+
+// updateSets adds the match sets that do not exist yet to the current transaction and returns the number of
+// added sets and the match sets no longer in use. Match sets are named after their content, so existing sets
+// are up to date.
+func updateSets(nft *nftables.Conn, table *nftables.Table, sets []*rulebuilder.MatchSet) (int, []*nftables.Set, error) {
+	existingSets, getSetsError := nft.GetSets(table)
+	if getSetsError != nil {
+		slog.Error("error getting existing sets", slog.String("error", getSetsError.Error()))
+	}
+
+	desired := make(map[string]bool)
+	for _, set := range sets {
+		desired[set.Set.Name] = true
+	}
+	present := make(map[string]bool)
+	var unusedSets []*nftables.Set
+	for _, set := range existingSets {
+		if !strings.HasPrefix(set.Name, rulebuilder.MatchSetPrefix) {
+			continue
+		}
+		present[set.Name] = true
+		if !desired[set.Name] {
+			unusedSets = append(unusedSets, set)
+		}
+	}
+	addedSets := 0
+	for _, set := range sets {
+		if present[set.Set.Name] {
+			continue
+		}
+		if err := addSet(nft, set); err != nil {
+			return 0, nil, &setError{set: set, err: err}
+		}
+		// Sub-chains of the table may look up the same set
+		present[set.Set.Name] = true
+		addedSets++
+	}
+	return addedSets, unusedSets, nil
+}
+
+// updateRules adds the changes of the rules of chain to the current transaction and reports whether there are
+// any. Only changed rules are deleted, inserted or replaced, so unchanged rules keep their counters and limit
+// state. Rules replaced because the action of their route changed keep their counters.
+func updateRules(nft *nftables.Conn, chain *nftables.Chain, nftRules []*nftables.Rule) bool {
+	existingRules, getRulesError := nft.GetRules(chain.Table, chain)
+	if getRulesError != nil {
+		slog.Error("error getting existing rules, reapplying all rules", slog.String("error", getRulesError.Error()))
+		nft.FlushChain(chain)
+		existingRules = nil
+	}
+
+	update := rulesum.Diff(existingRules, nftRules)
+	if update.Empty() {
+		return false
+	}
+
+	slog.Info("updating nftables", slog.Int("deleted", len(update.Delete)), slog.Int("inserted", len(update.Insert)), slog.Int("replaced", len(update.Replace)))
+	for _, rule := range update.Delete {
+		if err := nft.DelRule(rule); err != nil {
+			slog.Error("error deleting rule", slog.Uint64("handle", rule.Handle), slog.String("error", err.Error()))
+		}
+	}
+	for _, insertion := range update.Insert {
+		if insertion.Before == 0 {
+			nft.AddRule(insertion.Rule)
+			continue
+		}
+		insertion.Rule.Position = insertion.Before
+		nft.InsertRule(insertion.Rule)
+	}
+	for _, replacement := range update.Replace {
+		rulesum.CopyCounters([]*nftables.Rule{replacement.Existing}, []*nftables.Rule{replacement.Rule})
+		replacement.Rule.Handle = replacement.Existing.Handle
+		nft.ReplaceRule(replacement.Rule)
 	}
+	return true
 }
@@ -0,0 +1,191 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/rulebuilder"
+)
+
+// tableFamilies are the supported families of the flowspec table
+var tableFamilies = map[string]nftables.TableFamily{
+	"inet":   nftables.TableFamilyINet,
+	"ip":     nftables.TableFamilyIPv4,
+	"ip6":    nftables.TableFamilyIPv6,
+	"bridge": nftables.TableFamilyBridge,
+}
+
+// chainHooks are the hooks the flowspec chain can be attached to as base chain
+var chainHooks = map[string]*nftables.ChainHook{
+	"prerouting": nftables.ChainHookPrerouting,
+	"input":      nftables.ChainHookInput,
+	"forward":    nftables.ChainHookForward,
+	"output":     nftables.ChainHookOutput,
+}
+
+// placements are the kinds of chains the flowspec rules can be placed in
+var placements = map[string]rulebuilder.Placement{
+	"filter": rulebuilder.PlacementFilter,
+	"raw":    rulebuilder.PlacementRaw,
+	"netdev": rulebuilder.PlacementNetdev,
+}
+
+// rulePlacement returns the kind of chain the flowspec rules are placed in
+func rulePlacement() rulebuilder.Placement {
+	if config.nftFamily == "bridge" {
+		return rulebuilder.PlacementBridge
+	}
+	return placements[config.nftPlacement]
+}
+
+// Positions of the jump to the flowspec chain
+const (
+	jumpPositionFirst = "first"
+	jumpPositionLast  = "last"
+)
+
+// flowspecTables returns the configured tables of the flowspec chain, an ip and an ip6 table if the address
+// families are split
+func flowspecTables() []*nftables.Table {
+	switch {
+	case rulePlacement() == rulebuilder.PlacementNetdev:
+		return []*nftables.Table{{Family: nftables.TableFamilyNetdev, Name: config.nftTable}}
+	case config.nftSplitFamilies:
+		return []*nftables.Table{
+			{Family: nftables.TableFamilyIPv4, Name: config.nftTable},
+			{Family: nftables.TableFamilyIPv6, Name: config.nftTable},
+		}
+	default:
+		return []*nftables.Table{{Family: tableFamilies[config.nftFamily], Name: config.nftTable}}
+	}
+}
+
+// flowspecChains returns the flowspec chains of the configured tables
+func flowspecChains() []*nftables.Chain {
+	var chains []*nftables.Chain
+	for _, table := range flowspecTables() {
+		chains = append(chains, flowspecChain(table))
+	}
+	return chains
+}
+
+// flowspecChain returns the configured flowspec chain, a base chain accepting all packets not dropped by the
+// rules if a hook is configured. In raw placement, it is a prerouting chain evaluated before connection tracking.
+func flowspecChain(table *nftables.Table) *nftables.Chain {
+	chain := &nftables.Chain{Name: config.nftChain, Table: table}
+	switch {
+	case rulePlacement() == rulebuilder.PlacementRaw:
+		setBaseChain(chain, nftables.ChainHookPrerouting, nftables.ChainPriorityRaw)
+	case config.nftHook != "":
+		setBaseChain(chain, chainHooks[config.nftHook], nftables.ChainPriorityRef(nftables.ChainPriority(config.nftPriority)))
+	}
+	return chain
+}
+
+// ingressChains returns the base chains of the configured interfaces in netdev placement, each jumping to the
+// flowspec chain
+func ingressChains(table *nftables.Table) []*nftables.Chain {
+	var chains []*nftables.Chain
+	for _, device := range config.nftDevices {
+		chain := &nftables.Chain{Name: config.nftChain + "_ingress_" + device, Table: table, Device: device}
+		setBaseChain(chain, nftables.ChainHookIngress, nftables.ChainPriorityRef(nftables.ChainPriority(config.nftPriority)))
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// setBaseChain makes chain a filter base chain of the hook, accepting all packets not dropped by its rules
+func setBaseChain(chain *nftables.Chain, hook *nftables.ChainHook, priority *nftables.ChainPriority) {
+	policy := nftables.ChainPolicyAccept
+	chain.Type = nftables.ChainTypeFilter
+	chain.Hooknum = hook
+	chain.Priority = priority
+	chain.Policy = &policy
+}
+
+// ensureJump adds a jump to chain into the chain from of the same table at the position, unless it already
+// jumps there
+func ensureJump(nft *nftables.Conn, from, chain *nftables.Chain, position string) error {
+	rules, err := nft.GetRules(chain.Table, from)
+	if err != nil {
+		return fmt.Errorf("chain %s: %v", from.Name, err)
+	}
+	for _, rule := range rules {
+		if jumpTarget(rule) == chain.Name {
+			return nil
+		}
+	}
+
+	jump := jumpRule(from, chain)
+	if position == jumpPositionFirst {
+		nft.InsertRule(jump)
+	} else {
+		nft.AddRule(jump)
+	}
+	if err := nft.Flush(); err != nil {
+		return err
+	}
+	slog.Info("added jump to flowspec chain", slog.String("chain", from.Name), slog.String("position", position))
+	return nil
+}
+
+// tableSeesFamily reports whether a table sees packets of an address family
+func tableSeesFamily(table *nftables.Table, ipv6 bool) bool {
+	switch table.Family {
+	case nftables.TableFamilyIPv4:
+		return !ipv6
+	case nftables.TableFamilyIPv6:
+		return ipv6
+	default:
+		return true
+	}
+}
+
+// routeChain returns the first of the chains the rules of a route can be added to, or nil
+func routeChain(chains []*nftables.Chain, flowSpecRoute route.FlowspecRoute) *nftables.Chain {
+	for _, chain := range chains {
+		if tableSeesFamily(chain.Table, flowSpecRoute.IsIPv6()) {
+			return chain
+		}
+	}
+	return nil
+}
+
+// jumpRule returns the rule of chain jumping to target
+func jumpRule(chain *nftables.Chain, target *nftables.Chain) *nftables.Rule {
+	return &nftables.Rule{
+		Table: chain.Table,
+		Chain: chain,
+		Exprs: []expr.Any{&expr.Verdict{Kind: expr.VerdictJump, Chain: target.Name}},
+	}
+}
+
+// jumpTarget returns the chain a rule consisting of a jump verdict jumps to, or "" for other rules
+func jumpTarget(rule *nftables.Rule) string {
+	if len(rule.Exprs) != 1 {
+		return ""
+	}
+	if verdict, ok := rule.Exprs[0].(*expr.Verdict); ok && verdict.Kind == expr.VerdictJump {
+		return verdict.Chain
+	}
+	return ""
+}
+
+// familyName returns the name of the family of a table, e.g. for logs
+func familyName(table *nftables.Table) string {
+	if table.Family == nftables.TableFamilyNetdev {
+		return "netdev"
+	}
+	for name, family := range tableFamilies {
+		if family == table.Family {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/stretchr/testify/assert"
+
+	"bird-flowspec-daemon/internal/route"
+)
+
+func TestFlowspecTables(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		config   configuration
+		expected []*nftables.Table
+	}{
+		{
+			name:     "inet table",
+			config:   configuration{nftTable: "filter", nftFamily: "inet", nftPlacement: "filter"},
+			expected: []*nftables.Table{{Family: nftables.TableFamilyINet, Name: "filter"}},
+		},
+		{
+			name:     "bridge table",
+			config:   configuration{nftTable: "filter", nftFamily: "bridge", nftPlacement: "filter"},
+			expected: []*nftables.Table{{Family: nftables.TableFamilyBridge, Name: "filter"}},
+		},
+		{
+			name:   "split families",
+			config: configuration{nftTable: "filter", nftFamily: "inet", nftPlacement: "filter", nftSplitFamilies: true},
+			expected: []*nftables.Table{
+				{Family: nftables.TableFamilyIPv4, Name: "filter"},
+				{Family: nftables.TableFamilyIPv6, Name: "filter"},
+			},
+		},
+		{
+			name:   "split families in raw placement",
+			config: configuration{nftTable: "filter", nftFamily: "inet", nftPlacement: "raw", nftSplitFamilies: true},
+			expected: []*nftables.Table{
+				{Family: nftables.TableFamilyIPv4, Name: "filter"},
+				{Family: nftables.TableFamilyIPv6, Name: "filter"},
+			},
+		},
+		{
+			name:     "netdev placement",
+			config:   configuration{nftTable: "flowspec", nftFamily: "inet", nftPlacement: "netdev"},
+			expected: []*nftables.Table{{Family: nftables.TableFamilyNetdev, Name: "flowspec"}},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config = testCase.config
+			assert.Equal(t, testCase.expected, flowspecTables())
+		})
+	}
+}
+
+func TestRouteChain(t *testing.T) {
+	ipv4Route := route.FlowspecRoute{}
+	ipv4Route.MatchAttrs.Destination = net.IPNet{IP: net.ParseIP("192.0.2.1").To4(), Mask: net.CIDRMask(32, 32)}
+	ipv6Route := route.FlowspecRoute{}
+	ipv6Route.MatchAttrs.Source = net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)}
+
+	config = configuration{nftTable: "filter", nftChain: "flowspec", nftFamily: "inet", nftPlacement: "filter", nftSplitFamilies: true}
+	split := flowspecChains()
+	assert.Same(t, split[0], routeChain(split, ipv4Route))
+	assert.Same(t, split[1], routeChain(split, ipv6Route))
+
+	config.nftSplitFamilies = false
+	inet := flowspecChains()
+	assert.Same(t, inet[0], routeChain(inet, ipv4Route))
+	assert.Same(t, inet[0], routeChain(inet, ipv6Route))
+
+	config.nftFamily = "ip"
+	ipv4Only := flowspecChains()
+	assert.Same(t, ipv4Only[0], routeChain(ipv4Only, ipv4Route))
+	assert.Nil(t, routeChain(ipv4Only, ipv6Route))
+	assert.Nil(t, routeChain(nil, ipv4Route))
+}
+
+func TestTableSeesFamily(t *testing.T) {
+	for _, family := range []nftables.TableFamily{nftables.TableFamilyINet, nftables.TableFamilyBridge, nftables.TableFamilyNetdev} {
+		assert.True(t, tableSeesFamily(&nftables.Table{Family: family}, false))
+		assert.True(t, tableSeesFamily(&nftables.Table{Family: family}, true))
+	}
+	assert.True(t, tableSeesFamily(&nftables.Table{Family: nftables.TableFamilyIPv4}, false))
+	assert.False(t, tableSeesFamily(&nftables.Table{Family: nftables.TableFamilyIPv4}, true))
+	assert.False(t, tableSeesFamily(&nftables.Table{Family: nftables.TableFamilyIPv6}, false))
+	assert.True(t, tableSeesFamily(&nftables.Table{Family: nftables.TableFamilyIPv6}, true))
+}
+
+func TestFlowspecChain(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	accept := nftables.ChainPolicyAccept
+
+	for _, testCase := range []struct {
+		name     string
+		config   configuration
+		expected *nftables.Chain
+	}{
+		{
+			name:     "regular chain",
+			config:   configuration{nftChain: "flowspec", nftFamily: "inet", nftPlacement: "filter"},
+			expected: &nftables.Chain{Name: "flowspec", Table: table},
+		},
+		{
+			name:     "forward hook",
+			config:   configuration{nftChain: "flowspec", nftFamily: "inet", nftPlacement: "filter", nftHook: "forward", nftPriority: -10},
+			expected: &nftables.Chain{Name: "flowspec", Table: table, Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookForward, Priority: nftables.ChainPriorityRef(-10), Policy: &accept},
+		},
+		{
+			name:     "raw placement",
+			config:   configuration{nftChain: "flowspec", nftFamily: "inet", nftPlacement: "raw"},
+			expected: &nftables.Chain{Name: "flowspec", Table: table, Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookPrerouting, Priority: nftables.ChainPriorityRaw, Policy: &accept},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config = testCase.config
+			assert.Equal(t, testCase.expected, flowspecChain(table))
+		})
+	}
+}
+
+func TestIngressChains(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyNetdev, Name: "flowspec"}
+	accept := nftables.ChainPolicyAccept
+
+	config = configuration{nftChain: "flowspec", nftFamily: "inet", nftPlacement: "netdev", nftPriority: -500}
+	assert.Empty(t, ingressChains(table))
+
+	config.nftDevices = []string{"eth0", "eth1"}
+	assert.Equal(t, []*nftables.Chain{
+		{Name: "flowspec_ingress_eth0", Table: table, Device: "eth0", Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookIngress, Priority: nftables.ChainPriorityRef(-500), Policy: &accept},
+		{Name: "flowspec_ingress_eth1", Table: table, Device: "eth1", Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookIngress, Priority: nftables.ChainPriorityRef(-500), Policy: &accept},
+	}, ingressChains(table))
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"bird-flowspec-daemon/internal/bird"
+	"bird-flowspec-daemon/internal/originate"
+)
+
+// newOriginator creates the originator of flowspec routes into BIRD and withdraws its expired routes until
+// ctx is done
+func newOriginator(ctx context.Context) (*originate.Originator, error) {
+	client := bird.Client{SocketPath: config.birdSocketPath}
+	originator, err := originate.New(originate.Config{
+		File4:     config.originateFile4,
+		File6:     config.originateFile6,
+		Configure: client.Configure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	go originator.Run(ctx)
+	return originator, nil
+}
+
+// serveOriginateAPI serves the API originating flowspec routes into BIRD until ctx is done
+func serveOriginateAPI(ctx context.Context, originator *originate.Originator) error {
+	server := &http.Server{Addr: config.originateListenAddress, Handler: originator.Handler()}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	slog.Info("serving origination API", slog.String("address", server.Addr), slog.Int("routes", len(originator.Routes())))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"bird-flowspec-daemon/internal/mrt"
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/rulebuilder"
+)
+
+// replayMRT replays the flowspec routes of a MRT file. The resulting rule sets are printed in dry run mode
+// and applied to nftables otherwise.
+func replayMRT(ctx context.Context) error {
+	file, err := os.Open(config.mrtReplayPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	chains := flowspecChains()
+	if !config.mrtDryRun {
+		_, chains = setupNftables(ctx)
+	}
+
+	return mrt.Replay(ctx, file, config.mrtSpeed, func(timestamp time.Time, flowSpecRoutes []route.FlowspecRoute) error {
+		ruleSets, rejected := buildRules(chains, flowSpecRoutes, timestamp)
+		if !config.mrtDryRun {
+			slog.Info("replaying MRT routes", slog.String("timestamp", timestamp.Format(time.RFC3339)), slog.Int("routes", len(flowSpecRoutes)))
+			for _, rules := range ruleSets {
+				if err := applyRules(rules); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for _, rules := range ruleSets {
+			fmt.Printf("# %s: %d rules in the %s table\n", timestamp.Format(time.RFC3339Nano), len(rules.rules), familyName(rules.chain.Table))
+			for _, rule := range rules.rules {
+				fmt.Println(rulebuilder.Describe(rule.Exprs))
+			}
+			for _, subChain := range rules.subChains {
+				fmt.Printf("# chain %s: %d rules\n", subChain.chain.Name, len(subChain.rules))
+				for _, rule := range subChain.rules {
+					fmt.Println(rulebuilder.Describe(rule.Exprs))
+				}
+			}
+			for _, set := range rules.sets {
+				fmt.Printf("# set %s: %s, %d elements\n", set.Set.Name, set.Set.KeyType.Name, len(set.Elements))
+			}
+		}
+		for _, rejectedRoute := range rejected {
+			fmt.Printf("# rejected %s: %s\n", rejectedRoute.Net, rejectedRoute.Reason)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+//go:build linux
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"bird-flowspec-daemon/internal/rulesum"
+)
+
+// maxChainNameLength is the longest chain name accepted by nftables (NFT_CHAIN_MAXNAMELEN without terminating NUL)
+const maxChainNameLength = 255
+
+// Infixes separate the name of the flowspec chain and the session or VRF in the names of sub-chains
+const (
+	sessionChainInfix = "_session_"
+	vrfChainInfix     = "_vrf_"
+)
+
+var (
+	// chainNameUnsafe matches the characters of session and device names replaced in chain names
+	chainNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+	// chainNameHashSuffix matches the suffix of names made unique by a hash
+	chainNameHashSuffix = regexp.MustCompile(`_[0-9a-f]{8}$`)
+)
+
+// subChainRules are the rules of a chain jumped to from the flowspec chain
+type subChainRules struct {
+	chain *nftables.Chain
+	rules []*nftables.Rule
+	// updates counts the updates of the chain if set
+	updates prometheus.Counter
+}
+
+// subChain returns the chain of the rules of a session or VRF, jumped to from chain. Names with characters
+// replaced in chain names, names too long for a chain name and names that look like they got a hash suffix get
+// a hash of the name as suffix, so different names never share a chain.
+func subChain(chain *nftables.Chain, infix string, name string) *nftables.Chain {
+	prefix := chain.Name + infix
+	safe := chainNameUnsafe.ReplaceAllString(name, "_")
+	if safe == name && name != "" && !chainNameHashSuffix.MatchString(name) && len(prefix)+len(name) <= maxChainNameLength {
+		return &nftables.Chain{Name: prefix + name, Table: chain.Table}
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	if length := maxChainNameLength - len(prefix) - len(suffix); len(safe) > length {
+		safe = safe[:max(length, 0)]
+	}
+	return &nftables.Chain{Name: prefix + safe + suffix, Table: chain.Table}
+}
+
+// isSubChain reports whether a chain of the table of chain is a session or VRF chain jumped to from chain
+func isSubChain(chain *nftables.Chain, name string) bool {
+	return strings.HasPrefix(name, chain.Name+sessionChainInfix) || strings.HasPrefix(name, chain.Name+vrfChainInfix)
+}
+
+// updateSubChains adds the sub-chains that do not exist yet and the rule changes of the others to the current
+// transaction. It reports whether there are any and returns the sub-chains no longer in use, which have to be
+// deleted after the jumps to them.
+func updateSubChains(nft *nftables.Conn, chain *nftables.Chain, subChains []subChainRules) (bool, []*nftables.Chain) {
+	existingChains, listError := nft.ListChainsOfTableFamily(chain.Table.Family)
+	if listError != nil {
+		slog.Error("error listing chains", slog.String("error", listError.Error()))
+	}
+	existing := make(map[string]bool)
+	for _, c := range existingChains {
+		if c.Table.Name == chain.Table.Name && isSubChain(chain, c.Name) {
+			existing[c.Name] = true
+		}
+	}
+
+	changed := false
+	for _, subChain := range subChains {
+		if existing[subChain.chain.Name] {
+			delete(existing, subChain.chain.Name)
+			if !updateRules(nft, subChain.chain, subChain.rules) {
+				continue
+			}
+		} else {
+			slog.Info("adding chain", slog.String("chain", subChain.chain.Name), slog.Int("rules", len(subChain.rules)))
+			nft.AddChain(subChain.chain)
+			for _, insertion := range rulesum.Diff(nil, subChain.rules).Insert {
+				nft.AddRule(insertion.Rule)
+			}
+		}
+		if subChain.updates != nil {
+			subChain.updates.Inc()
+		}
+		changed = true
+	}
+
+	var unused []*nftables.Chain
+	for name := range existing {
+		unused = append(unused, &nftables.Chain{Name: name, Table: chain.Table})
+	}
+	slices.SortFunc(unused, func(a, b *nftables.Chain) int { return strings.Compare(a.Name, b.Name) })
+	return changed, unused
+}
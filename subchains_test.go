@@ -0,0 +1,92 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubChain(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	chain := &nftables.Chain{Name: "flowspec", Table: table}
+
+	for _, testCase := range []struct {
+		name     string
+		infix    string
+		in       string
+		expected string
+	}{
+		{
+			name:     "session name",
+			infix:    sessionChainInfix,
+			in:       "flowspec_static",
+			expected: "flowspec_session_flowspec_static",
+		},
+		{
+			name:     "VRF device",
+			infix:    vrfChainInfix,
+			in:       "vrf-red",
+			expected: "flowspec_vrf_vrf-red",
+		},
+		{
+			name:     "replaced characters",
+			infix:    sessionChainInfix,
+			in:       "a.b",
+			expected: "flowspec_session_a_b_2e7336dc",
+		},
+		{
+			name:     "name of a replaced name",
+			infix:    sessionChainInfix,
+			in:       "a_b",
+			expected: "flowspec_session_a_b",
+		},
+		{
+			// Names looking like they got a hash suffix get one, so they never collide with a hashed name
+			name:     "name with hash suffix",
+			infix:    sessionChainInfix,
+			in:       "a_b_2e7336dc",
+			expected: "flowspec_session_a_b_2e7336dc_eb002823",
+		},
+		{
+			name:     "empty name",
+			infix:    sessionChainInfix,
+			in:       "",
+			expected: "flowspec_session__e3b0c442",
+		},
+		{
+			name:     "longest name",
+			infix:    sessionChainInfix,
+			in:       strings.Repeat("a", 238),
+			expected: "flowspec_session_" + strings.Repeat("a", 238),
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			sub := subChain(chain, testCase.infix, testCase.in)
+			assert.Equal(t, testCase.expected, sub.Name)
+			assert.Equal(t, table, sub.Table)
+			assert.True(t, isSubChain(chain, sub.Name))
+		})
+	}
+
+	long := subChain(chain, sessionChainInfix, strings.Repeat("a", 300))
+	assert.Len(t, long.Name, maxChainNameLength)
+	assert.NotEqual(t, long.Name, subChain(chain, sessionChainInfix, strings.Repeat("a", 301)).Name)
+
+	assert.False(t, isSubChain(chain, "flowspec_blue"))
+	assert.False(t, isSubChain(chain, "other_session_a"))
+}
+
+func TestJumpRule(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	chain := &nftables.Chain{Name: "flowspec", Table: table}
+
+	jump := jumpRule(chain, subChain(chain, sessionChainInfix, "bgp1"))
+	assert.Equal(t, chain, jump.Chain)
+	assert.Equal(t, table, jump.Table)
+	assert.Equal(t, []expr.Any{&expr.Verdict{Kind: expr.VerdictJump, Chain: "flowspec_session_bgp1"}}, jump.Exprs)
+}
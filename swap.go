@@ -0,0 +1,100 @@
+//go:build linux
+
+package main
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/google/nftables"
+
+	"bird-flowspec-daemon/internal/rulesum"
+)
+
+// Modes of updating the rules of the flowspec chain
+const (
+	ruleUpdateIncremental = "incremental"
+	ruleUpdateSwap        = "swap"
+)
+
+// swapChains returns the chains alternately holding the rules in swap mode, the dispatch chain jumps to the
+// active one
+func swapChains(dispatch *nftables.Chain) []string {
+	return []string{dispatch.Name + "_blue", dispatch.Name + "_green"}
+}
+
+// activeSwapChain returns the jump rule of the dispatch chain and the swap chain it jumps to. Once set up, the
+// dispatch chain contains nothing but the jump, which is retargeted to the next swap chain. It returns nil and ""
+// for other dispatch chains, e.g. with the rules of the incremental mode, which are replaced by a jump.
+func activeSwapChain(dispatch *nftables.Chain, dispatchRules []*nftables.Rule) (*nftables.Rule, string) {
+	if len(dispatchRules) != 1 {
+		return nil, ""
+	}
+	if target := jumpTarget(dispatchRules[0]); slices.Contains(swapChains(dispatch), target) {
+		return dispatchRules[0], target
+	}
+	return nil, ""
+}
+
+// nextSwapChain returns the swap chain receiving the rules of the next update
+func nextSwapChain(dispatch *nftables.Chain, active string) string {
+	chains := swapChains(dispatch)
+	if active == chains[0] {
+		return chains[1]
+	}
+	return chains[0]
+}
+
+// swapRules adds the rules to the inactive swap chain, retargets the jump rule of the dispatch chain to it and
+// deletes the previously active swap chain, all in the current transaction. It reports whether the rules
+// changed.
+func swapRules(nft *nftables.Conn, dispatch *nftables.Chain, nftRules []*nftables.Rule) bool {
+	dispatchRules, getRulesError := nft.GetRules(dispatch.Table, dispatch)
+	if getRulesError != nil {
+		slog.Error("error getting dispatch rules", slog.String("error", getRulesError.Error()))
+	}
+
+	jump, active := activeSwapChain(dispatch, dispatchRules)
+
+	var activeRules []*nftables.Rule
+	if active != "" {
+		activeRules, getRulesError = nft.GetRules(dispatch.Table, &nftables.Chain{Name: active, Table: dispatch.Table})
+		if getRulesError != nil {
+			slog.Error("error getting existing rules", slog.String("chain", active), slog.String("error", getRulesError.Error()))
+		}
+	}
+	if unchanged := rulesum.Diff(activeRules, nftRules).Empty(); unchanged && active != "" {
+		return false
+	}
+
+	next := nextSwapChain(dispatch, active)
+	nextChain := nft.AddChain(&nftables.Chain{Name: next, Table: dispatch.Table})
+	// The chain may be left over from an interrupted swap
+	nft.FlushChain(nextChain)
+	if config.ruleCopyCounters {
+		rulesum.CopyCounters(activeRules, nftRules)
+	}
+	for _, rule := range nftRules {
+		rule.Chain = nextChain
+		nft.AddRule(rule)
+	}
+
+	jumpRule := jumpRule(dispatch, nextChain)
+	if jump != nil {
+		jumpRule.Handle = jump.Handle
+		nft.ReplaceRule(jumpRule)
+	} else {
+		// Rules of the incremental mode are replaced by the jump
+		nft.FlushChain(dispatch)
+		nft.AddRule(jumpRule)
+	}
+
+	if active != "" {
+		activeChain := &nftables.Chain{Name: active, Table: dispatch.Table}
+		nft.FlushChain(activeChain)
+		nft.DelChain(activeChain)
+	}
+
+	slog.Info("swapping flowspec chain", slog.String("chain", next), slog.Int("rules", len(nftRules)))
+	return true
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveSwapChain(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	dispatch := &nftables.Chain{Name: "flowspec", Table: table}
+	blue := jumpRule(dispatch, &nftables.Chain{Name: "flowspec_blue", Table: table})
+	green := jumpRule(dispatch, &nftables.Chain{Name: "flowspec_green", Table: table})
+	session := jumpRule(dispatch, &nftables.Chain{Name: "flowspec_session_bgp1", Table: table})
+	drop := &nftables.Rule{Exprs: []expr.Any{&expr.Verdict{Kind: expr.VerdictDrop}}}
+
+	for _, testCase := range []struct {
+		name           string
+		rules          []*nftables.Rule
+		expectedJump   *nftables.Rule
+		expectedActive string
+		expectedNext   string
+	}{
+		{
+			name:         "empty dispatch chain",
+			expectedNext: "flowspec_blue",
+		},
+		{
+			name:           "blue active",
+			rules:          []*nftables.Rule{blue},
+			expectedJump:   blue,
+			expectedActive: "flowspec_blue",
+			expectedNext:   "flowspec_green",
+		},
+		{
+			name:           "green active",
+			rules:          []*nftables.Rule{green},
+			expectedJump:   green,
+			expectedActive: "flowspec_green",
+			expectedNext:   "flowspec_blue",
+		},
+		{
+			name:         "rules of the incremental mode",
+			rules:        []*nftables.Rule{drop, drop},
+			expectedNext: "flowspec_blue",
+		},
+		{
+			name:         "single rule of the incremental mode",
+			rules:        []*nftables.Rule{drop},
+			expectedNext: "flowspec_blue",
+		},
+		{
+			name:         "jump to a session chain",
+			rules:        []*nftables.Rule{session},
+			expectedNext: "flowspec_blue",
+		},
+		{
+			name:         "jump followed by rules",
+			rules:        []*nftables.Rule{blue, drop},
+			expectedNext: "flowspec_blue",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			jump, active := activeSwapChain(dispatch, testCase.rules)
+			assert.Same(t, testCase.expectedJump, jump)
+			assert.Equal(t, testCase.expectedActive, active)
+			assert.Equal(t, testCase.expectedNext, nextSwapChain(dispatch, active))
+		})
+	}
+}
+
+func TestJumpTarget(t *testing.T) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	jump := jumpRule(&nftables.Chain{Name: "flowspec", Table: table}, &nftables.Chain{Name: "flowspec_blue", Table: table})
+	assert.Equal(t, "flowspec_blue", jumpTarget(jump))
+	assert.Equal(t, "", jumpTarget(&nftables.Rule{Exprs: []expr.Any{&expr.Verdict{Kind: expr.VerdictGoto, Chain: "flowspec_blue"}}}))
+	assert.Equal(t, "", jumpTarget(&nftables.Rule{Exprs: []expr.Any{&expr.Counter{}, &expr.Verdict{Kind: expr.VerdictJump, Chain: "flowspec_blue"}}}))
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/nftables"
+
+	"bird-flowspec-daemon/internal/route"
+	"bird-flowspec-daemon/internal/rulebuilder"
+)
+
+// Interfaces of which received packets are subject to the rules of a VRF
+const (
+	vrfMatchDevice  = "device"
+	vrfMatchMembers = "members"
+)
+
+// sysClassNet lists the network interfaces and their relations
+var sysClassNet = "/sys/class/net"
+
+// routeVRF returns the VRF device mapped to the BIRD table or else the protocol of a route, or "" for routes
+// enforced for all traffic
+func routeVRF(flowSpecRoute route.FlowspecRoute) string {
+	if device, ok := config.vrfs[flowSpecRoute.SessionAttrs.Table]; ok && flowSpecRoute.SessionAttrs.Table != "" {
+		return device
+	}
+	return config.vrfs[flowSpecRoute.SessionAttrs.SessionName]
+}
+
+// vrfJumps returns the rules of the flowspec chain jumping to the chain of a VRF for packets received on the
+// VRF device or its members. VRFs of which the members can not be determined are not jumped to, so their rules
+// never apply to the traffic of other VRFs.
+func vrfJumps(chain *nftables.Chain, vrf *nftables.Chain, device string) []*nftables.Rule {
+	interfaces := []string{device}
+	if config.vrfMatch == vrfMatchMembers {
+		members, err := vrfMembers(device)
+		if err != nil {
+			slog.Error("error getting VRF members, VRF rules are not enforced", slog.String("vrf", device), slog.String("error", err.Error()))
+		}
+		interfaces = members
+	}
+
+	var rules []*nftables.Rule
+	for _, iifname := range interfaces {
+		rules = append(rules, &nftables.Rule{
+			Table: chain.Table,
+			Chain: chain,
+			Exprs: rulebuilder.InterfaceJumpExpressions(iifname, vrf.Name),
+		})
+	}
+	return rules
+}
+
+// vrfMembers returns the interfaces enslaved to a VRF device
+func vrfMembers(device string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(sysClassNet, device)); err != nil {
+		return nil, fmt.Errorf("device %s: %v", device, err)
+	}
+	lower, err := filepath.Glob(filepath.Join(sysClassNet, device, "lower_*"))
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	for _, path := range lower {
+		members = append(members, strings.TrimPrefix(filepath.Base(path), "lower_"))
+	}
+	return members, nil
+}
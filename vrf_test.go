@@ -0,0 +1,86 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bird-flowspec-daemon/internal/rulebuilder"
+)
+
+func TestVRFMembers(t *testing.T) {
+	// Members of a VRF are linked as lower_<interface> in the directory of the VRF device
+	sysClassNet = t.TempDir()
+	for _, device := range []string{"vrf-red", "vrf-blue", "eth0", "eth1", "eth2"} {
+		require.NoError(t, os.Mkdir(filepath.Join(sysClassNet, device), 0o755))
+	}
+	for _, member := range []string{"eth0", "eth1"} {
+		require.NoError(t, os.Symlink(filepath.Join("..", member), filepath.Join(sysClassNet, "vrf-red", "lower_"+member)))
+	}
+	require.NoError(t, os.Symlink(filepath.Join("..", "vrf-red"), filepath.Join(sysClassNet, "eth0", "upper_vrf-red")))
+
+	members, err := vrfMembers("vrf-red")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eth0", "eth1"}, members)
+
+	members, err = vrfMembers("vrf-blue")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	_, err = vrfMembers("vrf-green")
+	assert.Error(t, err)
+}
+
+func TestVRFJumps(t *testing.T) {
+	sysClassNet = t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sysClassNet, "vrf-red"), 0o755))
+	for _, member := range []string{"eth0", "eth1"} {
+		require.NoError(t, os.Symlink(filepath.Join("..", member), filepath.Join(sysClassNet, "vrf-red", "lower_"+member)))
+	}
+
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: "filter"}
+	chain := &nftables.Chain{Name: "flowspec", Table: table}
+	vrf := &nftables.Chain{Name: "flowspec_vrf_vrf-red", Table: table}
+
+	for _, testCase := range []struct {
+		name     string
+		vrfMatch string
+		device   string
+		expected []string
+	}{
+		{
+			name:     "VRF device",
+			vrfMatch: vrfMatchDevice,
+			device:   "vrf-red",
+			expected: []string{`iifname "vrf-red" jump flowspec_vrf_vrf-red`},
+		},
+		{
+			name:     "VRF members",
+			vrfMatch: vrfMatchMembers,
+			device:   "vrf-red",
+			expected: []string{`iifname "eth0" jump flowspec_vrf_vrf-red`, `iifname "eth1" jump flowspec_vrf_vrf-red`},
+		},
+		{
+			name:     "members of a missing VRF",
+			vrfMatch: vrfMatchMembers,
+			device:   "vrf-green",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config = configuration{vrfMatch: testCase.vrfMatch}
+			var described []string
+			for _, rule := range vrfJumps(chain, vrf, testCase.device) {
+				assert.Equal(t, chain, rule.Chain)
+				assert.Equal(t, table, rule.Table)
+				described = append(described, rulebuilder.Describe(rule.Exprs))
+			}
+			assert.Equal(t, testCase.expected, described)
+		})
+	}
+}